@@ -28,7 +28,7 @@ import (
 var addCmd = &cobra.Command{
 	Use:   "add <mission_name> <regexp>",
 	Short: "Add a regexp to ignore field of mission",
-	Long:  `Add command adds a regexp to ignore field of mission, if it has not been existed.`,
+	Long:  `Add command adds a regexp to ignore field of mission, if it has not been existed. The regexp is matched against the slash separated path relative to SRC or DEST.`,
 	Args:  cobra.ExactArgs(2),
 	Run:   addRun,
 }
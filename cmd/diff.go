@@ -0,0 +1,158 @@
+// Copyright © 2018 Mephis Pheies <mephistommm@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/MephistoMMM/grafter/plan"
+	"github.com/spf13/cobra"
+)
+
+var (
+	diffPatchFile string
+	diffTarget    string
+	diffSrcRev    string
+	diffReverse   bool
+)
+
+// diffCmd represents the diff command
+var diffCmd = &cobra.Command{
+	Use:   "diff <mission_name>",
+	Short: "Show changes graft would make to DEST",
+	Long: `Diff command plans the graft of mission without applying it, and prints the changes as a unified diff in git format, including new files, deletions, binary files and changes of executable bit. Conflicts are reported but not included.
+	--patch-file writes the patch into a file instead, which could be applied in DEST by 'git apply'. With --output json or yaml, plans are printed as a Diff document, the patch of each operation is included. A mission with several destinations must select one by --target.
+	--reverse shows the changes 'grafter upstream' would make to SRC instead, the patch is relative to SRC.
+	Changes of a bidirectional mission are planned like graft does, files changed by both sides are resolved by the strategy of mission, or reported as conflicts if it's ask. --reverse shows the changes it would make to SRC.`,
+	Args: cobra.ExactArgs(1),
+	Run:  diffRun,
+}
+
+func init() {
+	rootCmd.AddCommand(diffCmd)
+	diffCmd.Flags().StringVar(&diffPatchFile, "patch-file", "", "write patch into file")
+	diffCmd.Flags().StringVar(&diffTarget, "target", "", "only diff this destination")
+	diffCmd.Flags().StringVar(&diffSrcRev, "src-rev", "", "diff SRC at git revision instead of working tree")
+	diffCmd.Flags().BoolVar(&diffReverse, "reverse", false, "diff DEST changes to move back to SRC")
+}
+
+func diffRun(cmd *cobra.Command, args []string) {
+	name := args[0]
+
+	M := Store.Get(name)
+	if M == nil {
+		log.Fatalf("Mission %s doesn't exist.", name)
+	}
+
+	var out io.Writer = os.Stdout
+	switch {
+	case diffPatchFile == "" && structured():
+		// plans are printed as document
+		out = ioutil.Discard
+	case diffPatchFile == "":
+		// keep the patch apart from logs
+		log.SetOutput(os.Stderr)
+	}
+
+	dests := M.Dests()
+	if diffTarget != "" {
+		target, err := filepath.Abs(diffTarget)
+		if err != nil {
+			log.Fatal(err)
+		}
+		dests = nil
+		for _, dest := range M.Dests() {
+			if dest == target {
+				dests = append(dests, dest)
+			}
+		}
+		if len(dests) == 0 {
+			log.Fatalf("%s is not a destination of mission %s.", diffTarget, name)
+		}
+	}
+	if diffPatchFile != "" && len(dests) > 1 {
+		log.Fatalf("Mission %s has %d destinations, select one by --target.", name, len(dests))
+	}
+
+	sc, err := plan.NewScan(M, plan.Options{
+		BaselineDir: Store.BaselineDir(),
+		SrcRev:      diffSrcRev,
+	})
+	defer sc.Close()
+	sc.Report.Log()
+	if err != nil {
+		log.Fatalf("Diff %s aborted: %v", M.Name, err)
+	}
+
+	if diffPatchFile != "" {
+		f, err := os.Create(diffPatchFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		out = f
+	}
+
+	failed := len(sc.Report.Errors)
+	doc := diffDoc{
+		Mission: M.Name,
+		Plans:   []planDoc{},
+		Errors:  errorStrings(sc.Report.Errors),
+	}
+	for _, dest := range dests {
+		var p *plan.Plan
+		switch {
+		case M.Bidirectional() && diffSrcRev == "":
+			fwd, rev, e := sc.Sync(dest, diffResolver(M))
+			p, err = fwd, e
+			if diffReverse {
+				p = rev
+			}
+		case diffReverse:
+			p, err = sc.Reverse(dest)
+		default:
+			p, err = sc.Plan(dest)
+		}
+		if err != nil {
+			log.Fatalf("Diff %s aborted: %v", M.Name, err)
+		}
+		p.Report.Log()
+		failed += len(p.Report.Errors)
+
+		if len(dests) > 1 {
+			fmt.Fprintf(out, "# %s\n", dest)
+		}
+		if err := p.WriteDiff(out); err != nil {
+			log.Fatal(err)
+		}
+		log.Infof("Diff %s -> %s: %s.", M.Name, p.Dest, p.Summary())
+		doc.Plans = append(doc.Plans, newPlanDoc(M, p, true))
+	}
+	if structured() {
+		printDocument("Diff", doc)
+	}
+	if failed > 0 {
+		log.Fatalf("Diff %s finished with %d error(s).", M.Name, failed)
+	}
+}
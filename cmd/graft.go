@@ -21,23 +21,74 @@
 package cmd
 
 import (
+	"bytes"
 	"fmt"
-	"os"
 	"path/filepath"
-	"runtime"
+	"strings"
 	"sync"
+	"text/template"
+	"time"
 
+	"github.com/MephistoMMM/grafter/git"
 	"github.com/MephistoMMM/grafter/model"
-	"github.com/MephistoMMM/grafter/util"
+	"github.com/MephistoMMM/grafter/plan"
 	"github.com/spf13/cobra"
 )
 
+// defaultCommitMessage is the template of commit message of graft --commit.
+const defaultCommitMessage = `Graft {{.Mission}}
+
+{{.Summary}}.
+
+Grafted-from: {{.Src}}{{with .SrcHead}} {{.}}{{end}}
+`
+
+var (
+	graftSrcRev      string
+	graftIncremental bool
+	graftCommit      bool
+	graftBranch      string
+	graftMessage     string
+	graftAllowDirty  bool
+	graftInteractive bool
+)
+
 // graftCmd represents the graft command
 var graftCmd = &cobra.Command{
 	Use:   "graft <mission_name>",
 	Short: "Move files to DEST project from the SRC",
-	Long: `Graft command just move all files except ignored files to DEST project from the SRC. More powerful functions will coming soon.
+	Long: `Graft command just move all files except ignored files to DEST project from the SRC, then remove files of DEST which don't exist in SRC. More powerful functions will coming soon.
 	Ignore configs should be add into the item of grafter configuration file.
+
+	Ignore rules are evaluated for each side separately:
+	  - SRC files are ignored by dot files, unregular files, the .gitignore of SRC and ignore regexps of mission.
+	  - DEST files are ignored by dot files, unregular files, the .gitignore of DEST and ignore regexps of mission, ignored DEST files are never removed.
+	  - A DEST file is never removed if its SRC path would be ignored by the rules of SRC.
+	Ignore regexps are matched against the slash separated path relative to SRC or DEST.
+
+	--commit stages exactly the files changed by graft and commits them in the git repository of each DEST, on --branch if it's given. DEST must have no uncommitted changes of files graft does not touch unless --allow-dirty is given, the branch is checked out after planning succeeds. The commit message is rendered from the --message template.
+
+	--src-rev grafts SRC at a git revision, files are read from the local object database of each source repository instead of the working tree. Ignore rules of SRC still come from the working tree. Every successful graft is recorded in the history of mission with the SRC commit.
+
+	--incremental grafts SRC at --src-rev, or HEAD, but only plans files changed since the SRC commit of the last graft according to git history, renames included. It falls back to a full graft of the same revision if the last graft is unknown, was from a dirty working tree, or sources are not in the same repository.
+
+	A DEST file whose SRC file is renamed is moved instead of deleted and added again, renames are detected by the similarity of content grafted last time and the new SRC content. DEST changes of the file are kept if SRC only renamed it, and it's reported as a conflict if both sides changed it.
+
+	--output json or yaml prints the result as a Graft document, including operations and errors of every destination and the time spent.
+
+	--interactive steps through every planned change, showing its diff, and applies only the accepted ones. A change could also be skipped permanently: ignore adds a regexp of the SRC file to the ignore rules of its source, protect adds a regexp of the DEST file to the ignore rules of mission, so it's never removed. Accepted changes are listed at the end.
+
+	The executable bit of SRC files is grafted too. Run 'grafter diff' to review the changes before grafting, and 'grafter upstream' to move changes made in DEST back to SRC.
+
+	Mapping rules of mission are applied when SRC files are copied to DEST and when DEST files are traced back to SRC before removing.
+
+	A mission could have several sources, each is grafted into its own sub directory of DEST with its own ignore regexps and mappings. A DEST file is only removed by the source owning its directory, and DEST files produced by more than one SRC file are reported as conflicts and left untouched.
+
+	A mission could also have several destinations (see 'grafter target'). Sources are walked once, then every destination is planned and grafted concurrently.
+
+	The SRC content grafted into each destination is recorded as baseline beside the mission store. The merge transform uses it as merge base of YAML and JSON files, keys changed by both SRC and DEST are reported as conflicts.
+
+	A bidirectional mission (see 'grafter mode') also moves changes made in DEST back to SRC like 'grafter upstream'. A file changed by both sides since the last graft is resolved by the strategy of mission: newer-wins keeps the side modified later, src-wins and dest-wins always keep one side, merge merges changes of both sides line by line and leaves overlapped changes as conflicts, and ask prompts for each file. Destinations are synced one by one, --src-rev and --incremental are not supported.
 `,
 	Args: cobra.ExactArgs(1),
 	Run:  graftRun,
@@ -45,6 +96,14 @@ var graftCmd = &cobra.Command{
 
 func init() {
 	rootCmd.AddCommand(graftCmd)
+	graftCmd.Flags().StringVar(&graftSrcRev, "src-rev", "", "graft SRC at git revision (tag, branch or commit) instead of working tree")
+	graftCmd.Flags().BoolVar(&graftIncremental, "incremental", false, "only graft files changed in SRC since the last graft")
+	graftCmd.Flags().BoolVar(&graftCommit, "commit", false, "commit the grafted files in DEST repository")
+	graftCmd.Flags().StringVar(&graftBranch, "branch", "", "branch to commit on, it's created if it doesn't exist")
+	graftCmd.Flags().StringVar(&graftMessage, "message", defaultCommitMessage,
+		"template of commit message, fields are Mission, Src, SrcHead, Dest and Summary")
+	graftCmd.Flags().BoolVar(&graftAllowDirty, "allow-dirty", false, "commit even if DEST has unrelated uncommitted changes")
+	graftCmd.Flags().BoolVarP(&graftInteractive, "interactive", "i", false, "review every change before applying it")
 }
 
 func graftRun(cmd *cobra.Command, args []string) {
@@ -54,142 +113,323 @@ func graftRun(cmd *cobra.Command, args []string) {
 	if M == nil {
 		log.Fatalf("Mission %s doesn't exist.", name)
 	}
+	if graftInteractive && structured() {
+		log.Fatalf("--interactive can't be used with --output %s.", outputFormat)
+	}
+	start := time.Now()
+
+	var (
+		repos   []*git.Repo
+		message *template.Template
+		err     error
+	)
+	if graftCommit {
+		if message, err = template.New("message").Parse(graftMessage); err != nil {
+			log.Fatalf("Invalid commit message template: %v", err)
+		}
+	}
 
-	graft(M)
-}
+	if M.Bidirectional() {
+		if graftSrcRev != "" || graftIncremental || graftInteractive {
+			log.Fatalf("Mission %s is bidirectional, it can only graft the working tree of SRC without --interactive.", M.Name)
+		}
+		if graftCommit {
+			plans, err := syncPlans(M)
+			if err != nil {
+				printGraft(M, start, plans, []error{err}, "")
+				log.Fatalf("Graft %s aborted: %v", M.Name, err)
+			}
+			repos = prepareCommit(M, plans)
+		}
+		syncGraft(M, start, repos, message)
+		return
+	}
 
-func combineIgnoreChain(M *model.Mission) util.IgnoreSupport {
-	var checker, tail util.IgnoreSupport
-	tail, err := util.NewIgnoreDotSupport()
-	if err != nil {
-		log.Fatal(err)
+	opts := plan.Options{
+		BaselineDir: Store.BaselineDir(),
+		SrcRev:      graftSrcRev,
+	}
+	if graftIncremental {
+		since, reason := incrementalBase(M)
+		if since == "" {
+			log.Infof("Fall back to full graft: %s.", reason)
+		}
+		if _, err := git.Open(M.Src); err == nil && opts.SrcRev == "" {
+			opts.SrcRev = "HEAD"
+		}
+		opts.Since = since
 	}
-	checker = tail
 
-	ignoreUnregular, err := util.NewIgnoreUnregularSupport()
-	if err != nil {
-		log.Fatal(err)
+	if graftCommit {
+		// the branch is checked out after planning succeeds, graft plans
+		// again in case it's not at the same commit
+		sc, plans, err := plan.BuildAll(M, opts)
+		sc.Close()
+		if err != nil {
+			sc.Report.Log()
+			printGraft(M, start, plans, append(sc.Report.Errors, err), "")
+			log.Fatalf("Graft %s aborted: %v", M.Name, err)
+		}
+		repos = prepareCommit(M, plans)
 	}
-	tail = tail.SetNext(ignoreUnregular)
 
-	// gitignore support ignores filepath matched patterns in .gitignore
-	gitIgnore, err := util.NewGitIgnoreSupport(M.Src)
+	var review func(*plan.Plan)
+	if graftInteractive {
+		review = func(p *plan.Plan) { reviewPlan(M, p) }
+	}
+	sc, plans, err := graft(M, opts, review)
+	sc.Report.Log()
 	if err != nil {
-		log.Fatal(err)
+		printGraft(M, start, plans, append(sc.Report.Errors, err), "")
+		log.Fatalf("Graft %s aborted: %v", M.Name, err)
 	}
-	tail = tail.SetNext(gitIgnore)
 
-	// create regexp match supports from ignore field
-	regexpMatches, err := util.NewMultiIgnoreRegexpMatchSupports(M.Ignore)
-	if err != nil {
-		log.Fatal(err)
+	if graftInteractive {
+		summarizeReview(plans)
+	}
+	failed := len(sc.Report.Errors)
+	for _, p := range plans {
+		p.Report.Log()
+		log.Infof("Graft %s -> %s: %s.", M.Name, p.Dest, p.Summary())
+		failed += len(p.Report.Errors)
+	}
+	if failed > 0 {
+		printGraft(M, start, plans, sc.Report.Errors, "")
+		log.Fatalf("Graft %s finished with %d error(s).", M.Name, failed)
 	}
-	tail = tail.SetNexts(regexpMatches)
 
-	return checker
+	commit := recordGraft(M, opts.SrcRev, sc.Commit())
+	for i, p := range plans {
+		if repos != nil {
+			commitPlan(M, repos[i], p, message, commit)
+		}
+	}
+	printGraft(M, start, plans, nil, commit)
 }
 
-func graft(M *model.Mission) {
-	log.Infof("Do Graft For %s", M.Name)
-
-	checker := combineIgnoreChain(M)
-	copyDifferent(M, checker)
-	removeNotExist(M, checker)
+// recordGraft adds a graft of SRC revision rev into history of M, commit is
+// the SRC commit grafted or empty if the working tree is grafted. It return
+// the SRC commit recorded.
+func recordGraft(M *model.Mission, rev, commit string) string {
+	record := model.Graft{
+		Time:   time.Now(),
+		Rev:    rev,
+		Commit: commit,
+	}
+	if repo, err := git.Open(M.Src); record.Commit == "" && err == nil {
+		record.Commit, _ = repo.Head()
+		dirty, err := repo.Dirty()
+		record.Dirty = err != nil || len(dirty) > 0
+	}
+	M.AddHistory(record)
+	Store.Modified(true)
+	return record.Commit
 }
 
-func removeNotExist(M *model.Mission, checker util.IgnoreSupport) {
-	walker := util.NewWalker(M.Dest, checker, 10)
-	go func(w *util.Walker) {
-		if err := w.Walk(); err != nil {
-			log.Errorf("Walker[%s] error: %v.", w.Dir(), err)
-		}
-	}(walker)
-
-	var wg sync.WaitGroup
-	pipe := walker.Pipe()
-	for i := 0; i < runtime.NumCPU(); i++ {
-		wg.Add(1)
-		go doRemove(&wg, pipe, M)
+// incrementalBase return the SRC commit of the last graft of M, which the
+// incremental graft is based on. It return the reason instead if the last
+// graft can't be trusted.
+func incrementalBase(M *model.Mission) (string, string) {
+	g := M.LastGraft()
+	switch {
+	case g == nil:
+		return "", "no graft in history"
+	case g.Commit == "":
+		return "", "SRC commit of the last graft is unknown"
+	case g.Dirty:
+		return "", "the last graft was from a dirty working tree"
 	}
 
-	wg.Wait()
+	repo, err := srcRepository(M)
+	if err != nil {
+		return "", err.Error()
+	}
+	if _, err := repo.RevParse(g.Commit); err != nil {
+		return "", err.Error()
+	}
+	return g.Commit, ""
 }
 
-func copyDifferent(M *model.Mission, checker util.IgnoreSupport) {
-	walker := util.NewWalker(M.Src, checker, 10)
-	go func(w *util.Walker) {
-		if err := w.Walk(); err != nil {
-			log.Errorf("Walker[%s] error: %v.", w.Dir(), err)
+// srcRepository return the git repository of SRC of M, all sources of M must
+// be in the same repository.
+func srcRepository(M *model.Mission) (*git.Repo, error) {
+	repo, err := git.Open(M.Src)
+	if err != nil {
+		return nil, err
+	}
+	top, err := repo.Top()
+	if err != nil {
+		return nil, err
+	}
+	for _, root := range M.Roots() {
+		r, err := git.Open(root.Path)
+		if err != nil {
+			return nil, err
+		}
+		if t, _ := r.Top(); t != top {
+			return nil, fmt.Errorf("source %s is not in the repository of SRC", root.Path)
 		}
-	}(walker)
-
-	var wg sync.WaitGroup
-	pipe := walker.Pipe()
-	for i := 0; i < runtime.NumCPU(); i++ {
-		wg.Add(1)
-		go doCopy(&wg, pipe, M)
 	}
-
-	wg.Wait()
+	return repo, nil
 }
 
-func doRemove(wg *sync.WaitGroup, pipe <-chan *util.Item, M *model.Mission) {
-	for dest := range pipe {
-		if dest.Err != nil {
-			log.Infof("Receive Error From Pipe: %v.", dest.Err)
-			continue
+// prepareCommit open the repository of every destination of M, make sure
+// there is no uncommitted change unrelated to plans and checks out the
+// branch. Plans of bidirectional missions are in pairs of forward and
+// reverse, see syncPlans, DEST files written back to SRC are related too.
+func prepareCommit(M *model.Mission, plans []*plan.Plan) []*git.Repo {
+	related := map[string]map[string]bool{}
+	dest := ""
+	for _, p := range plans {
+		if p.Dest != M.Src {
+			dest = p.Dest
+			related[dest] = map[string]bool{}
+		}
+		for _, o := range p.Operations {
+			if p.Dest == M.Src && o.BaseRel != "" {
+				// Rel of reverse operation is relative to SRC
+				related[dest][o.BaseRel] = true
+				continue
+			}
+			related[dest][o.Rel] = true
+			if o.From != "" {
+				related[dest][o.From] = true
+			}
 		}
+	}
 
-		src := filepath.Join(M.Src, dest.Path[len(M.Dest):])
-		if _, err := os.Stat(src); !os.IsNotExist(err) {
-			continue
+	var repos []*git.Repo
+	for _, dest := range M.Dests() {
+		repo, err := git.Open(dest)
+		if err != nil {
+			log.Fatal(err)
 		}
 
-		if err := os.Remove(dest.Path); err != nil {
-			log.Errorf("Failed to remove %s: %s", dest.Path, err.Error())
+		dirty, err := unrelatedChanges(repo, dest, related[dest])
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(dirty) > 0 && !graftAllowDirty {
+			log.Fatalf("DEST %s has unrelated uncommitted changes %v, commit them first or use --allow-dirty.", dest, dirty)
 		}
 
+		if graftBranch != "" {
+			if err := repo.Checkout(graftBranch); err != nil {
+				log.Fatal(err)
+			}
+		}
+		repos = append(repos, repo)
+	}
+	return repos
+}
+
+// unrelatedChanges return uncommitted changes of repo which are not files
+// of related, whose paths are slash separated and relative to dest.
+func unrelatedChanges(repo *git.Repo, dest string, related map[string]bool) ([]string, error) {
+	dirty, err := repo.Dirty()
+	if err != nil || len(dirty) == 0 {
+		return dirty, err
+	}
+	top, err := repo.Top()
+	if err != nil {
+		return nil, err
+	}
+	if real, err := filepath.EvalSymlinks(dest); err == nil {
+		dest = real
+	}
+
+	var unrelated []string
+	for _, path := range dirty {
+		rel, err := filepath.Rel(dest, filepath.Join(top, filepath.FromSlash(path)))
+		if err != nil || !related[filepath.ToSlash(rel)] {
+			unrelated = append(unrelated, path)
+		}
 	}
+	return unrelated, nil
+}
 
-	wg.Done()
+// commitMessage is the data of commit message template.
+type commitMessage struct {
+	Mission string
+	Src     string
+	SrcHead string
+	Dest    string
+	Summary string
 }
 
-func doCopy(wg *sync.WaitGroup, pipe <-chan *util.Item, M *model.Mission) {
-	for source := range pipe {
-		if source.Err != nil {
-			log.Infof("Receive Error From Pipe: %v.", source.Err)
+// commitPlan commits files changed by plan p in repo, the commit message is
+// rendered from template message, commit is the SRC commit grafted.
+func commitPlan(M *model.Mission, repo *git.Repo, p *plan.Plan, message *template.Template, commit string) {
+	var paths []string
+	for _, o := range p.Operations {
+		if o.Op == plan.OpConflict {
 			continue
 		}
-
-		dest := filepath.Join(M.Dest, source.Path[len(M.Src):])
-		isSame, err := compareFile(source.Path, dest)
-		if err != nil {
-			log.Error(err.Error())
+		paths = append(paths, filepath.FromSlash(o.Rel))
+		if o.From != "" {
+			paths = append(paths, filepath.FromSlash(o.From))
 		}
+	}
+	// untracked files deleted by graft are not committed
+	paths, err := repo.Known(paths)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(paths) == 0 {
+		log.Infof("Nothing to commit in %s.", p.Dest)
+		return
+	}
 
-		if !isSame {
-			util.CopyFile(source.Path, dest)
-		}
+	data := commitMessage{
+		Mission: M.Name,
+		Src:     M.Src,
+		Dest:    p.Dest,
+		SrcHead: commit,
+		Summary: p.Summary(),
+	}
+	buf := &bytes.Buffer{}
+	if err := message.Execute(buf, data); err != nil {
+		log.Fatalf("Invalid commit message template: %v", err)
 	}
 
-	wg.Done()
+	id, err := repo.Commit(paths, strings.TrimSpace(buf.String()), nil)
+	if err != nil {
+		log.Fatalf("Failed to commit graft in %s: %v", p.Dest, err)
+	}
+	log.Infof("Commit %s in %s.", id, p.Dest)
 }
 
-func compareFile(src, dest string) (bool, error) {
-	srcFi, err := os.Lstat(src)
-	if os.IsNotExist(err) {
-		return false, fmt.Errorf("Source file %s doesn't exist!", src)
-	}
+// graft walks sources of mission M once, then plans and applies the changes
+// to every destination concurrently. If review is not nil, it's called with
+// every plan one by one before applying. Nothing is applied if walking
+// sources failed anywhere. Errors while applying are collected into reports
+// of plans, the returned error means graft aborted.
+func graft(M *model.Mission, opts plan.Options, review func(*plan.Plan)) (*plan.Scan, []*plan.Plan, error) {
+	log.Infof("Do Graft For %s", M.Name)
 
-	destFi, err := os.Lstat(dest)
-	if os.IsNotExist(err) {
-		return false, nil
+	sc, plans, err := plan.BuildAll(M, opts)
+	defer sc.Close()
+	if err != nil {
+		return sc, plans, err
 	}
-
-	if srcFi.Size() != destFi.Size() {
-		return false, nil
+	// files missed by a failed walk would be deleted from DEST
+	if n := len(sc.Report.Errors); n > 0 {
+		return sc, plans, fmt.Errorf("%d error(s) while walking sources, nothing is applied", n)
+	}
+	if review != nil {
+		for _, p := range plans {
+			review(p)
+		}
 	}
 
-	// TODO : compare the content of two file
-	return false, nil
+	var wg sync.WaitGroup
+	for _, p := range plans {
+		wg.Add(1)
+		go func(p *plan.Plan) {
+			plan.Apply(p)
+			wg.Done()
+		}(p)
+	}
+	wg.Wait()
+	return sc, plans, nil
 }
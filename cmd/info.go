@@ -44,5 +44,9 @@ func infoRun(cmd *cobra.Command, args []string) {
 		log.Fatalf("Mission %s doesn't exist.", name)
 	}
 
+	if structured() {
+		printDocument("Mission", m)
+		return
+	}
 	log.Infoln(m.String())
 }
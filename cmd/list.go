@@ -23,6 +23,8 @@ package cmd
 import (
 	"fmt"
 
+	"github.com/MephistoMMM/grafter/model"
+
 	"github.com/spf13/cobra"
 )
 
@@ -39,6 +41,10 @@ func init() {
 }
 
 func listRun(cmd *cobra.Command, args []string) {
+	if structured() {
+		printDocument("MissionList", append([]model.Mission{}, Store.Missions...))
+		return
+	}
 	if len(Store.Missions) == 0 {
 		log.Fatalln("None Missions.")
 	}
@@ -42,6 +42,10 @@ func listallRun(cmd *cobra.Command, args []string) {
 	if mission == nil {
 		log.Fatalf("Invalid mission name: %s ", args[0])
 	}
+	if structured() {
+		printDocument("IgnoreList", listDoc{Mission: mission.Name, Items: append([]string{}, mission.Ignore...)})
+		return
+	}
 
 	for i, v := range mission.Ignore {
 		log.Printf("%d. %s", i, v)
@@ -0,0 +1,64 @@
+// Copyright © 2018 Mephis Pheies <mephistommm@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"github.com/MephistoMMM/grafter/model"
+	"github.com/spf13/cobra"
+)
+
+var mappingRegexp bool
+
+// mappingAddCmd represents the mapping add command
+var mappingAddCmd = &cobra.Command{
+	Use:   "add <mission_name> <src> <dest>",
+	Short: "Add a mapping rule to mission",
+	Long: `Add command adds a mapping rule to mappings field of mission, if it has not been existed.
+	By default src and dest are directory prefixes relative to SRC and DEST, e.g. "pkg/foo" and "internal/foo". With --regexp, src is a regexp matched against the relative SRC path and dest is the template of the whole DEST path, e.g. '^pkg/(\w+)/(.*)$' and 'internal/$1/$2'.`,
+	Args: cobra.ExactArgs(3),
+	Run:  mappingAddRun,
+}
+
+func init() {
+	mappingCmd.AddCommand(mappingAddCmd)
+	mappingAddCmd.Flags().BoolVar(&mappingRegexp, "regexp", false, "src is a regexp and dest is a template")
+}
+
+func mappingAddRun(cmd *cobra.Command, args []string) {
+	mission := Store.Get(args[0])
+	if mission == nil {
+		log.Fatalf("Invalid mission name: %s ", args[0])
+	}
+
+	mission.AddMapping(model.Mapping{
+		Src:    args[1],
+		Dest:   args[2],
+		Regexp: mappingRegexp,
+	})
+	mapper, err := mission.Mapper()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if !mapper.Invertible() {
+		log.Warnf("Mapping %s -> %s couldn't be inverted, matched DEST files will never be removed.", args[1], args[2])
+	}
+	Store.Modified(true)
+}
@@ -0,0 +1,55 @@
+// Copyright © 2018 Mephis Pheies <mephistommm@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"strconv"
+
+	"github.com/spf13/cobra"
+)
+
+// mappingRemoveCmd represents the mapping remove command
+var mappingRemoveCmd = &cobra.Command{
+	Use:   "remove <mission_name> <index>",
+	Short: "Remove a mapping rule according to index",
+	Long:  `Remove command removes a mapping rule from mappings field of mission. It is according to index of the rule. If index is out of range, it do nothing.`,
+	Args:  cobra.ExactArgs(2),
+	Run:   mappingRemoveRun,
+}
+
+func init() {
+	mappingCmd.AddCommand(mappingRemoveCmd)
+}
+
+func mappingRemoveRun(cmd *cobra.Command, args []string) {
+	index, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	mission := Store.Get(args[0])
+	if mission == nil {
+		log.Fatalf("Invalid mission name: %s ", args[0])
+	}
+
+	mission.RemoveMapping(index)
+	Store.Modified(true)
+}
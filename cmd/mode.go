@@ -0,0 +1,73 @@
+// Copyright © 2018 Mephis Pheies <mephistommm@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package cmd
+
+import (
+	"strings"
+
+	"github.com/MephistoMMM/grafter/model"
+	"github.com/spf13/cobra"
+)
+
+var modeStrategy string
+
+// modeCmd represents the mode command
+var modeCmd = &cobra.Command{
+	Use:   "mode <mission_name> [oneway|bidirectional]",
+	Short: "Show or change the sync mode of mission",
+	Long: `Mode command prints the mode of mission, or changes it if a mode is given.
+	A oneway mission only grafts SRC into DEST, which is the default. A bidirectional mission also moves DEST changes back to SRC on every graft, files changed by both sides are resolved by --strategy: ` + strings.Join(model.Strategies, ", ") + `. The strategy is kept if it's not given, and it's ask by default.`,
+	Args: cobra.RangeArgs(1, 2),
+	Run:  modeRun,
+}
+
+func init() {
+	rootCmd.AddCommand(modeCmd)
+	modeCmd.Flags().StringVar(&modeStrategy, "strategy", "", "strategy resolving files changed by both sides")
+}
+
+func modeRun(cmd *cobra.Command, args []string) {
+	mission := Store.Get(args[0])
+	if mission == nil {
+		log.Fatalf("Invalid mission name: %s ", args[0])
+	}
+
+	if len(args) == 1 && structured() {
+		doc := modeDoc{Mission: mission.Name, Mode: model.ModeOneway}
+		if mission.Bidirectional() {
+			doc.Mode, doc.Strategy = model.ModeBidirectional, mission.ConflictStrategy()
+		}
+		printDocument("Mode", doc)
+		return
+	}
+	if len(args) == 1 {
+		if !mission.Bidirectional() {
+			printText("%s", model.ModeOneway)
+			return
+		}
+		printText("%s (strategy: %s)", model.ModeBidirectional, mission.ConflictStrategy())
+		return
+	}
+
+	if err := mission.SetMode(args[1], modeStrategy); err != nil {
+		log.Fatal(err)
+	}
+	Store.Modified(true)
+}
@@ -0,0 +1,250 @@
+// Copyright © 2018 Mephis Pheies <mephistommm@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/MephistoMMM/grafter/model"
+	"github.com/MephistoMMM/grafter/plan"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// outputVersion is the version of structured documents, it's changed only
+// if documents are changed incompatibly.
+const outputVersion = "grafter/v1"
+
+// Formats of --output.
+const (
+	outputText = "text"
+	outputJSON = "json"
+	outputYAML = "yaml"
+)
+
+var outputFormat string
+
+// document is the envelope of structured output, kind tells the type of
+// data.
+type document struct {
+	APIVersion string      `json:"apiVersion" yaml:"apiVersion"`
+	Kind       string      `json:"kind" yaml:"kind"`
+	Data       interface{} `json:"data" yaml:"data"`
+}
+
+// structured reports whether documents are printed instead of text.
+func structured() bool {
+	return outputFormat != outputText
+}
+
+// checkOutput validates --output, logs are moved to stderr to keep stdout
+// parsable if documents are printed.
+func checkOutput() error {
+	switch outputFormat {
+	case outputText:
+		return nil
+	case outputJSON, outputYAML:
+		log.SetOutput(os.Stderr)
+		return nil
+	}
+	return fmt.Errorf("unknown output format %q, available: %s, %s, %s", outputFormat, outputText, outputJSON, outputYAML)
+}
+
+// printDocument prints data as document of kind in the output format.
+func printDocument(kind string, data interface{}) {
+	doc := document{APIVersion: outputVersion, Kind: kind, Data: data}
+
+	var (
+		out []byte
+		err error
+	)
+	if outputFormat == outputYAML {
+		out, err = yaml.Marshal(doc)
+	} else {
+		out, err = json.MarshalIndent(doc, "", "  ")
+		out = append(out, '\n')
+	}
+	if err != nil {
+		log.Fatalf("Failed to print %s: %v", kind, err)
+	}
+	os.Stdout.Write(out)
+}
+
+// printText prints a line of text output to stdout, nothing is printed if
+// documents are printed instead.
+func printText(format string, args ...interface{}) {
+	if structured() {
+		return
+	}
+	fmt.Fprintf(os.Stdout, format+"\n", args...)
+}
+
+// listDoc is a list of settings of mission.
+type listDoc struct {
+	Mission string      `json:"mission" yaml:"mission"`
+	Items   interface{} `json:"items" yaml:"items"`
+}
+
+// modeDoc is the mode of mission.
+type modeDoc struct {
+	Mission  string `json:"mission" yaml:"mission"`
+	Mode     string `json:"mode" yaml:"mode"`
+	Strategy string `json:"strategy,omitempty" yaml:"strategy,omitempty"`
+}
+
+// operationDoc is an operation of plan.
+type operationDoc struct {
+	Op        string   `json:"op" yaml:"op"`
+	Path      string   `json:"path" yaml:"path"`
+	From      string   `json:"from,omitempty" yaml:"from,omitempty"`
+	Src       string   `json:"src,omitempty" yaml:"src,omitempty"`
+	Reason    string   `json:"reason,omitempty" yaml:"reason,omitempty"`
+	Conflicts []string `json:"conflicts,omitempty" yaml:"conflicts,omitempty"`
+	// Diff is the patch of operation in git format, it's only set by diff.
+	Diff string `json:"diff,omitempty" yaml:"diff,omitempty"`
+}
+
+// planDoc is a plan of graft, or of upstream if Upstream is true.
+type planDoc struct {
+	Mission    string         `json:"mission" yaml:"mission"`
+	Dest       string         `json:"dest" yaml:"dest"`
+	Upstream   bool           `json:"upstream,omitempty" yaml:"upstream,omitempty"`
+	Summary    map[string]int `json:"summary" yaml:"summary"`
+	Operations []operationDoc `json:"operations" yaml:"operations"`
+	Errors     []string       `json:"errors,omitempty" yaml:"errors,omitempty"`
+}
+
+// newPlanDoc return the document of plan p of mission M, with the diff of
+// operations if diff is true.
+func newPlanDoc(M *model.Mission, p *plan.Plan, diff bool) planDoc {
+	doc := planDoc{
+		Mission:    M.Name,
+		Dest:       p.Dest,
+		Upstream:   p.Dest == M.Src,
+		Summary:    map[string]int{},
+		Operations: []operationDoc{},
+		Errors:     errorStrings(p.Report.Errors),
+	}
+	for _, op := range []plan.Op{plan.OpAdd, plan.OpModify, plan.OpMove, plan.OpDelete, plan.OpConflict} {
+		doc.Summary[op.String()] = 0
+	}
+	for op, n := range p.Count() {
+		doc.Summary[op.String()] = n
+	}
+
+	for _, o := range p.Operations {
+		od := operationDoc{
+			Op:        o.Op.String(),
+			Path:      o.Rel,
+			From:      o.From,
+			Src:       o.Src,
+			Reason:    o.Reason,
+			Conflicts: o.Conflicts,
+		}
+		if diff && o.Op != plan.OpConflict {
+			buf := &bytes.Buffer{}
+			if err := p.WriteOperationDiff(buf, o); err != nil {
+				doc.Errors = append(doc.Errors, fmt.Sprintf("Failed to diff %s: %v", o.Rel, err))
+			}
+			od.Diff = buf.String()
+		}
+		doc.Operations = append(doc.Operations, od)
+	}
+	return doc
+}
+
+// diffDoc is the result of diff.
+type diffDoc struct {
+	Mission string    `json:"mission" yaml:"mission"`
+	Plans   []planDoc `json:"plans" yaml:"plans"`
+	// Errors are errors of scanning.
+	Errors []string `json:"errors,omitempty" yaml:"errors,omitempty"`
+}
+
+// graftDoc is the result of graft or upstream.
+type graftDoc struct {
+	Mission   string    `json:"mission" yaml:"mission"`
+	DryRun    bool      `json:"dryRun,omitempty" yaml:"dryRun,omitempty"`
+	StartedAt time.Time `json:"startedAt" yaml:"startedAt"`
+	// DurationMs is the milliseconds of planning and applying.
+	DurationMs int64 `json:"durationMs" yaml:"durationMs"`
+	// Commit is the SRC commit recorded in history.
+	Commit string    `json:"commit,omitempty" yaml:"commit,omitempty"`
+	Plans  []planDoc `json:"plans" yaml:"plans"`
+	// Errors are errors of scanning, and the error aborting graft.
+	Errors    []string `json:"errors,omitempty" yaml:"errors,omitempty"`
+	Succeeded bool     `json:"succeeded" yaml:"succeeded"`
+}
+
+// newGraftDoc return the graftDoc of plans applied since start, errs are
+// errors of scanning or the error aborting graft, commit is the SRC commit
+// recorded.
+func newGraftDoc(M *model.Mission, start time.Time, plans []*plan.Plan, errs []error, commit string) graftDoc {
+	doc := graftDoc{
+		Mission:    M.Name,
+		StartedAt:  start,
+		DurationMs: int64(time.Since(start) / time.Millisecond),
+		Commit:     commit,
+		Plans:      []planDoc{},
+		Errors:     errorStrings(errs),
+		Succeeded:  len(errs) == 0,
+	}
+	for _, p := range plans {
+		if p == nil {
+			continue
+		}
+		doc.Plans = append(doc.Plans, newPlanDoc(M, p, false))
+		doc.Succeeded = doc.Succeeded && len(p.Report.Errors) == 0
+	}
+	return doc
+}
+
+// printGraft prints the Graft document if documents are printed, see
+// newGraftDoc.
+func printGraft(M *model.Mission, start time.Time, plans []*plan.Plan, errs []error, commit string) {
+	if structured() {
+		printDocument("Graft", newGraftDoc(M, start, plans, errs, commit))
+	}
+}
+
+// statusDoc is the drift of a mission.
+type statusDoc struct {
+	Mission string    `json:"mission" yaml:"mission"`
+	Drift   bool      `json:"drift" yaml:"drift"`
+	Error   string    `json:"error,omitempty" yaml:"error,omitempty"`
+	Plans   []planDoc `json:"plans" yaml:"plans"`
+	// Conflicted are DEST files planned as conflicts.
+	Conflicted []string `json:"conflicted" yaml:"conflicted"`
+	Ignored    []string `json:"ignored" yaml:"ignored"`
+}
+
+// errorStrings return messages of errs, nil errors are skipped.
+func errorStrings(errs []error) []string {
+	var msgs []string
+	for _, err := range errs {
+		if err != nil {
+			msgs = append(msgs, err.Error())
+		}
+	}
+	return msgs
+}
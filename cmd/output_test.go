@@ -0,0 +1,150 @@
+// Copyright © 2018 Mephis Pheies <mephistommm@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MephistoMMM/grafter/model"
+	"github.com/MephistoMMM/grafter/plan"
+	"github.com/MephistoMMM/grafter/util"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// captureDocument return what printDocument prints for kind and data in
+// format.
+func captureDocument(t *testing.T, format, kind string, data interface{}) []byte {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, saved := os.Stdout, outputFormat
+	os.Stdout, outputFormat = w, format
+	defer func() { os.Stdout, outputFormat = stdout, saved }()
+
+	printDocument(kind, data)
+	w.Close()
+	out, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+// testStatus return the status of a drifting mission, with a conflict.
+func testStatus() *missionStatus {
+	M := &model.Mission{Name: "test", Src: "/src", Dest: "/dest"}
+	p := &plan.Plan{
+		Mission: M.Name,
+		Dest:    M.Dest,
+		Operations: []*plan.Operation{
+			{Op: plan.OpAdd, Rel: "a", Dest: "/dest/a", Src: "/src/a"},
+			{Op: plan.OpConflict, Rel: "b", Dest: "/dest/b", Reason: "changed by both"},
+		},
+		Report: util.NewReport(),
+	}
+	p.Report.AddError(&plan.ConflictError{Rel: "b", Reason: "changed by both"})
+	return &missionStatus{M: M, Plans: []*plan.Plan{p}, Conflicted: []string{"/dest/b"}}
+}
+
+func TestPrintDocument(t *testing.T) {
+	docs := []statusDoc{newStatusDoc(testStatus())}
+	want := map[string]interface{}{
+		"apiVersion": "grafter/v1",
+		"kind":       "StatusList",
+		"data": []interface{}{map[string]interface{}{
+			"mission": "test",
+			"drift":   true,
+			"plans": []interface{}{map[string]interface{}{
+				"mission": "test",
+				"dest":    "/dest",
+				"summary": map[string]interface{}{
+					"add": 1.0, "modify": 0.0, "move": 0.0, "delete": 0.0, "conflict": 1.0,
+				},
+				"operations": []interface{}{
+					map[string]interface{}{"op": "add", "path": "a", "src": "/src/a"},
+					map[string]interface{}{"op": "conflict", "path": "b", "reason": "changed by both"},
+				},
+				"errors": []interface{}{"Conflict on b: changed by both"},
+			}},
+			"conflicted": []interface{}{"/dest/b"},
+			"ignored":    []interface{}{},
+		}},
+	}
+
+	var got map[string]interface{}
+	out := captureDocument(t, outputJSON, "StatusList", docs)
+	if err := json.Unmarshal(out, &got); err != nil {
+		t.Fatalf("invalid JSON %s: %v", out, err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("JSON document = %s", out)
+	}
+
+	// YAML keeps the same shape, numbers are decoded as int
+	out = captureDocument(t, outputYAML, "StatusList", docs)
+	var doc struct {
+		APIVersion string      `yaml:"apiVersion"`
+		Kind       string      `yaml:"kind"`
+		Data       []statusDoc `yaml:"data"`
+	}
+	if err := yaml.Unmarshal(out, &doc); err != nil {
+		t.Fatalf("invalid YAML %s: %v", out, err)
+	}
+	if doc.APIVersion != outputVersion || doc.Kind != "StatusList" || !reflect.DeepEqual(doc.Data, docs) {
+		t.Errorf("YAML document = %s", out)
+	}
+	if !strings.HasPrefix(string(out), "apiVersion: grafter/v1\nkind: StatusList\n") {
+		t.Errorf("YAML document starts with %q", out)
+	}
+}
+
+func TestGraftDoc(t *testing.T) {
+	ms := testStatus()
+	start := time.Now().Add(-time.Second)
+
+	doc := newGraftDoc(ms.M, start, ms.Plans, nil, "abc")
+	if doc.Succeeded {
+		t.Error("graft with errors in plans succeeded")
+	}
+	if doc.Commit != "abc" || doc.DurationMs < 1000 || len(doc.Plans) != 1 {
+		t.Errorf("graft document = %+v", doc)
+	}
+
+	doc = newGraftDoc(ms.M, start, []*plan.Plan{nil}, []error{nil, errors.New("aborted")}, "")
+	if doc.Succeeded || !reflect.DeepEqual(doc.Errors, []string{"aborted"}) || len(doc.Plans) != 0 {
+		t.Errorf("aborted graft document = %+v", doc)
+	}
+}
+
+func TestStatusDocFailed(t *testing.T) {
+	ms := &missionStatus{M: &model.Mission{Name: "test"}, Err: errors.New("no SRC")}
+	doc := newStatusDoc(ms)
+	if doc.Drift || doc.Error != "no SRC" || doc.Plans == nil || doc.Conflicted == nil || doc.Ignored == nil {
+		t.Errorf("status document of failed mission = %+v", doc)
+	}
+}
@@ -0,0 +1,348 @@
+// Copyright © 2018 Mephis Pheies <mephistommm@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/MephistoMMM/grafter/git"
+	"github.com/MephistoMMM/grafter/model"
+	"github.com/MephistoMMM/grafter/plan"
+	"github.com/MephistoMMM/grafter/util"
+	"github.com/spf13/cobra"
+	yaml "gopkg.in/yaml.v2"
+)
+
+var (
+	replayContinue bool
+	replayAbort    bool
+	replayTarget   string
+)
+
+// replayCmd represents the replay command
+var replayCmd = &cobra.Command{
+	Use:   "replay <mission_name> [<from>..<to>]",
+	Short: "Graft SRC commits into DEST one by one",
+	Long: `Replay command grafts every commit in the revision range of SRC into DEST as a separate commit, merges are skipped. Only files changed by the commit are planned, they are ignored, mapped and transformed like graft does. The DEST commit keeps the author, date and message of SRC commit with a trailer "Grafted-from: <commit>". Commits changing nothing in DEST are skipped.
+	All sources of mission must be in one git repository, and DEST must be in a git working tree without uncommitted changes. A mission with several destinations must select one by --target.
+
+	Replay stops when a DEST file is changed since the last graft or both sides changed the same keys of a merged file. Conflicting files are left for you to resolve in DEST, then run replay with --continue to commit them and go on, or with --abort to forget the rest of range. If applying a commit fails, the files it changed are left in DEST the same way.`,
+	Args: cobra.RangeArgs(1, 2),
+	Run:  replayRun,
+}
+
+func init() {
+	rootCmd.AddCommand(replayCmd)
+	replayCmd.Flags().BoolVar(&replayContinue, "continue", false, "commit resolved conflicts and continue the stopped replay")
+	replayCmd.Flags().BoolVar(&replayAbort, "abort", false, "forget the stopped replay, DEST is left as it is")
+	replayCmd.Flags().StringVar(&replayTarget, "target", "", "replay into this destination")
+}
+
+// replayState is the progress of a stopped replay.
+type replayState struct {
+	Dest string `yaml:"dest"`
+	// Pending is the commit whose conflicts are being resolved.
+	Pending string   `yaml:"pending,omitempty"`
+	Paths   []string `yaml:"paths,omitempty"`
+	// Conflicts are the conflicting operations of Pending, their baselines
+	// are recorded when the replay continues.
+	Conflicts []replayConflict `yaml:"conflicts,omitempty"`
+	// Commits are the commits left to replay.
+	Commits []string `yaml:"commits"`
+}
+
+// replayConflict is a conflicting operation kept in replay state.
+type replayConflict struct {
+	Rel string `yaml:"rel"`
+	Src string `yaml:"src,omitempty"`
+	// Data is the SRC content grafted into DEST.
+	Data string `yaml:"data,omitempty"`
+}
+
+func replayStatePath(M *model.Mission) string {
+	return filepath.Join(Store.StateDir(), M.Name, "replay.yaml")
+}
+
+func loadReplayState(M *model.Mission) (*replayState, error) {
+	path := replayStatePath(M)
+	if util.IsNotExist(path) {
+		return nil, nil
+	}
+	data, err := util.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	st := &replayState{}
+	return st, yaml.Unmarshal(data, st)
+}
+
+func saveReplayState(M *model.Mission, st *replayState) error {
+	data, err := yaml.Marshal(st)
+	if err != nil {
+		return err
+	}
+	path := replayStatePath(M)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return util.WriteFile(path, data)
+}
+
+func replayRun(cmd *cobra.Command, args []string) {
+	name := args[0]
+
+	M := Store.Get(name)
+	if M == nil {
+		log.Fatalf("Mission %s doesn't exist.", name)
+	}
+
+	st, err := loadReplayState(M)
+	if err != nil {
+		log.Fatalf("Failed to read replay state of %s: %v", name, err)
+	}
+	if replayAbort {
+		if st == nil {
+			log.Fatalf("No replay of %s is stopped.", name)
+		}
+		if err := os.Remove(replayStatePath(M)); err != nil {
+			log.Fatal(err)
+		}
+		left := len(st.Commits)
+		if st.Pending != "" {
+			left++
+		}
+		log.Infof("Replay of %s aborted, %d commit(s) left uncommitted.", name, left)
+		return
+	}
+
+	src, err := srcRepository(M)
+	if err != nil {
+		log.Fatalf("Can't replay %s: %v", name, err)
+	}
+
+	if replayContinue {
+		if st == nil {
+			log.Fatalf("No replay of %s is stopped.", name)
+		}
+	} else {
+		if st != nil {
+			log.Fatalf("Replay of %s is stopped, run it with --continue or --abort.", name)
+		}
+		if len(args) < 2 || !strings.Contains(args[1], "..") {
+			log.Fatalf("Replay needs a revision range like <from>..<to>.")
+		}
+		dest := selectDest(M, replayTarget)
+		commits, err := src.RevList(args[1])
+		if err != nil {
+			log.Fatal(err)
+		}
+		st = &replayState{Dest: dest, Commits: commits}
+	}
+
+	repo, err := git.Open(st.Dest)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if st.Pending != "" {
+		resolveConflicts(M, st)
+		replayCommit(M, src, repo, st.Pending, st.Paths)
+		st.Pending, st.Paths, st.Conflicts = "", nil, nil
+	} else if dirty, err := repo.Dirty(); err != nil || len(dirty) > 0 {
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Fatalf("DEST %s has uncommitted changes %v, commit them first.", st.Dest, dirty)
+	}
+
+	for len(st.Commits) > 0 {
+		c := st.Commits[0]
+		p, err := replayPlan(M, src, st.Dest, c)
+		if err != nil && p != nil {
+			// DEST is changed partly, the changes are committed by
+			// --continue like resolved conflicts
+			st.Commits = st.Commits[1:]
+			st.Pending, st.Paths = c, replayPaths(p)
+			stopReplay(M, st)
+			log.Fatalf("Replay %s stopped at %s: %v, fix the files in %s and run replay with --continue.",
+				name, c, err, st.Dest)
+		}
+		if err != nil {
+			stopReplay(M, st)
+			log.Fatalf("Replay %s stopped at %s: %v", name, c, err)
+		}
+		st.Commits = st.Commits[1:]
+		if p == nil {
+			continue
+		}
+
+		var conflicts []replayConflict
+		paths := replayPaths(p)
+		for _, o := range p.Operations {
+			if o.Op != plan.OpConflict {
+				continue
+			}
+			log.Warnf("Conflict: %s", o)
+			conflicts = append(conflicts, replayConflict{Rel: o.Rel, Src: o.Src, Data: string(o.Data)})
+		}
+		if len(conflicts) > 0 {
+			st.Pending, st.Paths, st.Conflicts = c, paths, conflicts
+			stopReplay(M, st)
+			log.Warnf("Replay %s stopped at %s with %d conflict(s), resolve them in %s and run replay with --continue.",
+				name, c, len(conflicts), st.Dest)
+			return
+		}
+		replayCommit(M, src, repo, c, paths)
+	}
+
+	if err := os.Remove(replayStatePath(M)); err != nil && !os.IsNotExist(err) {
+		log.Warnf("Failed to remove replay state of %s: %v", name, err)
+	}
+	log.Infof("Replay %s finished.", name)
+}
+
+// replayPlan plans and applies the changes of SRC commit c to dest. It
+// return nil if c changes nothing in dest. If applying fails, the plan is
+// returned with the error, since dest is changed.
+func replayPlan(M *model.Mission, src *git.Repo, dest, c string) (*plan.Plan, error) {
+	info, err := src.CommitInfo(c)
+	if err != nil {
+		return nil, err
+	}
+	parent := git.EmptyTree
+	if len(info.Parents) > 0 {
+		parent = info.Parents[0]
+	}
+
+	sc, err := plan.NewScan(M, plan.Options{
+		BaselineDir: Store.BaselineDir(),
+		SrcRev:      c,
+		Since:       parent,
+		DetectLocal: true,
+	})
+	defer sc.Close()
+	sc.Report.Log()
+	if err != nil {
+		return nil, err
+	}
+	if n := len(sc.Report.Errors); n > 0 {
+		return nil, fmt.Errorf("%d error(s) while reading SRC", n)
+	}
+
+	p, err := sc.Plan(dest)
+	if err != nil {
+		return nil, err
+	}
+	p.Report.Log()
+	if n := len(p.Report.Errors); n > 0 {
+		return nil, fmt.Errorf("%d error(s) while planning", n)
+	}
+	if len(p.Operations) == 0 {
+		log.Infof("Skip %s: nothing changed in DEST.", c)
+		return nil, nil
+	}
+
+	plan.Apply(p)
+	p.Report.Log()
+	if n := len(p.Report.Errors); n > 0 {
+		return p, fmt.Errorf("%d error(s) while applying", n)
+	}
+	log.Infof("Replay %s -> %s: %s.", c, dest, p.Summary())
+	return p, nil
+}
+
+// replayPaths return DEST paths changed by operations of p.
+func replayPaths(p *plan.Plan) []string {
+	paths := make([]string, 0, len(p.Operations))
+	for _, o := range p.Operations {
+		paths = append(paths, filepath.FromSlash(o.Rel))
+		if o.From != "" {
+			paths = append(paths, filepath.FromSlash(o.From))
+		}
+	}
+	return paths
+}
+
+// resolveConflicts records baselines of the conflicts of st resolved by hand,
+// so they are not reported as changes of DEST again.
+func resolveConflicts(M *model.Mission, st *replayState) {
+	p := &plan.Plan{
+		Dest:     st.Dest,
+		Baseline: model.NewBaseline(Store.BaselineDir(), M.Name, st.Dest),
+	}
+	for _, c := range st.Conflicts {
+		o := &plan.Operation{
+			Op:   plan.OpConflict,
+			Rel:  c.Rel,
+			Dest: filepath.Join(st.Dest, filepath.FromSlash(c.Rel)),
+			Src:  c.Src,
+		}
+		if c.Src != "" {
+			o.Data = []byte(c.Data)
+		}
+		if err := p.Resolve(o); err != nil {
+			log.Warnf("Failed to record baseline of %s: %v", c.Rel, err)
+		}
+	}
+}
+
+// replayCommit commits paths in repo with author, date and message of SRC
+// commit c, and records c in the history of M.
+func replayCommit(M *model.Mission, src, repo *git.Repo, c string, paths []string) {
+	info, err := src.CommitInfo(c)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	changed, err := repo.Changed(paths)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(changed) > 0 {
+		message, err := repo.AddTrailer(info.Message, "Grafted-from", info.ID)
+		if err != nil {
+			log.Fatal(err)
+		}
+		id, err := repo.Commit(paths, message, &info.Author)
+		if err != nil {
+			log.Fatalf("Failed to commit %s in %s: %v", c, repo.Dir(), err)
+		}
+		log.Infof("Commit %s in %s.", id, repo.Dir())
+	} else {
+		log.Infof("Skip %s: nothing to commit in %s.", c, repo.Dir())
+	}
+
+	M.AddHistory(model.Graft{Time: time.Now(), Rev: c, Commit: info.ID})
+	Store.Modified(true)
+}
+
+// stopReplay saves state st and the mission store, replay is going to exit.
+func stopReplay(M *model.Mission, st *replayState) {
+	if err := saveReplayState(M, st); err != nil {
+		log.Warnf("Failed to save replay state of %s: %v", M.Name, err)
+	}
+	// history of replayed commits is kept even if replay exits by failure
+	if err := Store.Store(Store.Path()); err != nil {
+		log.Warnf("Failed to save missions: %v", err)
+	}
+}
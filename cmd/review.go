@@ -0,0 +1,148 @@
+// Copyright © 2018 Mephis Pheies <mephistommm@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/MephistoMMM/grafter/model"
+	"github.com/MephistoMMM/grafter/plan"
+)
+
+// reviewPlan steps through operations of plan p and keeps the accepted ones
+// only. Ignore and protect rules added on the way are saved into M.
+func reviewPlan(M *model.Mission, p *plan.Plan) {
+	var accepted []*plan.Operation
+	for i, o := range p.Operations {
+		if o.Op == plan.OpConflict {
+			// conflicts are never applied
+			accepted = append(accepted, o)
+			continue
+		}
+
+		fmt.Fprintf(os.Stderr, "\n[%d/%d] %s: %s\n", i+1, len(p.Operations), p.Dest, o)
+		if o.Op != plan.OpDelete {
+			if err := p.WriteOperationDiff(os.Stdout, o); err != nil {
+				log.Error(err)
+			}
+		}
+		if reviewOperation(M, o) {
+			accepted = append(accepted, o)
+		}
+	}
+	p.Operations = accepted
+}
+
+// reviewOperation prompts the user to accept operation o, it reports whether
+// o is accepted.
+func reviewOperation(M *model.Mission, o *plan.Operation) bool {
+	options := "[a]ccept, [s]kip"
+	if o.Src != "" {
+		options += ", [i]gnore SRC file"
+	}
+	if o.Op == plan.OpDelete || o.Op == plan.OpMove {
+		options += ", [p]rotect DEST file"
+	}
+
+	for {
+		answer, err := prompt(fmt.Sprintf("%s? ", options))
+		answer = strings.ToLower(answer)
+		switch {
+		case answer == "a" || answer == "accept":
+			return true
+		case answer == "s" || answer == "skip":
+			return false
+		case (answer == "i" || answer == "ignore") && o.Src != "":
+			rel, err := filepath.Rel(o.Source, o.Src)
+			if err != nil {
+				log.Error(err)
+				continue
+			}
+			if re := promptRule(rel); re != "" {
+				addSourceIgnore(M, o.Source, re)
+				log.Infof("Ignore %s of %s.", re, o.Source)
+				return false
+			}
+		case (answer == "p" || answer == "protect") && (o.Op == plan.OpDelete || o.Op == plan.OpMove):
+			rel := o.Rel
+			if o.Op == plan.OpMove {
+				rel = o.From
+			}
+			if re := promptRule(rel); re != "" {
+				M.AddIgnore(re)
+				Store.Modified(true)
+				log.Infof("Protect %s of DEST.", re)
+				return false
+			}
+		}
+		if err != nil {
+			// no more answer, nothing is changed without asking
+			return false
+		}
+	}
+}
+
+// promptRule asks the regexp of ignore rule, it matches exactly rel by
+// default. It return an empty string if the regexp is invalid.
+func promptRule(rel string) string {
+	re := exactRule(filepath.ToSlash(rel))
+	answer, _ := prompt(fmt.Sprintf("Regexp [%s]: ", re))
+	if answer != "" {
+		re = answer
+	}
+	if _, err := regexp.Compile(re); err != nil {
+		log.Errorf("Invalid regexp %s: %v", re, err)
+		return ""
+	}
+	return re
+}
+
+// addSourceIgnore append ignore regexp re to the source root of M.
+func addSourceIgnore(M *model.Mission, root, re string) {
+	if root == M.Src {
+		M.AddIgnore(re)
+	}
+	for i := range M.Sources {
+		if M.Sources[i].Path == root {
+			M.Sources[i].AddIgnore(re)
+		}
+	}
+	Store.Modified(true)
+}
+
+// summarizeReview prints the accepted changes of plans.
+func summarizeReview(plans []*plan.Plan) {
+	for _, p := range plans {
+		var lines []string
+		for _, o := range p.Operations {
+			if o.Op != plan.OpConflict {
+				lines = append(lines, "\t"+o.String())
+			}
+		}
+		printText("Accepted %d change(s) in %s:", len(lines), p.Dest)
+		for _, line := range lines {
+			printText("%s", line)
+		}
+	}
+}
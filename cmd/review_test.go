@@ -0,0 +1,94 @@
+// Copyright © 2018 Mephis Pheies <mephistommm@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package cmd
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+
+	"github.com/MephistoMMM/grafter/model"
+	"github.com/MephistoMMM/grafter/plan"
+)
+
+// answer makes prompts read answers from text.
+func answer(text string) {
+	stdin = bufio.NewReader(strings.NewReader(text))
+}
+
+func TestReviewPlan(t *testing.T) {
+	Store = &model.MissionStore{}
+	tests := []struct {
+		name    string
+		answers string
+		// accepted are Rel of operations kept in plan
+		accepted []string
+		ignore   []string
+	}{
+		{
+			name:     "accept and skip",
+			answers:  "a\nskip\naccept\n",
+			accepted: []string{"a", "b", "dir/d"},
+		},
+		{
+			name:     "unknown answers are asked again",
+			answers:  "x\ni\nA\n",
+			accepted: []string{"a", "b"},
+		},
+		{
+			name:     "protect DEST file",
+			answers:  "p\n\ns\np\n^dir/\n",
+			accepted: []string{"b"},
+			ignore:   []string{"^a$", "^dir/"},
+		},
+		{
+			name:     "invalid rule is asked again",
+			answers:  "p\n(\na\n",
+			accepted: []string{"a", "b"},
+		},
+		{
+			name:     "nothing is accepted without answers",
+			answers:  "a\n",
+			accepted: []string{"a", "b"},
+		},
+	}
+	for _, tt := range tests {
+		M := &model.Mission{Name: "test"}
+		p := &plan.Plan{Dest: "/dest", Operations: []*plan.Operation{
+			{Op: plan.OpDelete, Rel: "a", Dest: "/dest/a"},
+			{Op: plan.OpConflict, Rel: "b", Dest: "/dest/b"},
+			{Op: plan.OpDelete, Rel: "c", Dest: "/dest/c"},
+			{Op: plan.OpDelete, Rel: "dir/d", Dest: "/dest/dir/d"},
+		}}
+		answer(tt.answers)
+		reviewPlan(M, p)
+
+		var accepted []string
+		for _, o := range p.Operations {
+			accepted = append(accepted, o.Rel)
+		}
+		if strings.Join(accepted, " ") != strings.Join(tt.accepted, " ") {
+			t.Errorf("%s: accepted %v, want %v", tt.name, accepted, tt.accepted)
+		}
+		if strings.Join(M.Ignore, " ") != strings.Join(tt.ignore, " ") {
+			t.Errorf("%s: ignore %v, want %v", tt.name, M.Ignore, tt.ignore)
+		}
+	}
+}
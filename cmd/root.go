@@ -48,6 +48,9 @@ Cobra is a CLI library for Go that empowers applications.
 This application is a tool to generate the needed files
 to quickly create a Cobra application.`,
 	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		if err := checkOutput(); err != nil {
+			log.Fatal(err)
+		}
 		// init global mission Store
 		missionStore, err := model.NewMissionStore(dotGrafterFile)
 		if err != nil {
@@ -82,4 +85,6 @@ func init() {
 	rootCmd.PersistentFlags().StringVar(&dotGrafterFile, "store",
 		path.Join(util.HomeDir(), ".grafter/grafter"),
 		"mission store file")
+	rootCmd.PersistentFlags().StringVarP(&outputFormat, "output", "o", outputText,
+		"output format of listings, plans, diffs and results: text, json or yaml")
 }
@@ -0,0 +1,72 @@
+// Copyright © 2018 Mephis Pheies <mephistommm@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/MephistoMMM/grafter/model"
+	"github.com/MephistoMMM/grafter/util"
+	"github.com/spf13/cobra"
+)
+
+var sourceIgnore []string
+
+// sourceAddCmd represents the source add command
+var sourceAddCmd = &cobra.Command{
+	Use:   "add <mission_name> <SRC> <sub>",
+	Short: "Add a source to mission",
+	Long:  `Add command adds a source to sources field of mission, files of SRC will be grafted into sub directory of DEST. Ignore regexps of the source are matched against paths relative to SRC.`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if err := cobra.ExactArgs(3)(cmd, args); err != nil {
+			return err
+		}
+		if !util.IsDir(args[1]) {
+			return fmt.Errorf("src directory is not exist: %s", args[1])
+		}
+		return nil
+	},
+	Run: sourceAddRun,
+}
+
+func init() {
+	sourceCmd.AddCommand(sourceAddCmd)
+	sourceAddCmd.Flags().StringSliceVar(&sourceIgnore, "ignore", nil, "ignore regexps of the source")
+}
+
+func sourceAddRun(cmd *cobra.Command, args []string) {
+	mission := Store.Get(args[0])
+	if mission == nil {
+		log.Fatalf("Invalid mission name: %s ", args[0])
+	}
+
+	srcDir, _ := filepath.Abs(args[1])
+	ok := mission.AddSource(model.Source{
+		Path:   srcDir,
+		Sub:    filepath.ToSlash(filepath.Clean(args[2])),
+		Ignore: sourceIgnore,
+	})
+	if !ok {
+		log.Fatalf("Source %s already exists.", srcDir)
+	}
+	Store.Modified(true)
+}
@@ -0,0 +1,54 @@
+// Copyright © 2018 Mephis Pheies <mephistommm@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"github.com/MephistoMMM/grafter/model"
+	"github.com/spf13/cobra"
+)
+
+// sourceListallCmd represents the source listall command
+var sourceListallCmd = &cobra.Command{
+	Use:   "listall <mission_name>",
+	Short: "List all extra sources",
+	Long:  `Listall command lists all values of sources field in mission configuration.`,
+	Args:  cobra.ExactArgs(1),
+	Run:   sourceListallRun,
+}
+
+func init() {
+	sourceCmd.AddCommand(sourceListallCmd)
+}
+
+func sourceListallRun(cmd *cobra.Command, args []string) {
+	mission := Store.Get(args[0])
+	if mission == nil {
+		log.Fatalf("Invalid mission name: %s ", args[0])
+	}
+	if structured() {
+		printDocument("SourceList", listDoc{Mission: mission.Name, Items: append([]model.Source{}, mission.Sources...)})
+		return
+	}
+
+	for i, v := range mission.Sources {
+		log.Printf("%d. %s", i, v)
+	}
+}
@@ -0,0 +1,297 @@
+// Copyright © 2018 Mephis Pheies <mephistommm@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/MephistoMMM/grafter/model"
+	"github.com/MephistoMMM/grafter/plan"
+	"github.com/MephistoMMM/grafter/util"
+	"github.com/spf13/cobra"
+)
+
+var statusAll bool
+
+// statusCmd represents the status command
+var statusCmd = &cobra.Command{
+	Use:   "status [mission_name...]",
+	Short: "Show drift between SRC and DEST of missions",
+	Long: `Status command plans missions like 'grafter diff' does without changing anything, and prints the numbers and lists of new, modified, moved, deleted and conflicted files of every destination, and SRC files ignored by the ignore rules. Changes of bidirectional missions include the DEST changes moving back to SRC, files changed by both sides are planned by the strategy of mission, or listed as conflicts if it's ask.
+	--output json or yaml prints a StatusList document. It exits with 1 if any mission drifts, conflicts are drift too, or with 2 if any mission fails to be planned, so it could be used in scripts. --all checks every mission, missions are checked in parallel.`,
+	Run: statusRun,
+}
+
+func init() {
+	rootCmd.AddCommand(statusCmd)
+	statusCmd.Flags().BoolVar(&statusAll, "all", false, "check all missions")
+}
+
+// Exit codes of status.
+const (
+	statusDrift  = 1
+	statusFailed = 2
+)
+
+// missionStatus is the drift of a mission.
+type missionStatus struct {
+	M       *model.Mission
+	Plans   []*plan.Plan
+	Ignored []string
+	// Conflicted lists DEST files planned as conflicts.
+	Conflicted []string
+	Err        error
+}
+
+// Drift reports whether any change is pending.
+func (ms *missionStatus) Drift() bool {
+	for _, p := range ms.Plans {
+		if len(p.Operations) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func statusRun(cmd *cobra.Command, args []string) {
+	var missions []*model.Mission
+	switch {
+	case statusAll:
+		for i := range Store.Missions {
+			missions = append(missions, &Store.Missions[i])
+		}
+	case len(args) == 0:
+		log.Fatalln("Select missions to check, or check all of them by --all.")
+	default:
+		for _, name := range args {
+			M := Store.Get(name)
+			if M == nil {
+				log.Fatalf("Mission %s doesn't exist.", name)
+			}
+			missions = append(missions, M)
+		}
+	}
+
+	statuses := make([]*missionStatus, len(missions))
+	var wg sync.WaitGroup
+	for i := range missions {
+		wg.Add(1)
+		go func(i int) {
+			statuses[i] = checkStatus(missions[i])
+			wg.Done()
+		}(i)
+	}
+	wg.Wait()
+
+	docs := []statusDoc{}
+	for _, ms := range statuses {
+		if structured() {
+			docs = append(docs, newStatusDoc(ms))
+		} else {
+			printStatus(ms)
+		}
+	}
+	if structured() {
+		printDocument("StatusList", docs)
+	}
+	if code := statusExit(statuses); code != 0 {
+		os.Exit(code)
+	}
+}
+
+// statusExit logs the numbers of drifting and failed missions, and return the
+// exit code of statuses.
+func statusExit(statuses []*missionStatus) int {
+	drift, failed := 0, 0
+	for _, ms := range statuses {
+		switch {
+		case ms.Err != nil:
+			failed++
+		case ms.Drift():
+			drift++
+		}
+	}
+	if drift > 0 || failed > 0 {
+		log.Errorf("%d mission(s) drift, %d mission(s) failed.", drift, failed)
+	}
+	switch {
+	case failed > 0:
+		return statusFailed
+	case drift > 0:
+		return statusDrift
+	}
+	return 0
+}
+
+// checkStatus plans mission M and collects its ignored SRC files.
+func checkStatus(M *model.Mission) *missionStatus {
+	ms := &missionStatus{M: M}
+	if ms.Plans, ms.Err = pendingPlans(M); ms.Err != nil {
+		return ms
+	}
+	if ms.Err = planErrors(ms.Plans); ms.Err != nil {
+		return ms
+	}
+	for _, p := range ms.Plans {
+		for _, o := range p.Operations {
+			if o.Op == plan.OpConflict {
+				ms.Conflicted = append(ms.Conflicted, o.Dest)
+			}
+		}
+	}
+	sort.Strings(ms.Conflicted)
+	ms.Ignored, ms.Err = ignoredPaths(M)
+	return ms
+}
+
+// planErrors return an error describing errors of plans, conflicts are drift
+// instead of errors and skipped.
+func planErrors(plans []*plan.Plan) error {
+	for _, p := range plans {
+		var errs []error
+		for _, err := range p.Report.Errors {
+			if !plan.IsConflict(err) {
+				errs = append(errs, err)
+			}
+		}
+		if len(errs) > 0 {
+			return fmt.Errorf("%d error(s) while planning %s, the first is: %v", len(errs), p.Dest, errs[0])
+		}
+	}
+	return nil
+}
+
+// pendingPlans plans mission M without applying like diff does, plans of
+// bidirectional missions include the reverse plans. Errors of scanning are
+// added into reports of plans.
+func pendingPlans(M *model.Mission) ([]*plan.Plan, error) {
+	if M.Bidirectional() {
+		return syncPlans(M)
+	}
+	sc, plans, err := plan.BuildAll(M, plan.Options{BaselineDir: Store.BaselineDir()})
+	sc.Close()
+	addScanErrors(sc, plans...)
+	return plans, err
+}
+
+// ignoredPaths return SRC files and directories of M ignored by the ignore
+// rules, files under ignored directories are not listed. Paths of the primary
+// source are relative to SRC, others are absolute.
+func ignoredPaths(M *model.Mission) ([]string, error) {
+	var ignored []string
+	for _, root := range M.Roots() {
+		checker, err := plan.IgnoreChain(M, root.Path, root.Ignore)
+		if err != nil {
+			return nil, err
+		}
+		err = filepath.Walk(root.Path, func(p string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() && info.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			skip, err := util.Check(checker, p, info)
+			if err != nil && util.IsAbort(err) {
+				return err
+			}
+			if !skip {
+				return nil
+			}
+
+			name := p
+			if root.Path == M.Src {
+				if name, err = filepath.Rel(M.Src, p); err != nil {
+					return err
+				}
+				name = filepath.ToSlash(name)
+			}
+			if info.IsDir() {
+				ignored = append(ignored, name+"/")
+				return filepath.SkipDir
+			}
+			ignored = append(ignored, name)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(ignored)
+	return ignored, nil
+}
+
+// newStatusDoc return the document of drift of mission.
+func newStatusDoc(ms *missionStatus) statusDoc {
+	doc := statusDoc{
+		Mission:    ms.M.Name,
+		Drift:      ms.Err == nil && ms.Drift(),
+		Plans:      []planDoc{},
+		Ignored:    append([]string{}, ms.Ignored...),
+		Conflicted: append([]string{}, ms.Conflicted...),
+	}
+	if ms.Err != nil {
+		doc.Error = ms.Err.Error()
+	}
+	for _, p := range ms.Plans {
+		if p != nil {
+			doc.Plans = append(doc.Plans, newPlanDoc(ms.M, p, false))
+		}
+	}
+	return doc
+}
+
+// printStatus prints the drift of mission.
+func printStatus(ms *missionStatus) {
+	switch {
+	case ms.Err != nil:
+		printText("Mission %s: failed, %v", ms.M.Name, ms.Err)
+		return
+	case ms.Drift():
+		printText("Mission %s: drift", ms.M.Name)
+	default:
+		printText("Mission %s: in sync", ms.M.Name)
+	}
+
+	for _, p := range ms.Plans {
+		count := p.Count()
+		side := "DEST"
+		if p.Dest == ms.M.Src {
+			side = "SRC (upstream)"
+		}
+		printText("  %s %s: %d new, %d modified, %d moved, %d deleted, %d conflicted", side, p.Dest,
+			count[plan.OpAdd], count[plan.OpModify], count[plan.OpMove], count[plan.OpDelete], count[plan.OpConflict])
+		for _, o := range p.Operations {
+			printText("    %s", o)
+		}
+	}
+	printText("  %d conflicted", len(ms.Conflicted))
+	for _, path := range ms.Conflicted {
+		printText("    %s", path)
+	}
+	printText("  %d ignored", len(ms.Ignored))
+	for _, rel := range ms.Ignored {
+		printText("    %s", rel)
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright © 2018 Mephis Pheies <mephistommm@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/MephistoMMM/grafter/model"
+)
+
+func TestCheckStatus(t *testing.T) {
+	dir, err := ioutil.TempDir("", "grafter-status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if Store, err = model.NewMissionStore(filepath.Join(dir, "missions.yml")); err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]string{
+		"synced/src/a.txt":     "a\n",
+		"synced/dest/a.txt":    "a\n",
+		"drift/src/a.txt":      "a\n",
+		"drift/dest/b.txt":     "b\n",
+		"conflict/src/a.txt":   "a\n",
+		"conflict/extra/a.txt": "other a\n",
+		"conflict/dest/b.txt":  "b\n",
+	}
+	for rel, data := range files {
+		path := filepath.Join(dir, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mission := func(name string) *model.Mission {
+		return &model.Mission{
+			Name: name,
+			Src:  filepath.Join(dir, name, "src"),
+			Dest: filepath.Join(dir, name, "dest"),
+		}
+	}
+	synced, drift, conflict, failed := mission("synced"), mission("drift"), mission("conflict"), mission("failed")
+	conflict.Sources = []model.Source{{Path: filepath.Join(dir, "conflict", "extra")}}
+
+	tests := []struct {
+		M          *model.Mission
+		drift      bool
+		failed     bool
+		conflicted []string
+	}{
+		{M: synced},
+		{M: drift, drift: true},
+		{M: conflict, drift: true, conflicted: []string{filepath.Join(dir, "conflict", "dest", "a.txt")}},
+		{M: failed, failed: true},
+	}
+	statuses := map[string]*missionStatus{}
+	for _, tt := range tests {
+		ms := checkStatus(tt.M)
+		statuses[tt.M.Name] = ms
+		if (ms.Err != nil) != tt.failed {
+			t.Errorf("%s: err = %v, want failed %v", tt.M.Name, ms.Err, tt.failed)
+			continue
+		}
+		if tt.failed {
+			continue
+		}
+		if ms.Drift() != tt.drift {
+			t.Errorf("%s: drift = %v, want %v", tt.M.Name, ms.Drift(), tt.drift)
+		}
+		if !reflect.DeepEqual(ms.Conflicted, tt.conflicted) {
+			t.Errorf("%s: conflicted = %v, want %v", tt.M.Name, ms.Conflicted, tt.conflicted)
+		}
+	}
+
+	for _, tt := range []struct {
+		names []string
+		code  int
+	}{
+		{nil, 0},
+		{[]string{"synced"}, 0},
+		{[]string{"synced", "drift"}, statusDrift},
+		{[]string{"conflict"}, statusDrift},
+		{[]string{"drift", "failed", "synced"}, statusFailed},
+	} {
+		var list []*missionStatus
+		for _, name := range tt.names {
+			list = append(list, statuses[name])
+		}
+		if code := statusExit(list); code != tt.code {
+			t.Errorf("statusExit(%v) = %d, want %d", tt.names, code, tt.code)
+		}
+	}
+}
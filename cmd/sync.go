@@ -0,0 +1,180 @@
+// Copyright © 2018 Mephis Pheies <mephistommm@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/MephistoMMM/grafter/git"
+	"github.com/MephistoMMM/grafter/model"
+	"github.com/MephistoMMM/grafter/plan"
+)
+
+// syncGraft grafts bidirectional mission M, changes of SRC are grafted into
+// every destination and changes of DEST are written back into SRC. Files
+// changed by both sides are resolved by the strategy of mission.
+// Destinations are synced one by one, since each of them could change SRC.
+// start is the time graft started.
+func syncGraft(M *model.Mission, start time.Time, repos []*git.Repo, message *template.Template) {
+	resolve, err := plan.NewResolver(M.ConflictStrategy(), askResolution)
+	if err != nil {
+		log.Fatalf("Graft %s aborted: %v", M.Name, err)
+	}
+
+	log.Infof("Do Sync For %s", M.Name)
+	var (
+		fwds, plans []*plan.Plan
+		errs        []error
+	)
+	for _, dest := range M.Dests() {
+		sc, err := plan.NewScan(M, plan.Options{BaselineDir: Store.BaselineDir()})
+		sc.Report.Log()
+		errs = append(errs, sc.Report.Errors...)
+		if err == nil && sc.Report.Failed() {
+			err = fmt.Errorf("%d error(s) while walking sources, %s is not synced", len(sc.Report.Errors), dest)
+		}
+		if err != nil {
+			sc.Close()
+			printGraft(M, start, plans, append(errs, err), "")
+			log.Fatalf("Graft %s aborted: %v", M.Name, err)
+		}
+		fwd, rev, err := sc.Sync(dest, resolve)
+		sc.Close()
+		if err != nil {
+			printGraft(M, start, plans, append(errs, err), "")
+			log.Fatalf("Graft %s aborted: %v", M.Name, err)
+		}
+
+		plan.Apply(fwd)
+		plan.Apply(rev)
+		fwd.Report.Log()
+		rev.Report.Log()
+		log.Infof("Graft %s -> %s: %s.", M.Name, dest, fwd.Summary())
+		log.Infof("Upstream %s <- %s: %s.", M.Name, dest, rev.Summary())
+		fwds = append(fwds, fwd)
+		plans = append(plans, fwd, rev)
+	}
+	failed := len(errs)
+	for _, p := range plans {
+		failed += len(p.Report.Errors)
+	}
+	if failed > 0 {
+		printGraft(M, start, plans, errs, "")
+		log.Fatalf("Graft %s finished with %d error(s).", M.Name, failed)
+	}
+
+	commit := recordGraft(M, "", "")
+	for i, p := range fwds {
+		if repos != nil {
+			commitPlan(M, repos[i], p, message, commit)
+		}
+	}
+	printGraft(M, start, plans, nil, commit)
+}
+
+// syncPlans plans bidirectional mission M without applying, plans are in
+// pairs of forward and reverse for every destination. Files to ask are left
+// as conflicts, errors of scanning are added into reports of plans.
+func syncPlans(M *model.Mission) ([]*plan.Plan, error) {
+	resolve, err := plan.NewResolver(M.ConflictStrategy(), func(*plan.Divergence) plan.Resolution {
+		return plan.ResolveNone
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var plans []*plan.Plan
+	for _, dest := range M.Dests() {
+		sc, err := plan.NewScan(M, plan.Options{BaselineDir: Store.BaselineDir()})
+		if err != nil {
+			sc.Close()
+			return plans, err
+		}
+		fwd, rev, err := sc.Sync(dest, resolve)
+		sc.Close()
+		if err != nil {
+			return plans, err
+		}
+		addScanErrors(sc, fwd, rev)
+		plans = append(plans, fwd, rev)
+	}
+	return plans, nil
+}
+
+// addScanErrors adds errors of scan sc into reports of plans.
+func addScanErrors(sc *plan.Scan, plans ...*plan.Plan) {
+	for _, p := range plans {
+		if p == nil {
+			continue
+		}
+		for _, err := range sc.Report.Errors {
+			p.Report.AddError(err)
+		}
+	}
+}
+
+// diffResolver return the Resolver of strategy of M without prompting, files
+// to ask are left as conflicts.
+func diffResolver(M *model.Mission) plan.Resolver {
+	resolve, err := plan.NewResolver(M.ConflictStrategy(), func(*plan.Divergence) plan.Resolution {
+		return plan.ResolveNone
+	})
+	if err != nil {
+		log.Fatalf("Diff %s aborted: %v", M.Name, err)
+	}
+	return resolve
+}
+
+// stdin reads answers of prompts.
+var stdin = bufio.NewReader(os.Stdin)
+
+// prompt prints question and return the trimmed answer, err is set if there
+// is no more input.
+func prompt(question string) (string, error) {
+	fmt.Fprint(os.Stderr, question)
+	answer, err := stdin.ReadString('\n')
+	return strings.TrimSpace(answer), err
+}
+
+// askResolution prompts the user to resolve a file changed by both sides.
+func askResolution(d *plan.Divergence) plan.Resolution {
+	fmt.Fprintf(os.Stderr, "%s is changed by both SRC and DEST since the last graft.\n", d.Rel)
+	for {
+		answer, err := prompt("Keep [s]rc, [d]est, [m]erge or leave as [c]onflict? ")
+		switch strings.ToLower(answer) {
+		case "s", "src":
+			return plan.ResolveSrc
+		case "d", "dest":
+			return plan.ResolveDest
+		case "m", "merge":
+			return plan.ResolveMerge
+		case "c", "conflict":
+			return plan.ResolveNone
+		}
+		if err != nil {
+			return plan.ResolveNone
+		}
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright © 2018 Mephis Pheies <mephistommm@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"path/filepath"
+
+	"github.com/MephistoMMM/grafter/model"
+	"github.com/spf13/cobra"
+)
+
+// targetCmd represents the target command
+var targetCmd = &cobra.Command{
+	Use:   "target",
+	Short: "Manage extra destinations of missions",
+	Long: `Target command provides some subcommands to manage the value of targets field of mission's configuration, including add, remove and list destinations.
+	Each target is grafted as the DEST of mission in the same run.`,
+	Args: cobra.NoArgs,
+}
+
+func init() {
+	rootCmd.AddCommand(targetCmd)
+}
+
+// selectDest return the destination of M which is target, target could be
+// empty if M has only one destination.
+func selectDest(M *model.Mission, target string) string {
+	dests := M.Dests()
+	if target == "" {
+		if len(dests) > 1 {
+			log.Fatalf("Mission %s has %d destinations, select one by --target.", M.Name, len(dests))
+		}
+		return dests[0]
+	}
+
+	abs, err := filepath.Abs(target)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, dest := range dests {
+		if dest == abs {
+			return dest
+		}
+	}
+	log.Fatalf("%s is not a destination of mission %s.", target, M.Name)
+	return ""
+}
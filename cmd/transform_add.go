@@ -0,0 +1,86 @@
+// Copyright © 2018 Mephis Pheies <mephistommm@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/MephistoMMM/grafter/model"
+	"github.com/MephistoMMM/grafter/transform"
+	"github.com/spf13/cobra"
+)
+
+var (
+	transformFiles   []string
+	transformFrom    string
+	transformTo      string
+	transformOptions []string
+)
+
+// transformAddCmd represents the transform add command
+var transformAddCmd = &cobra.Command{
+	Use:   "add <mission_name> <type>",
+	Short: "Add a transform to mission",
+	Long: fmt.Sprintf(`Add command appends a transform to transforms field of mission. Available types: %s.
+	--files limits the transform to files matched by shell patterns, a pattern without slash is matched against the base name, e.g. "*.go".`,
+		strings.Join(transform.Types(), ", ")),
+	Args: cobra.ExactArgs(2),
+	Run:  transformAddRun,
+}
+
+func init() {
+	transformCmd.AddCommand(transformAddCmd)
+	transformAddCmd.Flags().StringSliceVar(&transformFiles, "files", nil, "shell patterns of files to transform")
+	transformAddCmd.Flags().StringVar(&transformFrom, "from", "", "text or regexp to replace")
+	transformAddCmd.Flags().StringVar(&transformTo, "to", "", "replacement text or template")
+	transformAddCmd.Flags().StringArrayVar(&transformOptions, "option", nil, "other options of transform, in form of key=value")
+}
+
+func transformAddRun(cmd *cobra.Command, args []string) {
+	mission := Store.Get(args[0])
+	if mission == nil {
+		log.Fatalf("Invalid mission name: %s ", args[0])
+	}
+
+	t := model.Transform{
+		Type:  args[1],
+		Files: transformFiles,
+		From:  transformFrom,
+		To:    transformTo,
+	}
+	for _, opt := range transformOptions {
+		kv := strings.SplitN(opt, "=", 2)
+		if len(kv) != 2 {
+			log.Fatalf("Invalid option %s, it should be key=value.", opt)
+		}
+		if t.Options == nil {
+			t.Options = map[string]string{}
+		}
+		t.Options[kv[0]] = kv[1]
+	}
+
+	mission.AddTransform(t)
+	if _, err := transform.NewChain(mission); err != nil {
+		log.Fatal(err)
+	}
+	Store.Modified(true)
+}
@@ -0,0 +1,650 @@
+// Copyright © 2018 Mephis Pheies <mephistommm@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/MephistoMMM/grafter/model"
+	"github.com/MephistoMMM/grafter/plan"
+	"github.com/MephistoMMM/grafter/util"
+	"github.com/spf13/cobra"
+)
+
+// uiCmd represents the ui command
+var uiCmd = &cobra.Command{
+	Use:   "ui",
+	Short: "Browse missions and review changes in terminal",
+	Long: `Ui command opens a full screen terminal UI listing all missions with the numbers of pending changes, which are planned like 'grafter diff' does. Only linux terminals are supported.
+	Select a mission by enter to browse its changes as a file tree with the diff of selected file. The selected change could be applied by a, or skipped permanently by i which adds an ignore rule like 'grafter graft --interactive'. g applies all changes of mission and records the graft in history, h shows the history. Changes of bidirectional missions include the DEST changes moving back to SRC, files changed by both sides are planned by the strategy of mission, or left as conflicts if it's ask.
+	Keys: up/down or k/j select, PgUp/PgDn or K/J scroll diff, r plans again, esc goes back and q quits.`,
+	Args: cobra.NoArgs,
+	Run:  uiRun,
+}
+
+func init() {
+	rootCmd.AddCommand(uiCmd)
+}
+
+// uiView is a screen of ui.
+type uiView int
+
+const (
+	viewMissions uiView = iota
+	viewChanges
+	viewHistory
+)
+
+// uiMission is a mission with its pending plans.
+type uiMission struct {
+	M     *model.Mission
+	plans []*plan.Plan
+	err   error
+}
+
+// pending return the numbers of pending changes and conflicts.
+func (um *uiMission) pending() (int, int) {
+	var changes, conflicts int
+	for _, p := range um.plans {
+		for _, o := range p.Operations {
+			if o.Op == plan.OpConflict {
+				conflicts++
+			} else {
+				changes++
+			}
+		}
+	}
+	return changes, conflicts
+}
+
+// uiRow is a line of the file tree, op is nil for directories and titles.
+type uiRow struct {
+	text string
+	p    *plan.Plan
+	op   *plan.Operation
+}
+
+// ui is the state of terminal UI.
+type ui struct {
+	out    *bufio.Writer
+	width  int
+	height int
+	status string
+
+	view     uiView
+	missions []*uiMission
+	mission  int
+
+	rows   []uiRow
+	row    int
+	scroll int
+	diff   []string
+}
+
+func uiRun(cmd *cobra.Command, args []string) {
+	if len(Store.Missions) == 0 {
+		log.Fatalln("None Missions.")
+	}
+
+	restore, err := util.MakeRaw(int(os.Stdin.Fd()))
+	if err != nil {
+		log.Fatalf("Failed to open terminal UI: %v", err)
+	}
+	u := &ui{out: bufio.NewWriter(os.Stdout)}
+	// logs are shown in the status line
+	log.SetOutput(u)
+	exit := log.ExitFunc
+	if exit == nil {
+		exit = os.Exit
+	}
+	quit := func() {
+		u.out.WriteString("\x1b[?25h\x1b[?1049l")
+		u.out.Flush()
+		restore()
+	}
+	log.ExitFunc = func(code int) {
+		quit()
+		exit(code)
+	}
+	defer quit()
+
+	u.out.WriteString("\x1b[?1049h\x1b[?25l")
+	for i := range Store.Missions {
+		u.missions = append(u.missions, &uiMission{M: &Store.Missions[i]})
+	}
+	for i := range u.missions {
+		u.status = fmt.Sprintf("Planning %s...", u.missions[i].M.Name)
+		u.draw()
+		u.load(u.missions[i])
+	}
+	u.status = ""
+
+	keys := bufio.NewReader(os.Stdin)
+	for {
+		u.draw()
+		key, err := readKey(keys)
+		if err != nil {
+			return
+		}
+		if !u.handle(key) {
+			return
+		}
+	}
+}
+
+// Write shows the last line of logs in the status line.
+func (u *ui) Write(b []byte) (int, error) {
+	if line := strings.TrimSpace(string(b)); line != "" {
+		u.status = line
+	}
+	return len(b), nil
+}
+
+// readKey reads a key press, escape sequences of keys are named.
+func readKey(r *bufio.Reader) (string, error) {
+	c, err := r.ReadByte()
+	if err != nil {
+		return "", err
+	}
+	if c != 0x1b {
+		return string(c), nil
+	}
+	if r.Buffered() == 0 {
+		return "esc", nil
+	}
+	seq := []byte{c}
+	for r.Buffered() > 0 {
+		b, _ := r.ReadByte()
+		seq = append(seq, b)
+		if len(seq) > 2 && (b >= 'A' && b <= 'Z' || b == '~') {
+			break
+		}
+	}
+	switch string(seq) {
+	case "\x1b[A", "\x1bOA":
+		return "up", nil
+	case "\x1b[B", "\x1bOB":
+		return "down", nil
+	case "\x1b[5~":
+		return "pgup", nil
+	case "\x1b[6~":
+		return "pgdn", nil
+	}
+	return "", nil
+}
+
+// load plans um like diff does.
+func (u *ui) load(um *uiMission) {
+	um.plans, um.err = pendingPlans(um.M)
+}
+
+// handle changes state by key, it return false to quit.
+func (u *ui) handle(key string) bool {
+	switch key {
+	case "q", "\x03":
+		return false
+	case "up", "k":
+		u.move(-1)
+	case "down", "j":
+		u.move(1)
+	case "pgup", "K":
+		u.scroll -= u.diffHeight() / 2
+	case "pgdn", "J":
+		u.scroll += u.diffHeight() / 2
+	case "esc", "\x7f":
+		switch u.view {
+		case viewHistory:
+			u.view = viewChanges
+		case viewChanges:
+			u.view = viewMissions
+		}
+	case "r":
+		u.status = fmt.Sprintf("Planned %s again.", u.missions[u.mission].M.Name)
+		u.reload()
+	case "\r", "\n":
+		if u.view == viewMissions {
+			u.view = viewChanges
+			u.open()
+		}
+	case "a":
+		if u.view == viewChanges {
+			u.apply()
+		}
+	case "i":
+		if u.view == viewChanges {
+			u.ignore()
+		}
+	case "g":
+		if u.view != viewHistory {
+			u.graft()
+		}
+	case "h":
+		if u.view == viewChanges {
+			u.view = viewHistory
+		}
+	}
+	if u.scroll < 0 {
+		u.scroll = 0
+	}
+	return true
+}
+
+// move moves the selection by n.
+func (u *ui) move(n int) {
+	switch u.view {
+	case viewMissions:
+		u.mission += n
+		if u.mission < 0 {
+			u.mission = 0
+		}
+		if u.mission >= len(u.missions) {
+			u.mission = len(u.missions) - 1
+		}
+	case viewChanges:
+		// directories are skipped
+		for i := u.row + n; i >= 0 && i < len(u.rows); i += n {
+			if u.rows[i].op != nil {
+				u.row = i
+				break
+			}
+		}
+		u.showDiff()
+	}
+}
+
+// open builds the file tree of plans of the selected mission.
+func (u *ui) open() {
+	um := u.missions[u.mission]
+	u.rows = nil
+	for _, p := range um.plans {
+		title := "DEST " + p.Dest
+		if p.Dest == um.M.Src {
+			title = "SRC " + p.Dest + " (upstream)"
+		}
+		u.rows = append(u.rows, uiRow{text: fmt.Sprintf("%s: %s", title, p.Summary()), p: p})
+
+		var prev []string
+		for _, o := range p.Operations {
+			dirs := strings.Split(path.Dir(o.Rel), "/")
+			if dirs[0] == "." {
+				dirs = nil
+			}
+			same := 0
+			for same < len(dirs) && same < len(prev) && dirs[same] == prev[same] {
+				same++
+			}
+			for i := same; i < len(dirs); i++ {
+				u.rows = append(u.rows, uiRow{text: strings.Repeat("  ", i+1) + dirs[i] + "/", p: p})
+			}
+			prev = dirs
+
+			text := fmt.Sprintf("%s%-8s %s", strings.Repeat("  ", len(dirs)+1), o.Op, path.Base(o.Rel))
+			if o.Op == plan.OpMove {
+				text += " <- " + o.From
+			}
+			u.rows = append(u.rows, uiRow{text: text, p: p, op: o})
+		}
+	}
+
+	u.row = -1
+	u.move(1)
+	if u.row < 0 {
+		u.row = 0
+		u.diff = nil
+	}
+}
+
+// showDiff renders the diff of selected change.
+func (u *ui) showDiff() {
+	u.scroll = 0
+	u.diff = nil
+	if u.row < 0 || u.row >= len(u.rows) || u.rows[u.row].op == nil {
+		return
+	}
+	r := u.rows[u.row]
+	if r.op.Op == plan.OpConflict {
+		u.diff = []string{"Conflict: " + r.op.Reason}
+		for _, c := range r.op.Conflicts {
+			u.diff = append(u.diff, "  "+c)
+		}
+		return
+	}
+	if r.op.Op == plan.OpDelete {
+		u.diff = []string{"Delete " + r.op.Dest}
+		return
+	}
+	buf := &bytes.Buffer{}
+	if err := r.p.WriteOperationDiff(buf, r.op); err != nil {
+		u.diff = []string{err.Error()}
+		return
+	}
+	u.diff = strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+}
+
+// selected return the selected change, it's nil if there is none.
+func (u *ui) selected() (*plan.Plan, *plan.Operation) {
+	if u.row < 0 || u.row >= len(u.rows) {
+		return nil, nil
+	}
+	return u.rows[u.row].p, u.rows[u.row].op
+}
+
+// apply applies the selected change only. The change of the same file in
+// the other direction of a bidirectional mission is applied with it, since
+// they share the baseline, e.g. both sides of a merged file.
+func (u *ui) apply() {
+	p, o := u.selected()
+	if o == nil {
+		return
+	}
+	if o.Op == plan.OpConflict {
+		u.status = fmt.Sprintf("%s is a conflict, resolve it by hand.", o.Rel)
+		return
+	}
+
+	err := plan.ApplyOperation(p, o)
+	if other, oo := u.counterpart(p, o); err == nil && oo != nil {
+		err = plan.ApplyOperation(other, oo)
+	}
+	if err != nil {
+		u.status = fmt.Sprintf("Failed to %s: %v", o, err)
+	} else {
+		u.status = fmt.Sprintf("Applied %s.", o)
+	}
+	u.reload()
+}
+
+// counterpart return the operation of the same DEST file as o in the other
+// plan of the destination of p, it's nil if the mission is not
+// bidirectional. Plans of bidirectional missions are in pairs of forward and
+// reverse, see pendingPlans.
+func (u *ui) counterpart(p *plan.Plan, o *plan.Operation) (*plan.Plan, *plan.Operation) {
+	um := u.missions[u.mission]
+	if !um.M.Bidirectional() {
+		return nil, nil
+	}
+	var other *plan.Plan
+	for i := range um.plans {
+		if um.plans[i] == p {
+			other = um.plans[i^1]
+		}
+	}
+	if other == nil {
+		return nil, nil
+	}
+
+	rel := o.Rel
+	if o.BaseRel != "" {
+		rel = o.BaseRel
+	}
+	for _, oo := range other.Operations {
+		orel := oo.Rel
+		if oo.BaseRel != "" {
+			orel = oo.BaseRel
+		}
+		if orel == rel && oo.Op != plan.OpConflict {
+			return other, oo
+		}
+	}
+	return nil, nil
+}
+
+// ignore adds an ignore rule of the selected change, see reviewOperation.
+func (u *ui) ignore() {
+	p, o := u.selected()
+	if o == nil {
+		return
+	}
+	M := u.missions[u.mission].M
+
+	switch {
+	case p.Dest == M.Src:
+		// DEST file of upstream change is ignored
+		rel := o.Rel
+		if o.BaseRel != "" {
+			rel = o.BaseRel
+		}
+		M.AddIgnore(exactRule(rel))
+		Store.Modified(true)
+		u.status = fmt.Sprintf("Ignore %s of DEST.", exactRule(rel))
+	case o.Src != "":
+		rel, err := filepath.Rel(o.Source, o.Src)
+		if err != nil {
+			u.status = err.Error()
+			return
+		}
+		rel = filepath.ToSlash(rel)
+		addSourceIgnore(M, o.Source, exactRule(rel))
+		u.status = fmt.Sprintf("Ignore %s of %s.", exactRule(rel), o.Source)
+	default:
+		M.AddIgnore(exactRule(o.Rel))
+		Store.Modified(true)
+		u.status = fmt.Sprintf("Protect %s of DEST.", exactRule(o.Rel))
+	}
+	u.reload()
+}
+
+// graft applies all changes of the selected mission.
+func (u *ui) graft() {
+	um := u.missions[u.mission]
+	if um.err != nil {
+		u.status = fmt.Sprintf("Graft %s aborted: %v", um.M.Name, um.err)
+		return
+	}
+
+	// errors of planning mean sources are not walked completely
+	for _, p := range um.plans {
+		if n := len(p.Report.Errors); n > 0 {
+			u.status = fmt.Sprintf("Graft %s aborted: %d error(s) while planning %s.", um.M.Name, n, p.Dest)
+			return
+		}
+	}
+
+	failed := 0
+	for _, p := range um.plans {
+		plan.Apply(p)
+		failed += len(p.Report.Errors)
+	}
+	if failed > 0 {
+		u.status = fmt.Sprintf("Graft %s finished with %d error(s).", um.M.Name, failed)
+	} else {
+		recordGraft(um.M, "", "")
+		u.status = fmt.Sprintf("Graft %s finished.", um.M.Name)
+	}
+	u.reload()
+}
+
+// reload plans the selected mission again and keeps the selected row.
+func (u *ui) reload() {
+	status, row := u.status, u.row
+	u.load(u.missions[u.mission])
+	u.status = status
+	if u.view == viewChanges {
+		u.open()
+		if row < len(u.rows) {
+			u.row = row - 1
+			u.move(1)
+			if u.row >= 0 && u.rows[u.row].op == nil {
+				u.move(-1)
+			}
+		}
+	}
+}
+
+// diffHeight return the lines of diff area.
+func (u *ui) diffHeight() int {
+	return u.height - u.treeHeight() - 3
+}
+
+// treeHeight return the lines of file tree area.
+func (u *ui) treeHeight() int {
+	h := (u.height - 3) / 2
+	if len(u.rows) < h {
+		h = len(u.rows)
+	}
+	return h
+}
+
+// draw renders the current view.
+func (u *ui) draw() {
+	u.width, u.height = 80, 24
+	if w, h, err := util.TerminalSize(int(os.Stdout.Fd())); err == nil && w > 0 && h > 0 {
+		u.width, u.height = w, h
+	}
+
+	var lines []string
+	var help string
+	switch u.view {
+	case viewMissions:
+		lines, help = u.drawMissions(), "enter: changes  g: graft  r: plan again  q: quit"
+	case viewChanges:
+		lines, help = u.drawChanges(), "a: apply  i: ignore  g: graft all  h: history  r: plan again  esc: back"
+	case viewHistory:
+		lines, help = u.drawHistory(), "esc: back"
+	}
+
+	u.out.WriteString("\x1b[H")
+	u.line("\x1b[7m", " grafter ui  "+help)
+	for i := 0; i < u.height-2; i++ {
+		if i < len(lines) {
+			u.line("", lines[i])
+		} else {
+			u.line("", "")
+		}
+	}
+	u.out.WriteString("\x1b[7m" + u.fit(" "+u.status) + "\x1b[0m")
+	u.out.Flush()
+}
+
+// line writes a line in style, lines beginning with "\x1b" keep their own
+// style.
+func (u *ui) line(style, text string) {
+	if strings.HasPrefix(text, "\x1b") {
+		style, text = text[:strings.Index(text, "m")+1], text[strings.Index(text, "m")+1:]
+	}
+	u.out.WriteString(style + u.fit(text) + "\x1b[0m\r\n")
+}
+
+// fit pads or truncates text to the width of terminal.
+func (u *ui) fit(text string) string {
+	runes := []rune(strings.Replace(text, "\t", "    ", -1))
+	if len(runes) >= u.width {
+		return string(runes[:u.width])
+	}
+	return string(runes) + strings.Repeat(" ", u.width-len(runes))
+}
+
+func (u *ui) drawMissions() []string {
+	lines := []string{"Missions"}
+	for i, um := range u.missions {
+		var state string
+		if um.err != nil {
+			state = "error: " + um.err.Error()
+		} else {
+			changes, conflicts := um.pending()
+			state = fmt.Sprintf("%d pending, %d conflict(s)", changes, conflicts)
+		}
+		mode := model.ModeOneway
+		if um.M.Bidirectional() {
+			mode = model.ModeBidirectional
+		}
+		text := fmt.Sprintf("  %-20s %-30s %s, %d destination(s)", um.M.Name, state, mode, len(um.M.Dests()))
+		if i == u.mission {
+			text = "\x1b[7m" + text
+		}
+		lines = append(lines, text)
+	}
+	return lines
+}
+
+func (u *ui) drawChanges() []string {
+	um := u.missions[u.mission]
+	lines := []string{"Mission " + um.M.Name}
+	if um.err != nil {
+		return append(lines, "error: "+um.err.Error())
+	}
+	if len(u.rows) == 0 {
+		return append(lines, "Nothing to graft.")
+	}
+
+	// keep the selected row in view
+	h := u.treeHeight()
+	top := u.row - h/2
+	if top > len(u.rows)-h {
+		top = len(u.rows) - h
+	}
+	if top < 0 {
+		top = 0
+	}
+	for i := top; i < top+h && i < len(u.rows); i++ {
+		text := u.rows[i].text
+		if i == u.row {
+			text = "\x1b[7m" + text
+		} else if u.rows[i].op == nil {
+			text = "\x1b[1m" + text
+		}
+		lines = append(lines, text)
+	}
+
+	lines = append(lines, "\x1b[2m"+strings.Repeat("-", u.width))
+	if u.scroll > len(u.diff)-1 {
+		u.scroll = len(u.diff) - 1
+	}
+	for i := u.scroll; i >= 0 && i < len(u.diff) && i < u.scroll+u.diffHeight(); i++ {
+		text := u.diff[i]
+		switch {
+		case strings.HasPrefix(text, "+++") || strings.HasPrefix(text, "---"):
+			text = "\x1b[1m" + text
+		case strings.HasPrefix(text, "+"):
+			text = "\x1b[32m" + text
+		case strings.HasPrefix(text, "-"):
+			text = "\x1b[31m" + text
+		case strings.HasPrefix(text, "@@"):
+			text = "\x1b[36m" + text
+		}
+		lines = append(lines, text)
+	}
+	return lines
+}
+
+func (u *ui) drawHistory() []string {
+	M := u.missions[u.mission].M
+	lines := []string{"History of " + M.Name}
+	for i := len(M.History) - 1; i >= 0; i-- {
+		lines = append(lines, "  "+M.History[i].String())
+	}
+	if len(M.History) == 0 {
+		lines = append(lines, "  No graft yet.")
+	}
+	return lines
+}
+
+// exactRule return the ignore regexp matching exactly slash separated path
+// rel.
+func exactRule(rel string) string {
+	return "^" + regexp.QuoteMeta(rel) + "$"
+}
@@ -0,0 +1,72 @@
+// Copyright © 2018 Mephis Pheies <mephistommm@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package cmd
+
+import (
+	"bufio"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestReadKey(t *testing.T) {
+	tests := []struct {
+		input string
+		keys  []string
+	}{
+		{"q", []string{"q"}},
+		{"jk\r", []string{"j", "k", "\r"}},
+		{"\x1b[A\x1b[B", []string{"up", "down"}},
+		{"\x1bOA\x1bOB", []string{"up", "down"}},
+		{"\x1b[5~\x1b[6~", []string{"pgup", "pgdn"}},
+		{"\x1b[Ca", []string{"", "a"}},
+		{"\x1b", []string{"esc"}},
+	}
+	for _, tt := range tests {
+		r := bufio.NewReader(strings.NewReader(tt.input))
+		for _, want := range tt.keys {
+			got, err := readKey(r)
+			if err != nil {
+				t.Fatalf("readKey(%q): %v", tt.input, err)
+			}
+			if got != want {
+				t.Errorf("readKey(%q) = %q, want %q", tt.input, got, want)
+			}
+		}
+		if _, err := readKey(r); err == nil {
+			t.Errorf("readKey(%q) read more keys than %q", tt.input, tt.keys)
+		}
+	}
+}
+
+func TestExactRule(t *testing.T) {
+	rule := regexp.MustCompile(exactRule("dir/a.b+c"))
+	for rel, want := range map[string]bool{
+		"dir/a.b+c":   true,
+		"dir/axb+c":   false,
+		"dir/a.bbc":   false,
+		"x/dir/a.b+c": false,
+		"dir/a.b+c/d": false,
+	} {
+		if got := rule.MatchString(rel); got != want {
+			t.Errorf("exactRule matches %q = %v, want %v", rel, got, want)
+		}
+	}
+}
@@ -21,6 +21,9 @@
 package cmd
 
 import (
+	"os"
+	"path/filepath"
+
 	"github.com/spf13/cobra"
 )
 
@@ -45,4 +48,11 @@ func unregisterRun(cmd *cobra.Command, args []string) {
 	if !ok {
 		log.Fatalf("Mission %s doesn't exist.", name)
 	}
+
+	if err := os.RemoveAll(filepath.Join(Store.BaselineDir(), name)); err != nil {
+		log.Warnf("Failed to remove baselines of %s: %s", name, err.Error())
+	}
+	if err := os.RemoveAll(filepath.Join(Store.StateDir(), name)); err != nil {
+		log.Warnf("Failed to remove states of %s: %s", name, err.Error())
+	}
 }
@@ -0,0 +1,104 @@
+// Copyright © 2018 Mephis Pheies <mephistommm@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package cmd
+
+import (
+	"time"
+
+	"github.com/MephistoMMM/grafter/model"
+
+	"github.com/MephistoMMM/grafter/plan"
+	"github.com/spf13/cobra"
+)
+
+var (
+	upstreamDryRun bool
+	upstreamTarget string
+)
+
+// upstreamCmd represents the upstream command
+var upstreamCmd = &cobra.Command{
+	Use:   "upstream <mission_name>",
+	Short: "Move DEST changes back to the SRC",
+	Long: `Upstream command is the reverse of graft, it writes changes made in DEST since the last graft back into the working tree of SRC. DEST files are compared with their baselines, so the mission must have been grafted into DEST before.
+	Paths are mapped back by the inverse of mapping rules, a new DEST file is added to the SRC path which would be grafted to it. Transforms are inverted if they support it, e.g. replace and goimport swap their mappings, license restores the header of SRC and regions restores keep regions of SRC. The result is transformed again and must be the same as DEST, and SRC must be restored from its own transformed content, otherwise the file is reported as a conflict. Merged YAML and JSON files can't be inverted.
+	A file changed by both SRC and DEST since the last graft is reported as a conflict and left untouched, graft SRC first in that case.
+
+	--dry-run prints the changes without applying them, or an Upstream document with --output json or yaml, run 'grafter diff --reverse' to review them as a patch of SRC. A mission with several destinations must select one by --target.`,
+	Args: cobra.ExactArgs(1),
+	Run:  upstreamRun,
+}
+
+func init() {
+	rootCmd.AddCommand(upstreamCmd)
+	upstreamCmd.Flags().BoolVar(&upstreamDryRun, "dry-run", false, "print changes without applying them")
+	upstreamCmd.Flags().StringVar(&upstreamTarget, "target", "", "move changes of this destination")
+}
+
+func upstreamRun(cmd *cobra.Command, args []string) {
+	name := args[0]
+
+	M := Store.Get(name)
+	if M == nil {
+		log.Fatalf("Mission %s doesn't exist.", name)
+	}
+	dest := selectDest(M, upstreamTarget)
+	start := time.Now()
+
+	sc, err := plan.NewScan(M, plan.Options{BaselineDir: Store.BaselineDir()})
+	defer sc.Close()
+	sc.Report.Log()
+	if err != nil {
+		upstreamResult(M, start, nil, append(sc.Report.Errors, err))
+		log.Fatalf("Upstream %s aborted: %v", M.Name, err)
+	}
+	p, err := sc.Reverse(dest)
+	if err != nil {
+		upstreamResult(M, start, nil, append(sc.Report.Errors, err))
+		log.Fatalf("Upstream %s aborted: %v", M.Name, err)
+	}
+
+	switch {
+	case !upstreamDryRun:
+		plan.Apply(p)
+	default:
+		for _, o := range p.Operations {
+			printText("%s", o)
+		}
+	}
+	p.Report.Log()
+	log.Infof("Upstream %s <- %s: %s.", M.Name, dest, p.Summary())
+
+	upstreamResult(M, start, p, sc.Report.Errors)
+	if failed := len(sc.Report.Errors) + len(p.Report.Errors); failed > 0 {
+		log.Fatalf("Upstream %s finished with %d error(s).", M.Name, failed)
+	}
+}
+
+// upstreamResult prints the Upstream document of plan p if documents are
+// printed.
+func upstreamResult(M *model.Mission, start time.Time, p *plan.Plan, errs []error) {
+	if !structured() {
+		return
+	}
+	doc := newGraftDoc(M, start, []*plan.Plan{p}, errs, "")
+	doc.DryRun = upstreamDryRun
+	printDocument("Upstream", doc)
+}
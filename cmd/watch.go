@@ -0,0 +1,147 @@
+// Copyright © 2018 Mephis Pheies <mephistommm@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package cmd
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/MephistoMMM/grafter/model"
+	"github.com/MephistoMMM/grafter/plan"
+	"github.com/MephistoMMM/grafter/util"
+	"github.com/spf13/cobra"
+)
+
+var watchDelay time.Duration
+
+// watchCmd represents the watch command
+var watchCmd = &cobra.Command{
+	Use:   "watch <mission_name>",
+	Short: "Graft changes of SRC continuously",
+	Long: `Watch command grafts the mission once, then watches sources of mission recursively by inotify and grafts every change until it's interrupted. Only linux is supported.
+	Changes are collected until no change happens for --delay, then only the changed paths are grafted. Ignore rules are the same as graft, ignored directories are not watched, and new directories are watched once they are created. A line is printed for every change applied to DEST.
+	Bidirectional missions are not supported, run 'grafter graft' for them.`,
+	Args: cobra.ExactArgs(1),
+	Run:  watchRun,
+}
+
+func init() {
+	rootCmd.AddCommand(watchCmd)
+	watchCmd.Flags().DurationVar(&watchDelay, "delay", 300*time.Millisecond, "wait until no change happens for this long before grafting")
+}
+
+func watchRun(cmd *cobra.Command, args []string) {
+	name := args[0]
+
+	M := Store.Get(name)
+	if M == nil {
+		log.Fatalf("Mission %s doesn't exist.", name)
+	}
+	if M.Bidirectional() {
+		log.Fatalf("Mission %s is bidirectional, it can't be watched.", M.Name)
+	}
+
+	w, err := util.NewWatcher()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer w.Close()
+	for _, root := range M.Roots() {
+		checker, err := plan.IgnoreChain(M, root.Path, root.Ignore)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := w.Add(root.Path, checker); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	watchGraft(M, nil)
+	log.Infof("Watching %s, press Ctrl-C to stop.", M.Name)
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	timer := time.NewTimer(watchDelay)
+	timer.Stop()
+
+	var (
+		paths = map[string]bool{}
+		full  bool
+	)
+	for {
+		select {
+		case ev, ok := <-w.Events():
+			if !ok {
+				log.Fatalf("Stop watching %s: watcher is closed.", M.Name)
+			}
+			if ev.Path == "" || (ev.Dir && ev.Removed) {
+				// files under the directory are unknown
+				full = true
+			} else {
+				paths[ev.Path] = true
+			}
+			timer.Reset(watchDelay)
+		case err := <-w.Errors():
+			log.Error(err)
+		case <-timer.C:
+			if full {
+				watchGraft(M, nil)
+			} else {
+				changed := make([]string, 0, len(paths))
+				for p := range paths {
+					changed = append(changed, p)
+				}
+				watchGraft(M, changed)
+			}
+			paths, full = map[string]bool{}, false
+		case <-interrupt:
+			log.Infof("Stop watching %s.", M.Name)
+			return
+		}
+	}
+}
+
+// watchGraft grafts paths of sources of M, or all files if paths is nil, and
+// prints every change. Errors are logged without stopping watching.
+func watchGraft(M *model.Mission, paths []string) {
+	sc, plans, err := graft(M, plan.Options{
+		BaselineDir: Store.BaselineDir(),
+		Paths:       paths,
+	}, nil)
+	sc.Report.Log()
+	if err != nil {
+		log.Errorf("Graft %s aborted: %v", M.Name, err)
+		return
+	}
+
+	now := time.Now().Format("15:04:05")
+	for _, p := range plans {
+		for _, o := range p.Operations {
+			if len(plans) > 1 {
+				printText("%s %s: %s", now, p.Dest, o)
+			} else {
+				printText("%s %s", now, o)
+			}
+		}
+		p.Report.Log()
+	}
+}
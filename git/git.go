@@ -0,0 +1,249 @@
+// Copyright © 2018 Mephis Pheies <mephistommm@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+/*
+Package git runs the git command in a working directory of repository.
+Pathspecs passed to it are always literal paths relative to the directory.
+*/
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Repo is a directory in the working tree of a git repository.
+type Repo struct {
+	dir string
+}
+
+// Open return the Repo of dir, dir must be in a working tree of git.
+func Open(dir string) (*Repo, error) {
+	r := &Repo{dir: dir}
+	out, err := r.Run(nil, "rev-parse", "--is-inside-work-tree")
+	if err != nil || strings.TrimSpace(out) != "true" {
+		return nil, fmt.Errorf("%s is not in a git working tree", dir)
+	}
+	return r, nil
+}
+
+// Dir return the directory of repo
+func (r *Repo) Dir() string {
+	return r.dir
+}
+
+// Run execute git with args in directory of repo, stdin is fed to git if it
+// isn't nil. It return the standard output, or an error with the standard
+// error of git.
+func (r *Repo) Run(stdin []byte, args ...string) (string, error) {
+	return r.run(nil, stdin, args...)
+}
+
+// run is Run with extra environment variables.
+func (r *Repo) run(env []string, stdin []byte, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = r.dir
+	cmd.Env = append(os.Environ(), "GIT_LITERAL_PATHSPECS=1")
+	cmd.Env = append(cmd.Env, env...)
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+
+	if err := cmd.Run(); err != nil {
+		return stdout.String(), fmt.Errorf("git %s: %v: %s",
+			args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+// RevParse return the commit id of revision rev.
+func (r *Repo) RevParse(rev string) (string, error) {
+	out, err := r.Run(nil, "rev-parse", "--verify", "--quiet", rev+"^{commit}")
+	if err != nil {
+		return "", fmt.Errorf("unknown revision %s in %s", rev, r.dir)
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// Top return the top directory of working tree.
+func (r *Repo) Top() (string, error) {
+	out, err := r.Run(nil, "rev-parse", "--show-toplevel")
+	return strings.TrimSpace(out), err
+}
+
+// Head return the commit id of HEAD.
+func (r *Repo) Head() (string, error) {
+	return r.RevParse("HEAD")
+}
+
+// Dirty return paths under directory of repo which have uncommitted
+// changes, including untracked files. Paths are relative to the top of
+// working tree.
+func (r *Repo) Dirty() ([]string, error) {
+	return r.Changed([]string{"."})
+}
+
+// Changed return paths under pathspecs, which are relative to directory of repo,
+// which have uncommitted changes. Paths returned are relative to the top of
+// working tree.
+func (r *Repo) Changed(pathspecs []string) ([]string, error) {
+	args := append([]string{"status", "--porcelain", "-z", "--untracked-files=all", "--"}, pathspecs...)
+	out, err := r.Run(nil, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	entries := strings.Split(out, "\x00")
+	for i := 0; i < len(entries); i++ {
+		entry := entries[i]
+		if len(entry) < 4 {
+			continue
+		}
+		paths = append(paths, entry[3:])
+		// the original path of rename follows
+		if entry[0] == 'R' || entry[0] == 'C' {
+			i++
+		}
+	}
+	return paths, nil
+}
+
+// Known return paths, which are relative to directory of repo, that are
+// tracked or exist in the working tree, e.g. untracked files removed are
+// not known. Paths returned are relative to directory of repo.
+func (r *Repo) Known(paths []string) ([]string, error) {
+	if len(paths) == 0 {
+		return nil, nil
+	}
+	args := append([]string{"ls-files", "-z", "--cached", "--others", "--"}, paths...)
+	out, err := r.Run(nil, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var known []string
+	for _, path := range strings.Split(out, "\x00") {
+		if path != "" {
+			known = append(known, filepath.FromSlash(path))
+		}
+	}
+	return known, nil
+}
+
+// HasBranch reports whether local branch exists.
+func (r *Repo) HasBranch(branch string) bool {
+	_, err := r.Run(nil, "rev-parse", "--verify", "--quiet", "refs/heads/"+branch)
+	return err == nil
+}
+
+// Checkout switch to branch, the branch is created from HEAD if it doesn't
+// exist.
+func (r *Repo) Checkout(branch string) error {
+	args := []string{"checkout", "--quiet", branch}
+	if !r.HasBranch(branch) {
+		args = []string{"checkout", "--quiet", "-b", branch}
+	}
+	_, err := r.Run(nil, args...)
+	return err
+}
+
+// Signature is the author of commit, Date is in ISO 8601 format.
+type Signature struct {
+	Name  string
+	Email string
+	Date  string
+}
+
+// CommitInfo is the metadata of commit.
+type CommitInfo struct {
+	ID      string
+	Parents []string
+	Author  Signature
+	Message string
+}
+
+// Commit stage paths, which are relative to directory of repo, and commit
+// them with message. Other changes in the index are not committed. The
+// commit is authored by the user of git if author is nil.
+func (r *Repo) Commit(paths []string, message string, author *Signature) (string, error) {
+	spec := []byte(strings.Join(paths, "\x00"))
+	if _, err := r.Run(spec, "add", "--all", "--pathspec-from-file=-", "--pathspec-file-nul"); err != nil {
+		return "", err
+	}
+
+	var env []string
+	if author != nil {
+		env = []string{
+			"GIT_AUTHOR_NAME=" + author.Name,
+			"GIT_AUTHOR_EMAIL=" + author.Email,
+			"GIT_AUTHOR_DATE=" + author.Date,
+		}
+	}
+	if _, err := r.run(env, spec, "commit", "--quiet", "--only", "--message", message,
+		"--pathspec-from-file=-", "--pathspec-file-nul"); err != nil {
+		return "", err
+	}
+	return r.Head()
+}
+
+// CommitInfo return the metadata of commit rev.
+func (r *Repo) CommitInfo(rev string) (*CommitInfo, error) {
+	out, err := r.Run(nil, "log", "-1", "--format=%H%x00%P%x00%an%x00%ae%x00%aI%x00%B", rev)
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.SplitN(out, "\x00", 6)
+	if len(fields) != 6 {
+		return nil, fmt.Errorf("unexpected output of git log: %q", out)
+	}
+	return &CommitInfo{
+		ID:      fields[0],
+		Parents: strings.Fields(fields[1]),
+		Author:  Signature{Name: fields[2], Email: fields[3], Date: fields[4]},
+		Message: strings.TrimSpace(fields[5]),
+	}, nil
+}
+
+// RevList return commits of revision range rng from the oldest, merges are
+// excluded.
+func (r *Repo) RevList(rng string) ([]string, error) {
+	out, err := r.Run(nil, "rev-list", "--reverse", "--topo-order", "--no-merges", rng)
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(out), nil
+}
+
+// AddTrailer append trailer "key: value" to commit message.
+func (r *Repo) AddTrailer(message, key, value string) (string, error) {
+	out, err := r.Run([]byte(message+"\n"), "interpret-trailers", "--trailer", key+": "+value)
+	return strings.TrimSpace(out), err
+}
+
+// EmptyTree is the object id of the empty tree, which is the parent of root
+// commits when comparing.
+const EmptyTree = "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
@@ -0,0 +1,283 @@
+// Copyright © 2018 Mephis Pheies <mephistommm@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package git
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// testRepo is a temporary git repository for tests.
+type testRepo struct {
+	t   *testing.T
+	dir string
+}
+
+func newTestRepo(t *testing.T) *testRepo {
+	dir, err := ioutil.TempDir("", "grafter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the top of working tree is reported with symlinks resolved
+	if dir, err = filepath.EvalSymlinks(dir); err != nil {
+		t.Fatal(err)
+	}
+	tr := &testRepo{t: t, dir: dir}
+	tr.git("init", "--quiet")
+	tr.git("config", "user.name", "tester")
+	tr.git("config", "user.email", "tester@example.com")
+	return tr
+}
+
+func (tr *testRepo) cleanup() {
+	os.RemoveAll(tr.dir)
+}
+
+// git runs git in repo and return its output.
+func (tr *testRepo) git(args ...string) string {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = tr.dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		tr.t.Fatalf("git %v: %v: %s", args, err, out)
+	}
+	return string(out)
+}
+
+// write writes files of repo, a nil content removes the file.
+func (tr *testRepo) write(files map[string]*string) {
+	for rel, data := range files {
+		path := filepath.Join(tr.dir, filepath.FromSlash(rel))
+		if data == nil {
+			if err := os.Remove(path); err != nil {
+				tr.t.Fatal(err)
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			tr.t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(*data), 0644); err != nil {
+			tr.t.Fatal(err)
+		}
+	}
+}
+
+// commit writes files and commits all changes.
+func (tr *testRepo) commit(files map[string]*string, message string) string {
+	tr.write(files)
+	tr.git("add", "--all")
+	tr.git("commit", "--quiet", "--message", message)
+	id, err := (&Repo{dir: tr.dir}).Head()
+	if err != nil {
+		tr.t.Fatal(err)
+	}
+	return id
+}
+
+func content(s string) *string {
+	return &s
+}
+
+func TestRepoChanged(t *testing.T) {
+	tr := newTestRepo(t)
+	defer tr.cleanup()
+	tr.commit(map[string]*string{"a": content("a"), "sub/b": content("b"), "c": content("c")}, "first")
+	tr.write(map[string]*string{"a": content("changed"), "sub/new": content("new"), "c": nil})
+
+	tests := []struct {
+		dir       string
+		pathspecs []string
+		want      []string
+	}{
+		{dir: "", pathspecs: []string{"."}, want: []string{"a", "c", "sub/new"}},
+		{dir: "", pathspecs: []string{"a", "sub/b"}, want: []string{"a"}},
+		// paths are relative to the top even in subdirectory
+		{dir: "sub", pathspecs: []string{"."}, want: []string{"sub/new"}},
+		{dir: "sub", pathspecs: []string{"b"}, want: nil},
+	}
+	for _, tt := range tests {
+		repo, err := Open(filepath.Join(tr.dir, tt.dir))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := repo.Changed(tt.pathspecs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !equalPaths(got, tt.want) {
+			t.Errorf("Changed(%v) in %q = %v, want %v", tt.pathspecs, tt.dir, got, tt.want)
+		}
+	}
+}
+
+func TestRepoKnown(t *testing.T) {
+	tr := newTestRepo(t)
+	defer tr.cleanup()
+	tr.commit(map[string]*string{"tracked": content("a"), "removed": content("b")}, "first")
+	tr.write(map[string]*string{"untracked": content("c"), "removed": nil})
+
+	repo, err := Open(tr.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := repo.Known([]string{"tracked", "removed", "untracked", "gone"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"removed", "tracked", "untracked"}; !equalPaths(got, want) {
+		t.Errorf("Known = %v, want %v", got, want)
+	}
+}
+
+func TestRepoCommit(t *testing.T) {
+	tr := newTestRepo(t)
+	defer tr.cleanup()
+	tr.commit(map[string]*string{"a": content("a"), "b": content("b"), "c": content("c")}, "first")
+	tr.write(map[string]*string{"a": content("changed"), "b": nil, "new": content("new"), "c": content("unrelated")})
+
+	repo, err := Open(tr.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Checkout("graft"); err != nil {
+		t.Fatal(err)
+	}
+	author := &Signature{Name: "upstream", Email: "upstream@example.com", Date: "2018-01-02T03:04:05+00:00"}
+	id, err := repo.Commit([]string{"a", "b", "new"}, "graft", author)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if branch := tr.git("rev-parse", "--abbrev-ref", "HEAD"); branch != "graft\n" {
+		t.Errorf("branch = %q, want graft", branch)
+	}
+	if files := tr.git("show", "--name-status", "--format=", id); files != "M\ta\nD\tb\nA\tnew\n" {
+		t.Errorf("committed files %q", files)
+	}
+	info, err := repo.CommitInfo(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Author.Name != author.Name || info.Author.Email != author.Email || info.Author.Date != author.Date {
+		t.Errorf("author = %+v, want %+v", info.Author, *author)
+	}
+	// unrelated changes are left uncommitted
+	dirty, err := repo.Dirty()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalPaths(dirty, []string{"c"}) {
+		t.Errorf("Dirty = %v, want [c]", dirty)
+	}
+	if !repo.HasBranch("graft") || repo.HasBranch("missing") {
+		t.Error("HasBranch reports wrong branches")
+	}
+}
+
+func equalPaths(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a = append([]string(nil), a...)
+	b = append([]string(nil), b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	for i := range a {
+		if filepath.ToSlash(a[i]) != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestRepoRevList(t *testing.T) {
+	tr := newTestRepo(t)
+	defer tr.cleanup()
+	first := tr.commit(map[string]*string{"a": content("1")}, "first")
+	second := tr.commit(map[string]*string{"a": content("2")}, "second")
+	third := tr.commit(map[string]*string{"a": content("3")}, "third")
+
+	repo, err := Open(tr.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		rng  string
+		want []string
+	}{
+		{first + ".." + third, []string{second, third}},
+		{second + ".." + third, []string{third}},
+		{third + ".." + third, nil},
+	}
+	for _, tt := range tests {
+		got, err := repo.RevList(tt.rng)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("RevList(%s) = %v, want %v", tt.rng, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("RevList(%s) = %v, want %v", tt.rng, got, tt.want)
+			}
+		}
+	}
+
+	info, err := repo.CommitInfo(second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.ID != second || len(info.Parents) != 1 || info.Parents[0] != first || info.Message != "second" {
+		t.Errorf("CommitInfo = %+v", info)
+	}
+}
+
+func TestRepoAddTrailer(t *testing.T) {
+	tr := newTestRepo(t)
+	defer tr.cleanup()
+	repo, err := Open(tr.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		message, want string
+	}{
+		{"subject", "subject\n\nGrafted-from: abc"},
+		{"subject\n\nbody", "subject\n\nbody\n\nGrafted-from: abc"},
+		{"subject\n\nSigned-off-by: a <a@b>", "subject\n\nSigned-off-by: a <a@b>\nGrafted-from: abc"},
+	}
+	for _, tt := range tests {
+		got, err := repo.AddTrailer(tt.message, "Grafted-from", "abc")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("AddTrailer(%q) = %q, want %q", tt.message, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,388 @@
+// Copyright © 2018 Mephis Pheies <mephistommm@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package git
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MephistoMMM/grafter/util"
+)
+
+// Tree is the directory of repo at a commit, files are read from the object
+// database instead of the working tree.
+type Tree struct {
+	repo   *Repo
+	commit string
+	prefix string
+
+	// cat-file process reading blobs
+	mu    sync.Mutex
+	batch *exec.Cmd
+	in    io.WriteCloser
+	out   *bufio.Reader
+}
+
+// Tree return the tree of directory of repo at revision rev.
+func (r *Repo) Tree(rev string) (*Tree, error) {
+	commit, err := r.RevParse(rev)
+	if err != nil {
+		return nil, err
+	}
+	prefix, err := r.Run(nil, "rev-parse", "--show-prefix")
+	if err != nil {
+		return nil, err
+	}
+	return &Tree{
+		repo:   r,
+		commit: commit,
+		prefix: strings.TrimSpace(prefix),
+	}, nil
+}
+
+// Commit return the commit id of tree
+func (t *Tree) Commit() string {
+	return t.commit
+}
+
+// Dir return the directory of repo, which is the root of tree.
+func (t *Tree) Dir() string {
+	return t.repo.dir
+}
+
+// ReadBlob return the content of blob id.
+func (t *Tree) ReadBlob(id string) ([]byte, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.batch == nil {
+		if err := t.startBatch(); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := fmt.Fprintln(t.in, id); err != nil {
+		return nil, err
+	}
+
+	// header is "<id> <type> <size>" or "<id> missing"
+	header, err := t.out.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.Fields(header)
+	if len(fields) != 3 || fields[1] != "blob" {
+		return nil, fmt.Errorf("failed to read blob %s: %s", id, strings.TrimSpace(header))
+	}
+	size, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, size+1)
+	if _, err := io.ReadFull(t.out, data); err != nil {
+		return nil, err
+	}
+	return data[:size], nil
+}
+
+func (t *Tree) startBatch() error {
+	cmd := exec.Command("git", "cat-file", "--batch")
+	cmd.Dir = t.repo.dir
+	in, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	t.batch, t.in, t.out = cmd, in, bufio.NewReader(out)
+	return nil
+}
+
+// Close stop reading blobs.
+func (t *Tree) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.batch == nil {
+		return nil
+	}
+	t.in.Close()
+	err := t.batch.Wait()
+	t.batch = nil
+	return err
+}
+
+// FileInfo is the os.FileInfo of an entry of tree.
+type FileInfo struct {
+	name string
+	size int64
+	mode os.FileMode
+	// ID is the object id of entry
+	ID string
+}
+
+func (fi *FileInfo) Name() string       { return fi.name }
+func (fi *FileInfo) Size() int64        { return fi.size }
+func (fi *FileInfo) Mode() os.FileMode  { return fi.mode }
+func (fi *FileInfo) ModTime() time.Time { return time.Time{} }
+func (fi *FileInfo) IsDir() bool        { return fi.mode.IsDir() }
+func (fi *FileInfo) Sys() interface{}   { return nil }
+
+// fileMode convert mode of git to os.FileMode, submodules are reported as
+// irregular files.
+func fileMode(mode string) os.FileMode {
+	switch mode {
+	case "040000":
+		return os.ModeDir | 0755
+	case "100755":
+		return 0755
+	case "100644":
+		return 0644
+	case "120000":
+		return os.ModeSymlink | 0777
+	}
+	return os.ModeIrregular
+}
+
+// TreeWalker walks a tree like util.Walker walks a directory, paths of items
+// are the paths of entries in the working tree.
+type TreeWalker struct {
+	tree    *Tree
+	checker util.IgnoreSupport
+
+	pipe chan *util.Item
+}
+
+// NewTreeWalker read and collect entries of tree recursively.
+func NewTreeWalker(tree *Tree, checker util.IgnoreSupport, cap int) *TreeWalker {
+	return &TreeWalker{
+		tree:    tree,
+		checker: checker,
+		pipe:    make(chan *util.Item, cap),
+	}
+}
+
+// Dir return the root of tree
+func (w *TreeWalker) Dir() string {
+	return w.tree.Dir()
+}
+
+// Pipe return single direction channel 'pipe'
+func (w *TreeWalker) Pipe() <-chan *util.Item {
+	return w.pipe
+}
+
+// Walk read and collect entries of tree, entries of ignored directories are
+// skipped.
+func (w *TreeWalker) Walk() error {
+	defer close(w.pipe)
+
+	out, err := w.tree.repo.Run(nil, "ls-tree", "--full-tree", "-r", "-t", "-z", "-l",
+		w.tree.commit+":"+w.tree.prefix)
+	if err != nil {
+		w.pipe <- &util.Item{Err: err}
+		return err
+	}
+
+	dir := w.tree.Dir()
+	w.pipe <- &util.Item{
+		Path: dir,
+		Info: &FileInfo{name: filepath.Base(dir), mode: os.ModeDir | 0755},
+	}
+
+	var skipped []string
+	for _, entry := range strings.Split(out, "\x00") {
+		// entry is "<mode> <type> <id> <size>\t<path>"
+		tab := strings.IndexByte(entry, '\t')
+		if tab < 0 {
+			continue
+		}
+		fields := strings.Fields(entry[:tab])
+		rel := entry[tab+1:]
+		if len(fields) != 4 || underAny(rel, skipped) {
+			continue
+		}
+
+		size, _ := strconv.ParseInt(fields[3], 10, 64)
+		info := &FileInfo{
+			name: filepath.Base(rel),
+			size: size,
+			mode: fileMode(fields[0]),
+			ID:   fields[2],
+		}
+		path := filepath.Join(dir, filepath.FromSlash(rel))
+
+		ignored, cerr := util.Check(w.checker, path, info)
+		if cerr != nil {
+			w.pipe <- &util.Item{Err: cerr, Path: path}
+			if util.IsAbort(cerr) {
+				return cerr
+			}
+		}
+		if !ignored {
+			w.pipe <- &util.Item{Path: path, Info: info}
+			continue
+		}
+		if info.IsDir() {
+			skipped = append(skipped, rel+"/")
+		}
+	}
+	return nil
+}
+
+func underAny(rel string, dirs []string) bool {
+	for _, dir := range dirs {
+		if strings.HasPrefix(rel, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// Change is a file changed between two commits.
+type Change struct {
+	// Status is A, M, D, T, R or C like git diff --name-status
+	Status byte
+	// Path is the path after change, or the deleted path.
+	Path string
+	// From is the path before rename or copy.
+	From string
+	// Old and New are the entries before and after change, nil if absent.
+	Old, New *FileInfo
+}
+
+// Changes return files of tree changed since commit since, renames are
+// detected. Paths are slash separated and relative to root of tree.
+func (t *Tree) Changes(since string) ([]Change, error) {
+	out, err := t.repo.Run(nil, "diff", "--raw", "-z", "-M", "--no-abbrev", "--relative",
+		since, t.commit, "--", ".")
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []Change
+	fields := strings.Split(out, "\x00")
+	for i := 0; i+1 < len(fields); i++ {
+		// meta is ":<old mode> <new mode> <old id> <new id> <status>"
+		meta := strings.Fields(strings.TrimPrefix(fields[i], ":"))
+		if len(meta) != 5 {
+			return nil, fmt.Errorf("unexpected output of git diff: %q", fields[i])
+		}
+		ch := Change{Status: meta[4][0]}
+		i++
+		ch.Path = fields[i]
+		if ch.Status == 'R' || ch.Status == 'C' {
+			if i+1 >= len(fields) {
+				return nil, fmt.Errorf("unexpected end of git diff output")
+			}
+			ch.From = ch.Path
+			i++
+			ch.Path = fields[i]
+		}
+
+		if ch.Status != 'A' {
+			from := ch.From
+			if from == "" {
+				from = ch.Path
+			}
+			ch.Old = &FileInfo{name: filepath.Base(from), mode: fileMode(meta[0]), ID: meta[2]}
+		}
+		if ch.Status != 'D' {
+			ch.New = &FileInfo{name: filepath.Base(ch.Path), mode: fileMode(meta[1]), ID: meta[3]}
+		}
+		changes = append(changes, ch)
+	}
+
+	return changes, t.fillSizes(changes)
+}
+
+// fillSizes set the size of new entries of changes.
+func (t *Tree) fillSizes(changes []Change) error {
+	var ids []string
+	for _, ch := range changes {
+		if ch.New != nil && ch.New.mode.IsRegular() {
+			ids = append(ids, ch.New.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	out, err := t.repo.Run([]byte(strings.Join(ids, "\n")+"\n"), "cat-file", "--batch-check")
+	if err != nil {
+		return err
+	}
+	sizes := map[string]int64{}
+	for _, line := range strings.Split(out, "\n") {
+		// line is "<id> <type> <size>"
+		fields := strings.Fields(line)
+		if len(fields) == 3 {
+			sizes[fields[0]], _ = strconv.ParseInt(fields[2], 10, 64)
+		}
+	}
+	for _, ch := range changes {
+		if ch.New != nil {
+			ch.New.size = sizes[ch.New.ID]
+		}
+	}
+	return nil
+}
+
+// BlobID return the object id of content data as a git blob.
+func BlobID(data []byte) string {
+	h := sha1.New()
+	fmt.Fprintf(h, "blob %d\x00", len(data))
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// HashFile return the object id of file path as a git blob.
+func HashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	h := sha1.New()
+	fmt.Fprintf(h, "blob %d\x00", fi.Size())
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
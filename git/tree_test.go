@@ -0,0 +1,209 @@
+// Copyright © 2018 Mephis Pheies <mephistommm@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package git
+
+import (
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/MephistoMMM/grafter/util"
+)
+
+func TestTreeWalker(t *testing.T) {
+	tr := newTestRepo(t)
+	defer tr.cleanup()
+	tr.commit(map[string]*string{
+		"a":         content("a"),
+		"sub/b":     content("b"),
+		"skip/c":    content("c"),
+		".hidden/d": content("d"),
+	}, "first")
+	// the working tree is not walked
+	tr.write(map[string]*string{"a": content("changed"), "new": content("new")})
+
+	repo, err := Open(tr.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := repo.Tree("HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tree.Close()
+
+	checker, _ := util.NewIgnoreDotSupport()
+	re, _ := util.NewIgnoreRegexpMatchSupport(tr.dir, "^skip$")
+	checker.SetNext(re)
+
+	w := NewTreeWalker(tree, checker, 10)
+	go w.Walk()
+	blobs := map[string]string{}
+	var files []string
+	for item := range w.Pipe() {
+		if item.Err != nil {
+			t.Fatal(item.Err)
+		}
+		if item.Info.IsDir() {
+			continue
+		}
+		rel, _ := filepath.Rel(tr.dir, item.Path)
+		files = append(files, filepath.ToSlash(rel))
+		blobs[filepath.ToSlash(rel)] = item.Info.(*FileInfo).ID
+	}
+	sort.Strings(files)
+
+	want := []string{"a", "sub/b"}
+	if len(files) != len(want) || files[0] != want[0] || files[1] != want[1] {
+		t.Fatalf("walked %v, want %v", files, want)
+	}
+	tests := []struct {
+		rel, data string
+	}{
+		{"a", "a"},
+		{"sub/b", "b"},
+	}
+	for _, tt := range tests {
+		data, err := tree.ReadBlob(blobs[tt.rel])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != tt.data {
+			t.Errorf("ReadBlob(%s) = %q, want %q", tt.rel, data, tt.data)
+		}
+		if id := BlobID(data); id != blobs[tt.rel] {
+			t.Errorf("BlobID(%s) = %s, want %s", tt.rel, id, blobs[tt.rel])
+		}
+	}
+}
+
+func TestTreeOfSubdirectory(t *testing.T) {
+	tr := newTestRepo(t)
+	defer tr.cleanup()
+	first := tr.commit(map[string]*string{"top": content("top"), "sub/a": content("a")}, "first")
+
+	repo, err := Open(filepath.Join(tr.dir, "sub"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := repo.Tree(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tree.Close()
+	if tree.Commit() != first {
+		t.Errorf("Commit = %s, want %s", tree.Commit(), first)
+	}
+
+	checker, _ := util.NewIgnoreDotSupport()
+	w := NewTreeWalker(tree, checker, 10)
+	go w.Walk()
+	var files []string
+	for item := range w.Pipe() {
+		if item.Err == nil && !item.Info.IsDir() {
+			files = append(files, item.Path)
+		}
+	}
+	if len(files) != 1 || files[0] != filepath.Join(tr.dir, "sub", "a") {
+		t.Errorf("walked %v, want only sub/a", files)
+	}
+
+	if _, err := repo.Tree("missing"); err == nil {
+		t.Error("Tree of unknown revision should fail")
+	}
+}
+
+func TestTreeChanges(t *testing.T) {
+	tr := newTestRepo(t)
+	defer tr.cleanup()
+	long := "line 1\nline 2\nline 3\nline 4\nline 5\n"
+	first := tr.commit(map[string]*string{
+		"keep":    content("keep"),
+		"modify":  content("old"),
+		"delete":  content("delete"),
+		"old/ren": content(long),
+	}, "first")
+	tr.commit(map[string]*string{
+		"modify":  content("new content"),
+		"delete":  nil,
+		"old/ren": nil,
+		"new/ren": content(long + "line 6\n"),
+		"add":     content("add"),
+	}, "second")
+
+	repo, err := Open(tr.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := repo.Tree("HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tree.Close()
+
+	changes, err := tree.Changes(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]Change{}
+	for _, ch := range changes {
+		got[ch.Path] = ch
+	}
+
+	tests := []struct {
+		path   string
+		status byte
+		from   string
+		size   int64
+	}{
+		{path: "add", status: 'A', size: 3},
+		{path: "modify", status: 'M', size: 11},
+		{path: "delete", status: 'D'},
+		{path: "new/ren", status: 'R', from: "old/ren", size: int64(len(long) + 7)},
+	}
+	if len(changes) != len(tests) {
+		t.Errorf("Changes = %+v, want %d changes", changes, len(tests))
+	}
+	for _, tt := range tests {
+		ch, ok := got[tt.path]
+		if !ok {
+			t.Errorf("change of %s is missing", tt.path)
+			continue
+		}
+		if ch.Status != tt.status || ch.From != tt.from {
+			t.Errorf("change of %s = %c from %q, want %c from %q", tt.path, ch.Status, ch.From, tt.status, tt.from)
+		}
+		if (ch.Old == nil) != (tt.status == 'A') || (ch.New == nil) != (tt.status == 'D') {
+			t.Errorf("change of %s has old %v and new %v", tt.path, ch.Old, ch.New)
+		}
+		if ch.New != nil && ch.New.Size() != tt.size {
+			t.Errorf("size of %s = %d, want %d", tt.path, ch.New.Size(), tt.size)
+		}
+	}
+
+	// every file is added since the empty tree
+	changes, err = tree.Changes(EmptyTree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 4 {
+		t.Errorf("Changes(EmptyTree) = %+v, want 4 added files", changes)
+	}
+}
@@ -155,7 +155,11 @@ func (c *Checker) LoadBasePath(path string) error {
 	lastPath := ""
 	for curPath != lastPath {
 		ignoreFile := filepath.Join(curPath, GitIgnoreFilename)
-		if _, err := os.Stat(ignoreFile); err == nil {
+		_, err := os.Stat(ignoreFile)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err == nil {
 			var gi *gitIgnore
 			gi, err = c.gitIgnoreCache.get(ignoreFile)
 			if err != nil {
@@ -0,0 +1,97 @@
+// Copyright © 2018 Mephis Pheies <mephistommm@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package model
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+
+	"github.com/MephistoMMM/grafter/util"
+)
+
+// Baseline stores the SRC content last grafted into a destination of
+// mission, which is the merge base of changes made by SRC and DEST.
+type Baseline struct {
+	dir string
+}
+
+// NewBaseline return the Baseline of destination dest of mission name, which
+// is stored under root.
+func NewBaseline(root, name, dest string) *Baseline {
+	sum := sha1.Sum([]byte(dest))
+	return &Baseline{
+		dir: filepath.Join(root, name, hex.EncodeToString(sum[:8])),
+	}
+}
+
+// Dir return the directory of baseline
+func (b *Baseline) Dir() string {
+	return b.dir
+}
+
+// Path return the baseline file of DEST path rel, rel is slash separated.
+func (b *Baseline) Path(rel string) string {
+	return filepath.Join(b.dir, "files", filepath.FromSlash(rel))
+}
+
+// Read return the content last grafted into DEST path rel.
+func (b *Baseline) Read(rel string) ([]byte, error) {
+	return util.ReadFile(b.Path(rel))
+}
+
+// Write record data as the content grafted into DEST path rel.
+func (b *Baseline) Write(rel string, data []byte) error {
+	return util.WriteFile(b.Path(rel), data)
+}
+
+// Remove forget DEST path rel, it does nothing if rel is not recorded.
+func (b *Baseline) Remove(rel string) error {
+	err := os.Remove(b.Path(rel))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// Files return slash separated DEST paths recorded in baseline.
+func (b *Baseline) Files() ([]string, error) {
+	root := filepath.Join(b.dir, "files")
+	var files []string
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == root {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	return files, err
+}
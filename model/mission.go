@@ -23,24 +23,246 @@ package model
 
 import (
 	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/MephistoMMM/grafter/util"
 	"github.com/MephistoMMM/grafter/version"
 	yaml "gopkg.in/yaml.v2"
 )
 
+// Mapping is a rule to place SRC path into a different DEST path. Paths are
+// slash separated and relative to SRC and DEST. It is a directory prefix rule
+// by default, or a regexp rule with capture groups if Regexp is true.
+type Mapping struct {
+	Src    string `yaml:"src" json:"src"`
+	Dest   string `yaml:"dest" json:"dest"`
+	Regexp bool   `yaml:"regexp,omitempty" json:"regexp,omitempty"`
+}
+
+// String return string value of Mapping
+func (mp Mapping) String() string {
+	if mp.Regexp {
+		return fmt.Sprintf("%s -> %s (regexp)", mp.Src, mp.Dest)
+	}
+	return fmt.Sprintf("%s -> %s", mp.Src, mp.Dest)
+}
+
+// Source is a source root grafted into Sub directory of DEST, with its own
+// ignore regexps and mapping rules.
+type Source struct {
+	Path     string    `yaml:"path" json:"path"`
+	Sub      string    `yaml:"sub,omitempty" json:"sub,omitempty"`
+	Ignore   []string  `yaml:"ignore,omitempty" json:"ignore,omitempty"`
+	Mappings []Mapping `yaml:"mappings,omitempty" json:"mappings,omitempty"`
+}
+
+// String return string value of Source
+func (s Source) String() string {
+	str := fmt.Sprintf("%s -> %s", s.Path, path.Join("DEST", s.Sub))
+	if len(s.Ignore) > 0 {
+		str += fmt.Sprintf(" ignore: %v", s.Ignore)
+	}
+	if len(s.Mappings) > 0 {
+		str += fmt.Sprintf(" mappings: %v", s.Mappings)
+	}
+	return str
+}
+
+// AddIgnore append a new regex string to Ignore field of source, if it has
+// not been existed.
+func (s *Source) AddIgnore(reStr string) {
+	for _, i := range s.Ignore {
+		if i == reStr {
+			return
+		}
+	}
+
+	s.Ignore = append(s.Ignore, reStr)
+}
+
+// Mapper create PathMapper from Mappings field.
+func (s *Source) Mapper() (*util.PathMapper, error) {
+	return newMapper(s.Mappings)
+}
+
+// Transform configures a transformer rewriting file content while grafting.
+// Files are shell patterns limiting the transformer, it applies to all files
+// if Files is empty.
+type Transform struct {
+	Type  string   `yaml:"type" json:"type"`
+	Files []string `yaml:"files,omitempty" json:"files,omitempty"`
+	From  string   `yaml:"from,omitempty" json:"from,omitempty"`
+	To    string   `yaml:"to,omitempty" json:"to,omitempty"`
+	// Options holds settings of transformers other than from and to.
+	Options map[string]string `yaml:"options,omitempty" json:"options,omitempty"`
+}
+
+// String return string value of Transform
+func (t Transform) String() string {
+	s := t.Type
+	if t.From != "" || t.To != "" {
+		s += fmt.Sprintf(" %q -> %q", t.From, t.To)
+	}
+	if len(t.Options) > 0 {
+		s += fmt.Sprintf(" %v", t.Options)
+	}
+	if len(t.Files) > 0 {
+		s += fmt.Sprintf(" files: %v", t.Files)
+	}
+	return s
+}
+
+// historyLimit is the number of grafts kept in history of mission.
+const historyLimit = 50
+
+// Graft is a successful graft recorded in history of mission.
+type Graft struct {
+	Time time.Time `yaml:"time" json:"time"`
+	// Rev is the revision of SRC asked to graft, it's empty if the working
+	// tree is grafted.
+	Rev string `yaml:"rev,omitempty" json:"rev,omitempty"`
+	// Commit is the SRC commit grafted, or HEAD of SRC if the working tree
+	// is grafted. It's empty if SRC is not a git repository.
+	Commit string `yaml:"commit,omitempty" json:"commit,omitempty"`
+	// Dirty is true if the working tree grafted had uncommitted changes.
+	Dirty bool `yaml:"dirty,omitempty" json:"dirty,omitempty"`
+}
+
+// String return string value of Graft
+func (g Graft) String() string {
+	s := g.Time.Format(time.RFC3339)
+	switch {
+	case g.Rev != "":
+		s += fmt.Sprintf(" %s (%s)", g.Rev, g.Commit)
+	case g.Commit != "" && g.Dirty:
+		s += fmt.Sprintf(" dirty working tree (HEAD %s)", g.Commit)
+	case g.Commit != "":
+		s += fmt.Sprintf(" working tree (HEAD %s)", g.Commit)
+	default:
+		s += " working tree"
+	}
+	return s
+}
+
+// Modes of mission.
+const (
+	// ModeOneway grafts SRC into DEST only, it's the default.
+	ModeOneway = "oneway"
+	// ModeBidirectional also moves DEST changes back to SRC.
+	ModeBidirectional = "bidirectional"
+)
+
+// Strategies resolving files changed by both sides in bidirectional mode.
+var Strategies = []string{"ask", "newer-wins", "src-wins", "dest-wins", "merge"}
+
 // Mission represents a mission of grafting.
 type Mission struct {
-	Src    string   `yaml:"src"`
-	Dest   string   `yaml:"dest"`
-	Name   string   `yaml:"name"`
-	Ignore []string `yaml:"ignore"`
+	Src    string   `yaml:"src" json:"src"`
+	Dest   string   `yaml:"dest" json:"dest"`
+	Name   string   `yaml:"name" json:"name"`
+	Ignore []string `yaml:"ignore" json:"ignore"`
+	// Mappings are ordered, the first matched rule wins.
+	Mappings []Mapping `yaml:"mappings,omitempty" json:"mappings,omitempty"`
+	// Sources are extra source roots besides Src.
+	Sources []Source `yaml:"sources,omitempty" json:"sources,omitempty"`
+	// Targets are extra destinations besides Dest.
+	Targets []string `yaml:"targets,omitempty" json:"targets,omitempty"`
+	// Transforms are applied in order to content of grafted files.
+	Transforms []Transform `yaml:"transforms,omitempty" json:"transforms,omitempty"`
+	// Vars are variables of mission used by transforms, e.g. templates.
+	Vars map[string]string `yaml:"vars,omitempty" json:"vars,omitempty"`
+	// OnError maps the name of ignore support (dot, unregular, gitignore,
+	// regexp) to its error policy (fail-closed, fail-open, abort). The policy
+	// of unregular also decides files and directories which can't be read.
+	OnError map[string]string `yaml:"on_error,omitempty" json:"on_error,omitempty"`
+	// History records the latest grafts, the last one is the newest.
+	History []Graft `yaml:"history,omitempty" json:"history,omitempty"`
+	// Mode is oneway or bidirectional, it's oneway if empty.
+	Mode string `yaml:"mode,omitempty" json:"mode,omitempty"`
+	// Strategy resolves files changed by both sides in bidirectional mode,
+	// it's ask if empty.
+	Strategy string `yaml:"strategy,omitempty" json:"strategy,omitempty"`
 }
 
 // String return string value of Mission data
 func (m *Mission) String() string {
-	return fmt.Sprintf("%s:\n\tsrc: %s\n\tdest: %s\n\tignore: %s\n",
+	s := fmt.Sprintf("%s:\n\tsrc: %s\n\tdest: %s\n\tignore: %s\n",
 		m.Name, m.Src, m.Dest, m.Ignore)
+	if len(m.Mappings) > 0 {
+		s += fmt.Sprintf("\tmappings: %v\n", m.Mappings)
+	}
+	for _, src := range m.Sources {
+		s += fmt.Sprintf("\tsource: %s\n", src)
+	}
+	if len(m.Targets) > 0 {
+		s += fmt.Sprintf("\ttargets: %v\n", m.Targets)
+	}
+	for _, t := range m.Transforms {
+		s += fmt.Sprintf("\ttransform: %s\n", t)
+	}
+	if len(m.Vars) > 0 {
+		s += fmt.Sprintf("\tvars: %v\n", m.Vars)
+	}
+	if len(m.OnError) > 0 {
+		s += fmt.Sprintf("\ton_error: %v\n", m.OnError)
+	}
+	if m.Bidirectional() {
+		s += fmt.Sprintf("\tmode: %s (strategy: %s)\n", m.Mode, m.ConflictStrategy())
+	}
+	if g := m.LastGraft(); g != nil {
+		s += fmt.Sprintf("\tlast graft: %s\n", g)
+	}
+	return s
+}
+
+// Bidirectional reports whether mission is in bidirectional mode.
+func (m *Mission) Bidirectional() bool {
+	return m.Mode == ModeBidirectional
+}
+
+// ConflictStrategy return the strategy resolving files changed by both
+// sides, ask by default.
+func (m *Mission) ConflictStrategy() string {
+	if m.Strategy == "" {
+		return "ask"
+	}
+	return m.Strategy
+}
+
+// SetMode change mode and strategy of mission, strategy is kept if it's
+// empty.
+func (m *Mission) SetMode(mode, strategy string) error {
+	if mode != ModeOneway && mode != ModeBidirectional {
+		return fmt.Errorf("unknown mode %q, available: %s, %s", mode, ModeOneway, ModeBidirectional)
+	}
+	if strategy != "" {
+		valid := false
+		for _, st := range Strategies {
+			valid = valid || st == strategy
+		}
+		if !valid {
+			return fmt.Errorf("unknown strategy %q, available: %s", strategy, strings.Join(Strategies, ", "))
+		}
+		m.Strategy = strategy
+	}
+	m.Mode = mode
+	if mode == ModeOneway {
+		m.Mode = ""
+	}
+	return nil
+}
+
+// ErrorPolicy return the error policy of ignore support, it is fail-closed
+// if not configured.
+func (m *Mission) ErrorPolicy(support string) (util.ErrorPolicy, error) {
+	name, ok := m.OnError[support]
+	if !ok {
+		return util.FailClosed, nil
+	}
+	return util.ParseErrorPolicy(name)
 }
 
 // AddIgnore append a new regex string to Ignore field, if it
@@ -67,12 +289,163 @@ func (m *Mission) RemoveIgnore(index int64) {
 	}
 }
 
+// AddMapping append a new mapping rule to Mappings field, if it has not been
+// existed.
+func (m *Mission) AddMapping(mp Mapping) {
+	for _, i := range m.Mappings {
+		if i == mp {
+			return
+		}
+	}
+
+	m.Mappings = append(m.Mappings, mp)
+}
+
+// RemoveMapping delete a mapping rule from Mappings field. if index is out of
+// range, do nothing.
+func (m *Mission) RemoveMapping(index int64) {
+	if index < 0 || index >= int64(len(m.Mappings)) {
+		return
+	}
+	m.Mappings = append(m.Mappings[:index], m.Mappings[index+1:]...)
+}
+
+// Mapper create PathMapper from Mappings field.
+func (m *Mission) Mapper() (*util.PathMapper, error) {
+	return newMapper(m.Mappings)
+}
+
+// Roots return all source roots of mission. Src is the first one which is
+// grafted into the root of DEST with Ignore and Mappings of mission.
+func (m *Mission) Roots() []Source {
+	roots := make([]Source, 0, len(m.Sources)+1)
+	if m.Src != "" {
+		roots = append(roots, Source{
+			Path:     m.Src,
+			Ignore:   m.Ignore,
+			Mappings: m.Mappings,
+		})
+	}
+	return append(roots, m.Sources...)
+}
+
+// AddSource append a new source root to Sources field, it returns false if
+// the path has been existed.
+func (m *Mission) AddSource(s Source) bool {
+	if s.Path == m.Src {
+		return false
+	}
+	for _, i := range m.Sources {
+		if i.Path == s.Path {
+			return false
+		}
+	}
+
+	m.Sources = append(m.Sources, s)
+	return true
+}
+
+// RemoveSource delete a source root from Sources field. if index is out of
+// range, do nothing.
+func (m *Mission) RemoveSource(index int64) {
+	if index < 0 || index >= int64(len(m.Sources)) {
+		return
+	}
+	m.Sources = append(m.Sources[:index], m.Sources[index+1:]...)
+}
+
+// Dests return all destinations of mission, Dest is the first one.
+func (m *Mission) Dests() []string {
+	return append([]string{m.Dest}, m.Targets...)
+}
+
+// AddTarget append a new destination to Targets field, it returns false if
+// the destination has been existed.
+func (m *Mission) AddTarget(dest string) bool {
+	for _, d := range m.Dests() {
+		if d == dest {
+			return false
+		}
+	}
+
+	m.Targets = append(m.Targets, dest)
+	return true
+}
+
+// RemoveTarget delete a destination from Targets field. if index is out of
+// range, do nothing.
+func (m *Mission) RemoveTarget(index int64) {
+	if index < 0 || index >= int64(len(m.Targets)) {
+		return
+	}
+	m.Targets = append(m.Targets[:index], m.Targets[index+1:]...)
+}
+
+// AddTransform append a new transform to Transforms field.
+func (m *Mission) AddTransform(t Transform) {
+	m.Transforms = append(m.Transforms, t)
+}
+
+// RemoveTransform delete a transform from Transforms field. if index is out
+// of range, do nothing.
+func (m *Mission) RemoveTransform(index int64) {
+	if index < 0 || index >= int64(len(m.Transforms)) {
+		return
+	}
+	m.Transforms = append(m.Transforms[:index], m.Transforms[index+1:]...)
+}
+
+// SetVar set value of variable key.
+func (m *Mission) SetVar(key, value string) {
+	if m.Vars == nil {
+		m.Vars = map[string]string{}
+	}
+	m.Vars[key] = value
+}
+
+// UnsetVar delete variable key, it returns false if key doesn't exist.
+func (m *Mission) UnsetVar(key string) bool {
+	if _, ok := m.Vars[key]; !ok {
+		return false
+	}
+	delete(m.Vars, key)
+	return true
+}
+
+// AddHistory record graft g, only the latest grafts are kept.
+func (m *Mission) AddHistory(g Graft) {
+	m.History = append(m.History, g)
+	if len(m.History) > historyLimit {
+		m.History = m.History[len(m.History)-historyLimit:]
+	}
+}
+
+// LastGraft return the newest graft in history, or nil if there is none.
+func (m *Mission) LastGraft() *Graft {
+	if len(m.History) == 0 {
+		return nil
+	}
+	return &m.History[len(m.History)-1]
+}
+
+func newMapper(mappings []Mapping) (*util.PathMapper, error) {
+	rules := make([]util.MapRule, 0, len(mappings))
+	for _, mp := range mappings {
+		rules = append(rules, util.MapRule{
+			Src:    mp.Src,
+			Dest:   mp.Dest,
+			Regexp: mp.Regexp,
+		})
+	}
+	return util.NewPathMapper(rules)
+}
+
 // MissionStore store all registered Missions
 type MissionStore struct {
 	path     string
 	modified bool
-	Version  string    `yaml:"version"`
-	Missions []Mission `yaml:"missions"`
+	Version  string    `yaml:"version" json:"version"`
+	Missions []Mission `yaml:"missions" json:"missions"`
 }
 
 // NewMissionStore create and init a new MissionStore
@@ -141,6 +514,18 @@ func (ms *MissionStore) Path() string {
 	return ms.path
 }
 
+// BaselineDir return the root directory of baselines, which is beside the
+// store file.
+func (ms *MissionStore) BaselineDir() string {
+	return filepath.Join(filepath.Dir(ms.path), "baseline")
+}
+
+// StateDir return the root directory of states of unfinished commands,
+// which is beside the store file.
+func (ms *MissionStore) StateDir() string {
+	return filepath.Join(filepath.Dir(ms.path), "state")
+}
+
 // Load read mission data from path
 func (ms *MissionStore) Load(path string) error {
 	if util.IsNotExist(path) {
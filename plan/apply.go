@@ -0,0 +1,172 @@
+// Copyright © 2018 Mephis Pheies <mephistommm@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package plan
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+
+	"github.com/MephistoMMM/grafter/model"
+	"github.com/MephistoMMM/grafter/util"
+)
+
+// Apply execute operations of plan concurrently, conflicts are skipped.
+// Errors are collected into Report of plan.
+func Apply(p *Plan) {
+	ops := make(chan *Operation)
+	var wg sync.WaitGroup
+	for i := 0; i < runtime.NumCPU(); i++ {
+		wg.Add(1)
+		go doApply(&wg, ops, p)
+	}
+
+	for _, o := range p.Operations {
+		ops <- o
+	}
+	close(ops)
+	wg.Wait()
+}
+
+func doApply(wg *sync.WaitGroup, ops <-chan *Operation, p *Plan) {
+	for o := range ops {
+		p.Report.AddError(ApplyOperation(p, o))
+	}
+
+	wg.Done()
+}
+
+// ApplyOperation execute operation o of plan p alone, and records its
+// baseline like Apply does.
+func ApplyOperation(p *Plan, o *Operation) error {
+	err := applyOperation(p, o)
+	if err == nil && p.Baseline != nil {
+		err = recordBaseline(p.Baseline, o)
+	}
+	return err
+}
+
+func applyOperation(p *Plan, o *Operation) error {
+	switch o.Op {
+	case OpAdd, OpModify:
+		if err := writeFile(o); err != nil {
+			return err
+		}
+		return applyExecutable(o.Dest, isExecutable(o.Mode))
+	case OpMove:
+		from := filepath.Join(p.Dest, filepath.FromSlash(o.From))
+		if o.Src != "" {
+			if err := writeFile(o); err != nil {
+				return err
+			}
+			if err := os.Remove(from); err != nil {
+				return fmt.Errorf("Failed to remove %s: %s", from, err.Error())
+			}
+		} else {
+			// DEST changes are kept by moving the file
+			if err := os.MkdirAll(filepath.Dir(o.Dest), util.PERM_OF_AUTO_CREATE_DIR); err != nil {
+				return err
+			}
+			if err := os.Rename(from, o.Dest); err != nil {
+				return fmt.Errorf("Failed to move %s: %s", from, err.Error())
+			}
+		}
+		return applyExecutable(o.Dest, isExecutable(o.Mode))
+	case OpDelete:
+		if err := os.Remove(o.Dest); err != nil {
+			return fmt.Errorf("Failed to remove %s: %s", o.Dest, err.Error())
+		}
+	}
+	return nil
+}
+
+// writeFile write the content of SRC file of o to DEST.
+func writeFile(o *Operation) error {
+	if o.Data != nil {
+		return util.WriteFile(o.Dest, o.Data)
+	}
+	return util.CopyFile(o.Src, o.Dest)
+}
+
+// Resolve records the baseline of conflict o as if it was applied, it's
+// called after the conflict is resolved in DEST by hand.
+func (p *Plan) Resolve(o *Operation) error {
+	if p.Baseline == nil || len(o.Conflicts) > 1 {
+		return nil
+	}
+	resolved := *o
+	switch {
+	case o.From != "":
+		resolved.Op = OpMove
+	case o.Src == "":
+		resolved.Op = OpDelete
+	default:
+		resolved.Op = OpModify
+	}
+	return recordBaseline(p.Baseline, &resolved)
+}
+
+// applyExecutable set or clear the executable bits of file path, readable
+// users are allowed to execute it like git does.
+func applyExecutable(path string, executable bool) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	perm := fi.Mode().Perm()
+	if executable {
+		perm |= (perm & 0444) >> 2
+	} else {
+		perm &^= 0111
+	}
+	if perm == fi.Mode().Perm() {
+		return nil
+	}
+	return os.Chmod(path, perm)
+}
+
+// recordBaseline keep the content written by o as baseline of DEST.
+func recordBaseline(base *model.Baseline, o *Operation) error {
+	rel := o.Rel
+	if o.BaseRel != "" {
+		rel = o.BaseRel
+	}
+	switch o.Op {
+	case OpAdd, OpModify, OpMove:
+		if o.Op == OpMove {
+			if err := base.Remove(o.From); err != nil {
+				return err
+			}
+		}
+		if o.Origin != nil {
+			return base.Write(rel, o.Origin)
+		}
+		if o.Data != nil {
+			return base.Write(rel, o.Data)
+		}
+		return util.CopyFile(o.Src, base.Path(rel))
+	case OpDelete:
+		return base.Remove(rel)
+	}
+	return nil
+}
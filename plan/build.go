@@ -0,0 +1,844 @@
+// Copyright © 2018 Mephis Pheies <mephistommm@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package plan
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MephistoMMM/grafter/git"
+	"github.com/MephistoMMM/grafter/model"
+	"github.com/MephistoMMM/grafter/transform"
+	"github.com/MephistoMMM/grafter/util"
+)
+
+// source is a resolved source root of mission.
+type source struct {
+	root    string
+	sub     string
+	mapper  *util.PathMapper
+	checker util.IgnoreSupport
+	// tree is the revision of root to graft, the working tree is grafted
+	// if it's nil.
+	tree *git.Tree
+}
+
+func resolveSources(M *model.Mission, rev string) ([]*source, error) {
+	roots := M.Roots()
+	sources := make([]*source, 0, len(roots))
+	for i := range roots {
+		mapper, err := roots[i].Mapper()
+		if err != nil {
+			return nil, err
+		}
+		checker, err := IgnoreChain(M, roots[i].Path, roots[i].Ignore)
+		if err != nil {
+			return nil, err
+		}
+
+		s := &source{
+			root:    roots[i].Path,
+			sub:     strings.Trim(path.Clean("/"+filepath.ToSlash(roots[i].Sub)), "/"),
+			mapper:  mapper,
+			checker: checker,
+		}
+		if rev != "" {
+			repo, err := git.Open(s.root)
+			if err != nil {
+				return nil, err
+			}
+			if s.tree, err = repo.Tree(rev); err != nil {
+				return nil, err
+			}
+		}
+		sources = append(sources, s)
+	}
+	return sources, nil
+}
+
+// walker return the walker of files of source.
+func (s *source) walker() util.FileWalker {
+	if s.tree != nil {
+		return git.NewTreeWalker(s.tree, s.checker, 10)
+	}
+	return util.NewWalker(s.root, s.checker, 10)
+}
+
+// destRel return the DEST path of rel, which is relative to root of source.
+func (s *source) destRel(rel string) string {
+	return path.Join(s.sub, s.mapper.Map(rel))
+}
+
+// owns reports whether DEST path rel is under the sub directory of source.
+func (s *source) owns(rel string) bool {
+	return s.sub == "" || strings.HasPrefix(rel, s.sub+"/")
+}
+
+// srcPath return the SRC file mapped to DEST path rel, ok is false if no SRC
+// file is mapped to rel.
+func (s *source) srcPath(rel string) (string, bool, error) {
+	if s.sub != "" {
+		rel = rel[len(s.sub)+1:]
+	}
+	rel, ok, err := s.mapper.Unmap(rel)
+	if !ok || err != nil {
+		return "", ok, err
+	}
+	return filepath.Join(s.root, filepath.FromSlash(rel)), true, nil
+}
+
+// absent reports whether SRC path src is known not to exist. Files of a git
+// revision are only known by walking it, so they are never reported absent.
+func (s *source) absent(src string) bool {
+	if s.tree != nil {
+		return false
+	}
+	_, err := os.Lstat(src)
+	return os.IsNotExist(err)
+}
+
+// ignored reports whether SRC path src, or any of its parent directories, is
+// ignored by source s. src may not exist, info is used for it.
+func (s *source) ignored(src string, info os.FileInfo) (bool, error) {
+	return ignoredUnder(s.checker, s.root, src, info)
+}
+
+// ignoredUnder reports whether path p, or any of its parent directories under
+// root, is ignored by checker. p may not exist, info is used for it.
+func ignoredUnder(checker util.IgnoreSupport, root, p string, info os.FileInfo) (bool, error) {
+	ignored, err := util.Check(checker, p, info)
+	if ignored || err != nil {
+		return ignored, err
+	}
+
+	for dir := filepath.Dir(p); len(dir) > len(root); dir = filepath.Dir(dir) {
+		var di os.FileInfo = dirInfo(filepath.Base(dir))
+		if fi, err := os.Lstat(dir); err == nil {
+			di = fi
+		}
+		ignored, err := util.Check(checker, dir, di)
+		if ignored || err != nil {
+			return ignored, err
+		}
+	}
+	return false, nil
+}
+
+// dirInfo is the os.FileInfo of a directory which doesn't exist.
+type dirInfo string
+
+func (di dirInfo) Name() string       { return string(di) }
+func (di dirInfo) Size() int64        { return 0 }
+func (di dirInfo) Mode() os.FileMode  { return os.ModeDir | 0755 }
+func (di dirInfo) ModTime() time.Time { return time.Time{} }
+func (di dirInfo) IsDir() bool        { return true }
+func (di dirInfo) Sys() interface{}   { return nil }
+
+// fileInfo is the os.FileInfo of a regular file which doesn't exist.
+type fileInfo struct{ dirInfo }
+
+func (fi fileInfo) Mode() os.FileMode { return 0644 }
+func (fi fileInfo) IsDir() bool       { return false }
+
+// candidate is a SRC file producing a DEST file.
+type candidate struct {
+	src    string
+	info   os.FileInfo
+	source *source
+	// blob is the object id of SRC file read from git tree.
+	blob string
+
+	once sync.Once
+	sum  []byte
+	err  error
+}
+
+// hash return the checksum of SRC file, it's computed only once and shared by
+// all destinations.
+func (c *candidate) hash() ([]byte, error) {
+	c.once.Do(func() {
+		c.sum, c.err = util.HashFile(c.src)
+	})
+	return c.sum, c.err
+}
+
+// read return the content of SRC file.
+func (c *candidate) read() ([]byte, error) {
+	if c.blob != "" {
+		return c.source.tree.ReadBlob(c.blob)
+	}
+	return util.ReadFile(c.src)
+}
+
+// Options changes how a mission is planned.
+type Options struct {
+	// BaselineDir is the root directory of baselines. Baselines are neither
+	// used nor recorded if it's empty.
+	BaselineDir string
+	// SrcRev is the git revision of sources to graft, the working trees are
+	// grafted if it's empty.
+	SrcRev string
+	// Since is the SRC commit of the last graft. If it's set, only files
+	// changed between Since and SrcRev (HEAD by default) are planned.
+	Since string
+	// DetectLocal reports DEST files changed since they were grafted as
+	// conflicts, instead of overwriting or removing them. Baselines are
+	// needed to detect changes.
+	DetectLocal bool
+	// Paths are files or directories of the working trees of sources changed
+	// since the last graft. If it's set, only files under these paths are
+	// planned, paths which don't exist are deleted from DEST.
+	Paths []string
+}
+
+// Scan holds SRC files of all source roots of mission, it is walked once and
+// could be planned for several destinations.
+type Scan struct {
+	M           *model.Mission
+	opts        Options
+	sources     []*source
+	transformer transform.Chain
+	// outputs maps DEST paths to SRC files producing them
+	outputs map[string][]*candidate
+	// deleted maps DEST paths of SRC files deleted since the last graft to
+	// their sources, it's only used by incremental graft.
+	deleted map[string]*source
+	// complete is true if every source is walked without errors, so a SRC
+	// file absent in outputs is known to be gone or ignored.
+	complete bool
+
+	// Report collects errors while walking sources.
+	Report *util.Report
+}
+
+// NewScan walk all source roots of mission M. Errors which do not stop the
+// graft are collected into Report of scan, the returned error means scanning
+// is aborted.
+func NewScan(M *model.Mission, opts Options) (*Scan, error) {
+	sc := &Scan{
+		M:       M,
+		opts:    opts,
+		outputs: map[string][]*candidate{},
+		Report:  util.NewReport(),
+	}
+
+	if opts.Since != "" && opts.SrcRev == "" {
+		sc.opts.SrcRev = "HEAD"
+	}
+	sources, err := resolveSources(M, sc.opts.SrcRev)
+	if err != nil {
+		return sc, err
+	}
+	sc.sources = sources
+	if sc.transformer, err = transform.NewChain(M); err != nil {
+		return sc, err
+	}
+	if len(opts.Paths) > 0 && sc.opts.SrcRev != "" {
+		return sc, fmt.Errorf("changed paths can only be planned in the working tree")
+	}
+	for _, s := range sources {
+		switch {
+		case opts.Since != "":
+			err = sc.diffSource(s, opts.Since)
+		case len(opts.Paths) > 0:
+			err = sc.pathSource(s, opts.Paths)
+		default:
+			err = sc.walkSource(s)
+		}
+		if err != nil {
+			return sc, err
+		}
+	}
+	sc.complete = !sc.Report.Failed()
+	return sc, nil
+}
+
+// Commit return the commit grafted from the primary source, it's empty if
+// the working tree is grafted.
+func (sc *Scan) Commit() string {
+	if len(sc.sources) == 0 || sc.sources[0].tree == nil {
+		return ""
+	}
+	return sc.sources[0].tree.Commit()
+}
+
+// Close release processes reading git trees of sources.
+func (sc *Scan) Close() {
+	for _, s := range sc.sources {
+		if s.tree != nil {
+			s.tree.Close()
+		}
+	}
+}
+
+// walkSource collect DEST paths produced by files of source s.
+func (sc *Scan) walkSource(s *source) error {
+	walker := s.walker()
+	walkErr := make(chan error, 1)
+	go func(w util.FileWalker) {
+		walkErr <- w.Walk()
+	}(walker)
+
+	for item := range walker.Pipe() {
+		if item.Err != nil {
+			sc.Report.AddError(item.Err)
+			continue
+		}
+		if item.Info.IsDir() {
+			continue
+		}
+
+		rel, err := filepath.Rel(s.root, item.Path)
+		if err != nil {
+			sc.Report.AddError(err)
+			continue
+		}
+		c := &candidate{
+			src:    item.Path,
+			info:   item.Info,
+			source: s,
+		}
+		if fi, ok := item.Info.(*git.FileInfo); ok {
+			c.blob = fi.ID
+		}
+		destRel := sc.transformer.Rename(s.destRel(filepath.ToSlash(rel)))
+		sc.outputs[destRel] = append(sc.outputs[destRel], c)
+	}
+
+	return abortError(walker, <-walkErr)
+}
+
+// diffSource collect DEST paths produced by files of source s changed since
+// commit since, and DEST paths of files deleted or renamed since then.
+func (sc *Scan) diffSource(s *source, since string) error {
+	changes, err := s.tree.Changes(since)
+	if err != nil {
+		return err
+	}
+
+	if sc.deleted == nil {
+		sc.deleted = map[string]*source{}
+	}
+	for _, ch := range changes {
+		if ch.Status == 'D' || ch.Status == 'R' {
+			rel := ch.Path
+			if ch.Status == 'R' {
+				rel = ch.From
+			}
+			src := filepath.Join(s.root, filepath.FromSlash(rel))
+			ignored, err := s.ignored(src, ch.Old)
+			sc.Report.AddError(err)
+			if !ignored && err == nil {
+				sc.deleted[sc.transformer.Rename(s.destRel(rel))] = s
+			}
+		}
+		if ch.New == nil {
+			continue
+		}
+
+		src := filepath.Join(s.root, filepath.FromSlash(ch.Path))
+		ignored, err := s.ignored(src, ch.New)
+		sc.Report.AddError(err)
+		if ignored || err != nil {
+			continue
+		}
+		destRel := sc.transformer.Rename(s.destRel(ch.Path))
+		sc.outputs[destRel] = append(sc.outputs[destRel], &candidate{
+			src:    src,
+			info:   ch.New,
+			source: s,
+			blob:   ch.New.ID,
+		})
+	}
+	return nil
+}
+
+// pathSource collect DEST paths produced by files of source s under paths,
+// and DEST paths of files of s which don't exist any more.
+func (sc *Scan) pathSource(s *source, paths []string) error {
+	if sc.deleted == nil {
+		sc.deleted = map[string]*source{}
+	}
+	seen := map[string]bool{}
+	for _, p := range paths {
+		rel, err := filepath.Rel(s.root, p)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+
+		info, err := os.Lstat(p)
+		if os.IsNotExist(err) {
+			ignored, err := s.ignored(p, fileInfo{dirInfo(filepath.Base(p))})
+			sc.Report.AddError(err)
+			if !ignored && err == nil {
+				sc.deleted[sc.transformer.Rename(s.destRel(filepath.ToSlash(rel)))] = s
+			}
+			continue
+		}
+		if err != nil {
+			sc.Report.AddError(err)
+			continue
+		}
+		ignored, err := s.ignored(p, info)
+		sc.Report.AddError(err)
+		if ignored || err != nil {
+			continue
+		}
+
+		walker := util.NewWalker(p, s.checker, 10)
+		walkErr := make(chan error, 1)
+		go func(w util.FileWalker) {
+			walkErr <- w.Walk()
+		}(walker)
+		for item := range walker.Pipe() {
+			if item.Err != nil {
+				sc.Report.AddError(item.Err)
+				continue
+			}
+			if item.Info.IsDir() || seen[item.Path] {
+				continue
+			}
+			seen[item.Path] = true
+
+			rel, err := filepath.Rel(s.root, item.Path)
+			if err != nil {
+				sc.Report.AddError(err)
+				continue
+			}
+			destRel := sc.transformer.Rename(s.destRel(filepath.ToSlash(rel)))
+			sc.outputs[destRel] = append(sc.outputs[destRel], &candidate{
+				src:    item.Path,
+				info:   item.Info,
+				source: s,
+			})
+		}
+		if err := abortError(walker, <-walkErr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Plan compare the scan with destination dest and return the plan of graft.
+// Errors which do not stop the graft are collected into Report of plan, the
+// returned error means planning is aborted.
+func (sc *Scan) Plan(dest string) (*Plan, error) {
+	p := &Plan{
+		Mission: sc.M.Name,
+		Dest:    dest,
+		Report:  util.NewReport(),
+	}
+	if sc.opts.BaselineDir != "" {
+		p.Baseline = model.NewBaseline(sc.opts.BaselineDir, sc.M.Name, dest)
+	}
+
+	destChecker, err := IgnoreChain(sc.M, dest, sc.M.Ignore)
+	if err != nil {
+		return p, err
+	}
+
+	b := &builder{
+		scan:        sc,
+		plan:        p,
+		destChecker: destChecker,
+	}
+	b.compareOutputs()
+	if sc.deleted != nil {
+		b.checkDeleted()
+	} else if err := b.walkDest(); err != nil {
+		return p, err
+	}
+	b.detectRenames()
+
+	p.sort()
+	return p, nil
+}
+
+// Build walk all source roots and DEST of mission M, then return the plan of
+// graft.
+func Build(M *model.Mission, opts Options) (*Plan, error) {
+	sc, err := NewScan(M, opts)
+	if err != nil {
+		return &Plan{Mission: M.Name, Dest: M.Dest, Report: sc.Report}, err
+	}
+
+	p, err := sc.Plan(M.Dest)
+	for _, e := range sc.Report.Errors {
+		p.Report.AddError(e)
+	}
+	return p, err
+}
+
+// BuildAll walk all source roots of mission M once, then plan every
+// destination of M concurrently. Errors of scanning are in Report of scan.
+func BuildAll(M *model.Mission, opts Options) (*Scan, []*Plan, error) {
+	sc, err := NewScan(M, opts)
+	if err != nil {
+		return sc, nil, err
+	}
+
+	dests := M.Dests()
+	plans := make([]*Plan, len(dests))
+	errs := make([]error, len(dests))
+	var wg sync.WaitGroup
+	for i := range dests {
+		wg.Add(1)
+		go func(i int) {
+			plans[i], errs[i] = sc.Plan(dests[i])
+			wg.Done()
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return sc, plans, err
+		}
+	}
+	return sc, plans, nil
+}
+
+// builder plans a scan for one destination.
+type builder struct {
+	mu sync.Mutex
+
+	scan        *Scan
+	plan        *Plan
+	destChecker util.IgnoreSupport
+}
+
+func (b *builder) add(o *Operation) {
+	b.mu.Lock()
+	b.plan.Operations = append(b.plan.Operations, o)
+	b.mu.Unlock()
+}
+
+// compareOutputs compare each SRC file with its DEST file, and report DEST
+// files produced by more than one SRC file as conflicts.
+func (b *builder) compareOutputs() {
+	jobs := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < runtime.NumCPU(); i++ {
+		wg.Add(1)
+		go b.doCompare(&wg, jobs)
+	}
+
+	for rel := range b.scan.outputs {
+		jobs <- rel
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+func (b *builder) doCompare(wg *sync.WaitGroup, jobs <-chan string) {
+	var err error
+	for rel := range jobs {
+		candidates := b.scan.outputs[rel]
+		dest := filepath.Join(b.plan.Dest, filepath.FromSlash(rel))
+
+		if len(candidates) > 1 {
+			srcs := make([]string, 0, len(candidates))
+			for _, c := range candidates {
+				srcs = append(srcs, c.src)
+			}
+			b.add(&Operation{
+				Op:        OpConflict,
+				Rel:       rel,
+				Dest:      dest,
+				Conflicts: srcs,
+			})
+			b.plan.Report.AddError(&ConflictError{Rel: rel, Reason: fmt.Sprintf("produced by %v", srcs)})
+			continue
+		}
+
+		c := candidates[0]
+		o := &Operation{
+			Op:     OpModify,
+			Rel:    rel,
+			Dest:   dest,
+			Src:    c.src,
+			Source: c.source.root,
+			Mode:   c.info.Mode(),
+		}
+		if len(b.scan.transformer) > 0 {
+			// DEST is compared with the transformed content
+			f, err := b.scan.transformFile(c, rel, dest, b.plan.Baseline)
+			var ce *transform.ConflictError
+			if errors.As(err, &ce) {
+				b.add(&Operation{
+					Op:        OpConflict,
+					Rel:       rel,
+					Dest:      dest,
+					Src:       c.src,
+					Source:    c.source.root,
+					Conflicts: []string{c.src},
+					Reason:    ce.Error(),
+					Origin:    f.Origin,
+				})
+				b.plan.Report.AddError(err)
+				continue
+			}
+			if err != nil {
+				b.plan.Report.AddError(err)
+				continue
+			}
+			o.Data, o.Origin = f.Data, f.Origin
+		}
+		if util.IsNotExist(dest) {
+			o.Op = OpAdd
+		} else {
+			var isSame bool
+			if o.Data != nil {
+				isSame, err = compareContent(o.Data, dest)
+			} else {
+				isSame, err = compareFile(c, dest)
+			}
+			if err != nil {
+				b.plan.Report.AddError(err)
+				continue
+			}
+			if isSame && sameExecutable(c.info, dest) {
+				continue
+			}
+		}
+
+		// files of git tree can't be copied
+		if o.Data == nil && c.blob != "" {
+			if o.Data, err = c.read(); err != nil {
+				b.plan.Report.AddError(err)
+				continue
+			}
+		}
+		// merged files keep changes of DEST already
+		if o.Op == OpModify && o.Origin == nil {
+			if err := b.detectLocal(o); err != nil {
+				b.plan.Report.AddError(err)
+				continue
+			}
+		}
+		b.add(o)
+	}
+
+	wg.Done()
+}
+
+// detectLocal turns operation o into a conflict if its DEST file is changed
+// since it was grafted, only if Options.DetectLocal is set.
+func (b *builder) detectLocal(o *Operation) error {
+	if !b.scan.opts.DetectLocal || b.plan.Baseline == nil {
+		return nil
+	}
+	base, err := b.plan.Baseline.Read(o.Rel)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	same, err := compareContent(base, o.Dest)
+	if err != nil || same {
+		return err
+	}
+	o.Op = OpConflict
+	o.Reason = "DEST is changed since the last graft"
+	return nil
+}
+
+// transformFile return the content of SRC file of c transformed for DEST
+// file dest, base is the baseline of DEST which could be nil. The file is
+// returned with error of transformers, e.g. ConflictError.
+func (sc *Scan) transformFile(c *candidate, rel, dest string, base *model.Baseline) (*transform.File, error) {
+	data, err := c.read()
+	if err != nil {
+		return nil, err
+	}
+
+	f := &transform.File{
+		Rel:  rel,
+		Src:  c.src,
+		Dest: dest,
+		Data: data,
+	}
+	if base != nil {
+		f.Base = base.Path(rel)
+	}
+	if err := sc.transformer.Transform(f); err != nil {
+		return f, err
+	}
+	// nil Data means copying SRC file as it is
+	if f.Data == nil {
+		f.Data = []byte{}
+	}
+	return f, nil
+}
+
+// owner return the source whose sub directory is the longest prefix of DEST
+// path rel.
+func (sc *Scan) owner(rel string) *source {
+	var owner *source
+	for _, s := range sc.sources {
+		if s.owns(rel) && (owner == nil || len(s.sub) > len(owner.sub)) {
+			owner = s
+		}
+	}
+	return owner
+}
+
+// walkDest find DEST files which no SRC file is mapped to. Files ignored by
+// DEST, or whose SRC path is ignored by the owner source, are kept.
+func (b *builder) walkDest() error {
+	walker := util.NewWalker(b.plan.Dest, b.destChecker, 10)
+	walkErr := make(chan error, 1)
+	go func(w util.FileWalker) {
+		walkErr <- w.Walk()
+	}(walker)
+
+	var wg sync.WaitGroup
+	pipe := walker.Pipe()
+	for i := 0; i < runtime.NumCPU(); i++ {
+		wg.Add(1)
+		go b.doCheckDest(&wg, pipe)
+	}
+
+	wg.Wait()
+	return abortError(walker, <-walkErr)
+}
+
+func (b *builder) doCheckDest(wg *sync.WaitGroup, pipe <-chan *util.Item) {
+	for dest := range pipe {
+		if dest.Err != nil {
+			b.plan.Report.AddError(dest.Err)
+			continue
+		}
+		// directories are left, only files are removed
+		if dest.Info.IsDir() {
+			continue
+		}
+
+		rel, err := filepath.Rel(b.plan.Dest, dest.Path)
+		if err != nil {
+			b.plan.Report.AddError(err)
+			continue
+		}
+		rel = filepath.ToSlash(rel)
+		if _, ok := b.scan.outputs[rel]; ok {
+			continue
+		}
+
+		// files out of any source are not managed by graft
+		s := b.scan.owner(rel)
+		if s == nil {
+			continue
+		}
+
+		src, ok, err := s.srcPath(rel)
+		if err != nil {
+			// keep files which can't be traced back to SRC
+			b.plan.Report.AddError(fmt.Errorf("Keep %s: %v", dest.Path, err))
+			continue
+		}
+		if ok {
+			// file ignored in SRC is not managed by graft. A SRC file which
+			// is not ignored but absent in outputs is grafted to another
+			// path now, so its DEST file is stale.
+			info := dest.Info
+			if fi, err := os.Lstat(src); err == nil {
+				info = fi
+			}
+			ignored, err := s.ignored(src, info)
+			b.plan.Report.AddError(err)
+			if ignored || err != nil {
+				continue
+			}
+		}
+		// a SRC file may be missed by a walk which failed somewhere, its
+		// DEST file is only deleted if SRC is known to be absent.
+		if !b.scan.complete && !(ok && s.absent(src)) {
+			util.Logger.Warnf("Keep %s: sources are not walked completely.", dest.Path)
+			continue
+		}
+
+		o := &Operation{
+			Op:     OpDelete,
+			Rel:    rel,
+			Dest:   dest.Path,
+			Source: s.root,
+		}
+		if err := b.detectLocal(o); err != nil {
+			b.plan.Report.AddError(err)
+			continue
+		}
+		b.add(o)
+	}
+
+	wg.Done()
+}
+
+// checkDeleted removes DEST files of SRC files deleted since the last graft,
+// instead of walking the whole DEST.
+func (b *builder) checkDeleted() {
+	for rel, s := range b.scan.deleted {
+		if _, ok := b.scan.outputs[rel]; ok {
+			continue
+		}
+		dest := filepath.Join(b.plan.Dest, filepath.FromSlash(rel))
+		fi, err := os.Lstat(dest)
+		if err != nil || fi.IsDir() {
+			continue
+		}
+		ignored, err := ignoredUnder(b.destChecker, b.plan.Dest, dest, fi)
+		b.plan.Report.AddError(err)
+		if ignored || err != nil {
+			continue
+		}
+
+		o := &Operation{
+			Op:     OpDelete,
+			Rel:    rel,
+			Dest:   dest,
+			Source: s.root,
+		}
+		if err := b.detectLocal(o); err != nil {
+			b.plan.Report.AddError(err)
+			continue
+		}
+		b.add(o)
+	}
+}
+
+// abortError return the error of walker which should abort the graft.
+func abortError(w util.FileWalker, err error) error {
+	if err == nil {
+		return nil
+	}
+	if util.IsAbort(err) {
+		return err
+	}
+	// other errors have been sent through pipe and collected already
+	util.Errorf("Walker[%s] error: %v.", w.Dir(), err)
+	return nil
+}
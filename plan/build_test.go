@@ -0,0 +1,236 @@
+// Copyright © 2018 Mephis Pheies <mephistommm@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package plan
+
+import (
+	"os"
+	"testing"
+
+	"github.com/MephistoMMM/grafter/model"
+)
+
+func TestPlanSources(t *testing.T) {
+	tests := []struct {
+		name string
+		src  map[string]*string
+		lib  map[string]*string
+		dest map[string]*string
+		want map[string]Op
+		// conflicts are reported as errors too
+		errors int
+	}{
+		{
+			name: "files of every source are added",
+			src:  map[string]*string{"a": content("a")},
+			lib:  map[string]*string{"b": content("b")},
+			want: map[string]Op{"a": OpAdd, "vendor/lib/b": OpAdd},
+		},
+		{
+			name: "changed files are modified",
+			src:  map[string]*string{"a": content("new")},
+			lib:  map[string]*string{"b": content("b")},
+			dest: map[string]*string{"a": content("old"), "vendor/lib/b": content("b")},
+			want: map[string]Op{"a": OpModify},
+		},
+		{
+			name: "files are deleted by the source owning them",
+			src:  map[string]*string{"a": content("a")},
+			lib:  map[string]*string{"b": content("b")},
+			dest: map[string]*string{"a": content("a"), "gone": content("x"), "vendor/lib/b": content("b"), "vendor/lib/gone": content("x")},
+			want: map[string]Op{"gone": OpDelete, "vendor/lib/gone": OpDelete},
+		},
+		{
+			name:   "outputs of several sources conflict",
+			src:    map[string]*string{"vendor/lib/b": content("from src")},
+			lib:    map[string]*string{"b": content("from lib")},
+			want:   map[string]Op{"vendor/lib/b": OpConflict},
+			errors: 1,
+		},
+		{
+			name: "files ignored in SRC are not deleted",
+			src:  map[string]*string{"a": content("a"), "skip.log": content("log")},
+			lib:  map[string]*string{"b": content("b")},
+			dest: map[string]*string{"a": content("a"), "skip.log": content("old"), "vendor/lib/b": content("b")},
+			want: map[string]Op{},
+		},
+	}
+
+	for _, tt := range tests {
+		f := newFixture(t)
+		f.write(prefixed("src/", tt.src))
+		f.write(prefixed("lib/", tt.lib))
+		f.write(prefixed("dest/", tt.dest))
+
+		M := f.mission()
+		M.Ignore = []string{`\.log$`}
+		M.Sources = []model.Source{{Path: f.path("lib"), Sub: "vendor/lib"}}
+		p, err := Build(M, f.options())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(p.Report.Errors) != tt.errors {
+			t.Errorf("%s: errors %v, want %d", tt.name, p.Report.Errors, tt.errors)
+		}
+		if !sameOperations(p, tt.want) {
+			t.Errorf("%s: planned %v, want %v", tt.name, operations(p), tt.want)
+		}
+		f.cleanup()
+	}
+}
+
+func TestPlanDeleteAfterFailedWalk(t *testing.T) {
+	tests := []struct {
+		name   string
+		broken bool
+		want   map[string]Op
+	}{
+		// DEST file of old mapping is stale only if SRC is walked completely
+		{name: "complete walk", want: map[string]Op{"old/a": OpDelete}},
+		{name: "failed walk", broken: true, want: map[string]Op{}},
+	}
+
+	for _, tt := range tests {
+		f := newFixture(t)
+		f.write(map[string]*string{
+			"src/old/a":  content("a"),
+			"dest/new/a": content("a"),
+			"dest/old/a": content("a"),
+		})
+		if tt.broken {
+			// .gitignore can't be read, every path fails to be checked
+			os.MkdirAll(f.path("src/.gitignore"), 0755)
+		}
+
+		M := f.mission()
+		M.Mappings = []model.Mapping{{Src: "old", Dest: "new"}}
+		M.OnError = map[string]string{"gitignore": "fail-open"}
+		sc, plans, err := BuildAll(M, f.options())
+		if err != nil {
+			t.Fatal(err)
+		}
+		sc.Close()
+		if failed := len(sc.Report.Errors) > 0; failed != tt.broken {
+			t.Errorf("%s: scan errors %v", tt.name, sc.Report.Errors)
+		}
+		if !sameOperations(plans[0], tt.want) {
+			t.Errorf("%s: planned %v, want %v", tt.name, operations(plans[0]), tt.want)
+		}
+		f.cleanup()
+	}
+}
+
+func TestPlanDestIgnored(t *testing.T) {
+	f := newFixture(t)
+	defer f.cleanup()
+	f.write(map[string]*string{"src/a.log": content("a\n"), "src/b": content("b\n")})
+	M := f.mission()
+	f.graft(M)
+
+	// DEST starts ignoring a.log, which is removed from SRC then
+	f.write(map[string]*string{
+		"dest/.gitignore": content("*.log\n"),
+		"src/a.log":       nil,
+		"src/b":           nil,
+	})
+	p, err := Build(M, f.options())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]Op{"b": OpDelete}; !sameOperations(p, want) {
+		t.Errorf("planned %v, want %v", operations(p), want)
+	}
+	Apply(p)
+	if f.read("dest/a.log") == nil {
+		t.Error("file ignored by DEST is deleted")
+	}
+}
+
+func TestPlanTargets(t *testing.T) {
+	f := newFixture(t)
+	defer f.cleanup()
+	f.write(map[string]*string{
+		"src/a":   content("a"),
+		"dest/a":  content("a"),
+		"other/a": content("old"),
+	})
+	os.MkdirAll(f.path("new"), 0755)
+	M := f.mission()
+	M.Targets = []string{f.path("other"), f.path("new")}
+
+	sc, plans, err := BuildAll(M, f.options())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sc.Close()
+	want := []map[string]Op{{}, {"a": OpModify}, {"a": OpAdd}}
+	for i, p := range plans {
+		if p.Dest != M.Dests()[i] || !sameOperations(p, want[i]) {
+			t.Errorf("plan of %s = %v, want %v", p.Dest, operations(p), want[i])
+		}
+	}
+}
+
+// prefixed return files with prefix added to their paths.
+func TestPlanPaths(t *testing.T) {
+	f := newFixture(t)
+	defer f.cleanup()
+	f.write(map[string]*string{
+		"src/a":     content("a"),
+		"src/b":     content("b"),
+		"src/dir/c": content("c"),
+		"src/dir/d": content("d"),
+		"src/gone":  content("e"),
+	})
+	M := f.mission()
+	f.graft(M)
+
+	f.write(map[string]*string{
+		"src/a":     content("new a"),
+		"src/b":     content("new b"),
+		"src/dir/c": nil,
+		"src/dir/d": content("new d"),
+		"src/dir/e": content("a new file\nof several lines\n"),
+		"src/gone":  nil,
+	})
+	opts := f.options()
+	opts.Paths = []string{f.path("src/a"), f.path("src/dir"), f.path("src/dir/c"), f.path("src/gone"), f.path("other/a")}
+	p, err := Build(M, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// b is changed but not in paths, paths out of sources are skipped
+	want := map[string]Op{"a": OpModify, "dir/c": OpDelete, "dir/d": OpModify, "dir/e": OpAdd, "gone": OpDelete}
+	if !sameOperations(p, want) {
+		t.Errorf("planned %v, want %v", operations(p), want)
+	}
+
+	opts.SrcRev = "HEAD"
+	if _, err := Build(M, opts); err == nil {
+		t.Error("paths are planned in git revision")
+	}
+}
+
+func prefixed(prefix string, files map[string]*string) map[string]*string {
+	out := map[string]*string{}
+	for rel, data := range files {
+		out[prefix+rel] = data
+	}
+	return out
+}
@@ -0,0 +1,95 @@
+// Copyright © 2018 Mephis Pheies <mephistommm@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package plan
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"github.com/MephistoMMM/grafter/git"
+	"github.com/MephistoMMM/grafter/util"
+)
+
+// compareFile reports whether DEST file dest has the same content with SRC
+// file of candidate c.
+func compareFile(c *candidate, dest string) (bool, error) {
+	destFi, err := os.Lstat(dest)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if !destFi.Mode().IsRegular() || c.info.Size() != destFi.Size() {
+		return false, nil
+	}
+
+	if c.blob != "" {
+		// files of git tree are compared by object id
+		destID, err := git.HashFile(dest)
+		return destID == c.blob, err
+	}
+	srcSum, err := c.hash()
+	if err != nil {
+		return false, fmt.Errorf("Failed to read source file %s: %v", c.src, err)
+	}
+	destSum, err := util.HashFile(dest)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(srcSum, destSum), nil
+}
+
+// compareContent reports whether DEST file dest has the content data.
+func compareContent(data []byte, dest string) (bool, error) {
+	destFi, err := os.Lstat(dest)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if !destFi.Mode().IsRegular() || int64(len(data)) != destFi.Size() {
+		return false, nil
+	}
+
+	destData, err := util.ReadFile(dest)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(data, destData), nil
+}
+
+// sameExecutable reports whether DEST file dest is executable as same as SRC
+// file of info.
+func sameExecutable(info os.FileInfo, dest string) bool {
+	destFi, err := os.Stat(dest)
+	if err != nil {
+		return true
+	}
+	return isExecutable(info.Mode()) == isExecutable(destFi.Mode())
+}
+
+func isExecutable(mode os.FileMode) bool {
+	return mode&0111 != 0
+}
@@ -0,0 +1,270 @@
+// Copyright © 2018 Mephis Pheies <mephistommm@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package plan
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/MephistoMMM/grafter/git"
+	"github.com/MephistoMMM/grafter/util"
+)
+
+// diffContext is the number of context lines around changes.
+const diffContext = 3
+
+// WriteDiff write operations of p as a git style patch relative to Dest,
+// which could be applied by `git apply`. Conflicts are not written.
+func (p *Plan) WriteDiff(w io.Writer) error {
+	for _, o := range p.Operations {
+		if o.Op == OpConflict {
+			continue
+		}
+		if err := p.WriteOperationDiff(w, o); err != nil {
+			return fmt.Errorf("Failed to diff %s: %v", o.Rel, err)
+		}
+	}
+	return nil
+}
+
+// side is a version of file in the patch.
+type side struct {
+	exists bool
+	mode   string
+	data   []byte
+}
+
+// oldSide return the DEST file before o is applied.
+func (p *Plan) oldSide(o *Operation) (side, error) {
+	if o.Op == OpAdd {
+		return side{}, nil
+	}
+	path := o.Dest
+	if o.Op == OpMove {
+		path = filepath.Join(p.Dest, filepath.FromSlash(o.From))
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return side{}, err
+	}
+	data, err := util.ReadFile(path)
+	if err != nil {
+		return side{}, err
+	}
+	return side{true, gitMode(fi.Mode()), data}, nil
+}
+
+// newSide return the DEST file after o is applied, old is the DEST file
+// before.
+func newSide(o *Operation, old side) (side, error) {
+	if o.Op == OpDelete {
+		return side{}, nil
+	}
+	if o.Op == OpMove && o.Src == "" {
+		return side{true, gitMode(o.Mode), old.data}, nil
+	}
+	data := o.Data
+	if data == nil {
+		var err error
+		if data, err = util.ReadFile(o.Src); err != nil {
+			return side{}, err
+		}
+	}
+	return side{true, gitMode(o.Mode), data}, nil
+}
+
+// WriteOperationDiff write the diff of operation o of plan in git format.
+func (p *Plan) WriteOperationDiff(w io.Writer, o *Operation) error {
+	old, err := p.oldSide(o)
+	if err != nil {
+		return err
+	}
+	cur, err := newSide(o, old)
+	if err != nil {
+		return err
+	}
+
+	from := o.Rel
+	if o.Op == OpMove {
+		from = o.From
+	}
+	a, b := quotePath("a/"+from), quotePath("b/"+o.Rel)
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "diff --git %s %s\n", a, b)
+	switch {
+	case !old.exists:
+		fmt.Fprintf(buf, "new file mode %s\n", cur.mode)
+	case !cur.exists:
+		fmt.Fprintf(buf, "deleted file mode %s\n", old.mode)
+	case old.mode != cur.mode:
+		fmt.Fprintf(buf, "old mode %s\nnew mode %s\n", old.mode, cur.mode)
+	}
+	if o.Op == OpMove {
+		fmt.Fprintf(buf, "similarity index %d%%\nrename from %s\nrename to %s\n",
+			similarity(old.data, cur.data), quotePath(o.From), quotePath(o.Rel))
+	}
+
+	if old.exists && cur.exists && bytes.Equal(old.data, cur.data) {
+		// only mode is changed
+		_, err = w.Write(buf.Bytes())
+		return err
+	}
+
+	fmt.Fprintf(buf, "index %s..%s", blobID(old), blobID(cur))
+	if old.exists && cur.exists && old.mode == cur.mode {
+		fmt.Fprintf(buf, " %s", cur.mode)
+	}
+	buf.WriteString("\n")
+
+	if util.IsBinary(old.data) || util.IsBinary(cur.data) {
+		buf.WriteString("GIT binary patch\n")
+		if err := writeBinaryLiteral(buf, cur.data); err != nil {
+			return err
+		}
+		if err := writeBinaryLiteral(buf, old.data); err != nil {
+			return err
+		}
+		_, err = w.Write(buf.Bytes())
+		return err
+	}
+
+	if old.exists {
+		fmt.Fprintf(buf, "--- %s\n", a)
+	} else {
+		buf.WriteString("--- /dev/null\n")
+	}
+	if cur.exists {
+		fmt.Fprintf(buf, "+++ %s\n", b)
+	} else {
+		buf.WriteString("+++ /dev/null\n")
+	}
+	if err := util.WriteUnified(buf, old.data, cur.data, diffContext); err != nil {
+		return err
+	}
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+// gitMode return the mode of regular file recorded by git.
+func gitMode(mode os.FileMode) string {
+	if isExecutable(mode) {
+		return "100755"
+	}
+	return "100644"
+}
+
+// blobID return the object name of git blob, which is zeros for absent file.
+func blobID(s side) string {
+	if !s.exists {
+		return strings.Repeat("0", 40)
+	}
+	return git.BlobID(s.data)
+}
+
+// quotePath quote path like git does if it has special characters.
+func quotePath(path string) string {
+	if !strings.ContainsAny(path, "\"\\") && !hasSpecialByte(path) {
+		return path
+	}
+
+	buf := &strings.Builder{}
+	buf.WriteByte('"')
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		switch {
+		case c == '"' || c == '\\':
+			buf.WriteByte('\\')
+			buf.WriteByte(c)
+		case c == '\t':
+			buf.WriteString(`\t`)
+		case c == '\n':
+			buf.WriteString(`\n`)
+		case c < 0x20 || c >= 0x7f:
+			fmt.Fprintf(buf, "\\%03o", c)
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	buf.WriteByte('"')
+	return buf.String()
+}
+
+func hasSpecialByte(path string) bool {
+	for i := 0; i < len(path); i++ {
+		if path[i] < 0x20 || path[i] >= 0x7f {
+			return true
+		}
+	}
+	return false
+}
+
+// base85 is the alphabet of git binary patch.
+const base85 = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz!#$%&()*+-;<=>?@^_`{|}~"
+
+// writeBinaryLiteral write data as a literal hunk of git binary patch, which
+// is deflated and encoded by base85 in lines of 52 bytes.
+func writeBinaryLiteral(buf *bytes.Buffer, data []byte) error {
+	deflated := &bytes.Buffer{}
+	zw := zlib.NewWriter(deflated)
+	if _, err := zw.Write(data); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(buf, "literal %d\n", len(data))
+	z := deflated.Bytes()
+	for len(z) > 0 {
+		n := len(z)
+		if n > 52 {
+			n = 52
+		}
+		if n <= 26 {
+			buf.WriteByte(byte('A' + n - 1))
+		} else {
+			buf.WriteByte(byte('a' + n - 27))
+		}
+		for i := 0; i < n; i += 4 {
+			var acc uint32
+			for j := 0; j < 4; j++ {
+				acc <<= 8
+				if i+j < n {
+					acc |= uint32(z[i+j])
+				}
+			}
+			var enc [5]byte
+			for j := 4; j >= 0; j-- {
+				enc[j] = base85[acc%85]
+				acc /= 85
+			}
+			buf.Write(enc[:])
+		}
+		buf.WriteByte('\n')
+		z = z[n:]
+	}
+	buf.WriteByte('\n')
+	return nil
+}
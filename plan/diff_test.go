@@ -0,0 +1,176 @@
+// Copyright © 2018 Mephis Pheies <mephistommm@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package plan
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+// gitApply applies patch to dir by git after checking it.
+func gitApply(t *testing.T, dir string, patch []byte) {
+	for _, args := range [][]string{{"apply", "--check", "-"}, {"apply", "-"}} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Stdin = bytes.NewReader(patch)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %s: %v\n%s\n%s", strings.Join(args, " "), err, out, patch)
+		}
+	}
+}
+
+func TestWriteDiff(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	f := newFixture(t)
+	defer f.cleanup()
+
+	long := ""
+	for i := 0; i < 20; i++ {
+		long += "line\n"
+	}
+	f.write(map[string]*string{
+		"src/text":        content("a\nB\nc\n" + long + "x\nY\n"),
+		"src/eof":         content("a\nc"),
+		"src/new":         content("new\n"),
+		"src/run.sh":      content("#!/bin/sh\n"),
+		"src/tool.sh":     content("#!/bin/sh\n"),
+		"src/image.bin":   content("\x00\x01\x02new"),
+		"src/say \"hi\"":  content("a\n"),
+		"dest/text":       content("a\nb\nc\n" + long + "x\ny\n"),
+		"dest/eof":        content("a\nb"),
+		"dest/gone":       content("gone\n"),
+		"dest/tool.sh":    content("#!/bin/sh\n"),
+		"dest/image.bin":  content("\x00\x01\x02old"),
+		"dest/same":       content("same\n"),
+		"src/same":        content("same\n"),
+		"dest/say \"hi\"": content("b\n"),
+		"dest/gone.bin":   content("\x00gone"),
+	})
+	for _, rel := range []string{"src/run.sh", "src/tool.sh"} {
+		if err := os.Chmod(f.path(rel), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	M := f.mission()
+	p, err := Build(M, f.options())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := p.WriteDiff(&buf); err != nil {
+		t.Fatal(err)
+	}
+	patch := buf.String()
+
+	for _, want := range []string{
+		// hunks around both changes
+		"--- a/text\n+++ b/text\n@@ -1,5 +1,5 @@\n a\n-b\n+B\n c\n",
+		"@@ -22,4 +22,4 @@\n line\n line\n x\n-y\n+Y\n",
+		"-b\n\\ No newline at end of file\n+c\n\\ No newline at end of file\n",
+		"diff --git a/new b/new\nnew file mode 100644\nindex 0000000000000000000000000000000000000000..",
+		"--- /dev/null\n+++ b/new\n@@ -0,0 +1 @@\n+new\n",
+		"diff --git a/gone b/gone\ndeleted file mode 100644\n",
+		"--- a/gone\n+++ /dev/null\n@@ -1 +0,0 @@\n-gone\n",
+		"diff --git a/run.sh b/run.sh\nnew file mode 100755\n",
+		"diff --git a/tool.sh b/tool.sh\nold mode 100644\nnew mode 100755\n",
+		"diff --git a/image.bin b/image.bin\nindex ",
+		"GIT binary patch\nliteral 6\n",
+		"diff --git a/gone.bin b/gone.bin\ndeleted file mode 100644\n",
+		"diff --git \"a/say \\\"hi\\\"\" \"b/say \\\"hi\\\"\"\n",
+	} {
+		if !strings.Contains(patch, want) {
+			t.Errorf("patch doesn't contain %q:\n%s", want, patch)
+		}
+	}
+	// only mode of tool.sh is changed
+	tool := patch[strings.Index(patch, "a/tool.sh"):]
+	if next := strings.Index(tool, "diff --git"); next >= 0 {
+		tool = tool[:next]
+	}
+	if strings.Contains(tool, "index ") {
+		t.Errorf("content of tool.sh is in patch:\n%s", tool)
+	}
+	if strings.Contains(patch, "a/same") {
+		t.Errorf("unchanged file is in patch:\n%s", patch)
+	}
+
+	gitApply(t, f.path("dest"), buf.Bytes())
+	for _, rel := range []string{"text", "eof", "new", "run.sh", "tool.sh", "image.bin", `say "hi"`} {
+		if got, want := f.read("dest/"+rel), f.read("src/"+rel); *got != *want {
+			t.Errorf("%s: got %q, want %q", rel, *got, *want)
+		}
+	}
+	for _, rel := range []string{"gone", "gone.bin"} {
+		if f.read("dest/"+rel) != nil {
+			t.Errorf("%s is not deleted", rel)
+		}
+	}
+	fi, err := os.Stat(f.path("dest/tool.sh"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode()&0100 == 0 {
+		t.Errorf("tool.sh is not executable: %v", fi.Mode())
+	}
+}
+
+func TestWriteDiffRename(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	f := newFixture(t)
+	defer f.cleanup()
+
+	const grafted = "line 1\nline 2\nline 3\nline 4\n"
+	f.write(map[string]*string{"src/old": content(grafted)})
+	M := f.mission()
+	f.graft(M)
+	f.write(map[string]*string{
+		"src/old": nil,
+		"src/new": content(grafted + "line 5\n"),
+	})
+
+	p, err := Build(M, f.options())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := p.WriteDiff(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want := "diff --git a/old b/new\nsimilarity index 80%\nrename from old\nrename to new\n"
+	if !strings.HasPrefix(buf.String(), want) || !strings.Contains(buf.String(), "--- a/old\n+++ b/new\n") {
+		t.Fatalf("patch of rename:\n%s", buf.String())
+	}
+
+	gitApply(t, f.path("dest"), buf.Bytes())
+	if got := f.read("dest/new"); got == nil || *got != grafted+"line 5\n" {
+		t.Errorf("new DEST file is %v", got)
+	}
+	if f.read("dest/old") != nil {
+		t.Error("DEST file moved from is left")
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright © 2018 Mephis Pheies <mephistommm@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package plan
+
+import (
+	"github.com/MephistoMMM/grafter/model"
+	"github.com/MephistoMMM/grafter/util"
+)
+
+// IgnoreChain create the chain of IgnoreSupports for root, which is a source
+// root or DEST of mission. Regexps in ignore are matched against paths
+// relative to root, error policies are read from mission.
+func IgnoreChain(M *model.Mission, root string, ignore []string) (util.IgnoreSupport, error) {
+	withPolicy := func(name string, is util.IgnoreSupport) (util.IgnoreSupport, error) {
+		policy, err := M.ErrorPolicy(name)
+		if err != nil {
+			return nil, err
+		}
+		is.SetPolicy(policy)
+		return is, nil
+	}
+
+	var checker, tail util.IgnoreSupport
+	tail, err := util.NewIgnoreDotSupport()
+	if err != nil {
+		return nil, err
+	}
+	if checker, err = withPolicy("dot", tail); err != nil {
+		return nil, err
+	}
+
+	ignoreUnregular, err := util.NewIgnoreUnregularSupport()
+	if err != nil {
+		return nil, err
+	}
+	if _, err = withPolicy("unregular", ignoreUnregular); err != nil {
+		return nil, err
+	}
+	tail = tail.SetNext(ignoreUnregular)
+
+	// gitignore support ignores filepath matched patterns in .gitignore
+	gitIgnore, err := util.NewGitIgnoreSupport(root)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = withPolicy("gitignore", gitIgnore); err != nil {
+		return nil, err
+	}
+	tail = tail.SetNext(gitIgnore)
+
+	// create regexp match supports from ignore field
+	regexpMatches, err := util.NewMultiIgnoreRegexpMatchSupports(root, ignore)
+	if err != nil {
+		return nil, err
+	}
+	for _, is := range regexpMatches {
+		if _, err = withPolicy("regexp", is); err != nil {
+			return nil, err
+		}
+	}
+	tail.SetNexts(regexpMatches)
+
+	return checker, nil
+}
@@ -0,0 +1,161 @@
+// Copyright © 2018 Mephis Pheies <mephistommm@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+//
+// Package plan computes the changes a graft makes to DEST, and applies them.
+package plan
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/MephistoMMM/grafter/model"
+	"github.com/MephistoMMM/grafter/transform"
+	"github.com/MephistoMMM/grafter/util"
+)
+
+// Op is the kind of Operation
+type Op int
+
+const (
+	// OpAdd copies a SRC file which doesn't exist in DEST.
+	OpAdd Op = iota
+	// OpModify overwrites a DEST file by different SRC file.
+	OpModify
+	// OpDelete removes a DEST file which no SRC file is mapped to.
+	OpDelete
+	// OpConflict marks a DEST file produced by more than one SRC file, it is
+	// never applied.
+	OpConflict
+	// OpMove moves a DEST file whose SRC file is renamed, then overwrites it
+	// by the SRC file unless DEST changes are kept.
+	OpMove
+)
+
+var opNames = map[Op]string{
+	OpAdd:      "add",
+	OpModify:   "modify",
+	OpDelete:   "delete",
+	OpConflict: "conflict",
+	OpMove:     "move",
+}
+
+// String return the name of op
+func (op Op) String() string {
+	return opNames[op]
+}
+
+// Operation is a change to a DEST file.
+type Operation struct {
+	Op Op
+	// Rel is the slash separated path relative to DEST.
+	Rel  string
+	Dest string
+	// Src is the SRC file of add and modify, it's empty for delete.
+	Src string
+	// Source is the path of source root which owns the file.
+	Source string
+	// Conflicts are SRC files producing the same DEST file.
+	Conflicts []string
+	// Origin is the content recorded as baseline instead of Data.
+	Origin []byte
+	// Reason describes the conflict which is not caused by paths.
+	Reason string
+	// Data is the transformed content written to DEST, the SRC file is
+	// copied as it is if Data is nil.
+	Data []byte
+	// Mode is the mode of SRC file of add and modify, only the executable
+	// bits are grafted.
+	Mode os.FileMode
+	// From is the slash separated path relative to DEST which the file is
+	// moved from, Src is empty if the DEST file is moved as it is.
+	From string
+	// BaseRel is the DEST path whose baseline is recorded instead of Rel,
+	// it's set by reverse graft whose Rel is relative to SRC.
+	BaseRel string
+}
+
+// String ...
+func (o *Operation) String() string {
+	if o.Op == OpConflict && o.Reason != "" {
+		return fmt.Sprintf("%s %s: %s", o.Op, o.Rel, o.Reason)
+	}
+	if o.Op == OpConflict {
+		return fmt.Sprintf("%s %s <- %v", o.Op, o.Rel, o.Conflicts)
+	}
+	if o.Op == OpMove {
+		return fmt.Sprintf("%s %s -> %s", o.Op, o.From, o.Rel)
+	}
+	return fmt.Sprintf("%s %s", o.Op, o.Rel)
+}
+
+// ConflictError is reported for DEST file Rel planned as OpConflict.
+type ConflictError struct {
+	Rel    string
+	Reason string
+}
+
+// Error ...
+func (ce *ConflictError) Error() string {
+	return fmt.Sprintf("Conflict on %s: %s", ce.Rel, ce.Reason)
+}
+
+// IsConflict reports whether err is a conflict of file planned as OpConflict,
+// instead of a failure of walking, reading or transforming.
+func IsConflict(err error) bool {
+	var pce *ConflictError
+	var tce *transform.ConflictError
+	return errors.As(err, &pce) || errors.As(err, &tce)
+}
+
+// Plan holds all operations of a graft, sorted by Rel.
+type Plan struct {
+	Mission    string
+	Dest       string
+	Operations []*Operation
+	// Baseline records the content grafted into Dest, it could be nil.
+	Baseline *model.Baseline
+
+	// Report collects errors while building and applying plan.
+	Report *util.Report
+}
+
+// Count return the number of operations of each Op.
+func (p *Plan) Count() map[Op]int {
+	count := map[Op]int{}
+	for _, o := range p.Operations {
+		count[o.Op]++
+	}
+	return count
+}
+
+// Summary describe the numbers of operations in one line.
+func (p *Plan) Summary() string {
+	count := p.Count()
+	return fmt.Sprintf("%d added, %d modified, %d moved, %d deleted, %d conflicted",
+		count[OpAdd], count[OpModify], count[OpMove], count[OpDelete], count[OpConflict])
+}
+
+func (p *Plan) sort() {
+	sort.Slice(p.Operations, func(i, j int) bool {
+		return p.Operations[i].Rel < p.Operations[j].Rel
+	})
+}
@@ -0,0 +1,141 @@
+// Copyright © 2018 Mephis Pheies <mephistommm@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package plan
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/MephistoMMM/grafter/model"
+)
+
+// fixture is a temporary directory holding SRC, DEST and baselines.
+type fixture struct {
+	t   *testing.T
+	dir string
+}
+
+func newFixture(t *testing.T) *fixture {
+	dir, err := ioutil.TempDir("", "grafter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &fixture{t: t, dir: dir}
+}
+
+func (f *fixture) cleanup() {
+	os.RemoveAll(f.dir)
+}
+
+// path return the path of slash separated rel under fixture.
+func (f *fixture) path(rel string) string {
+	return filepath.Join(f.dir, filepath.FromSlash(rel))
+}
+
+// write writes files under fixture, a nil content removes the file.
+func (f *fixture) write(files map[string]*string) {
+	for rel, data := range files {
+		if data == nil {
+			if err := os.Remove(f.path(rel)); err != nil {
+				f.t.Fatal(err)
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(f.path(rel)), 0755); err != nil {
+			f.t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(f.path(rel), []byte(*data), 0644); err != nil {
+			f.t.Fatal(err)
+		}
+	}
+}
+
+// read return the content of rel, it's nil if rel doesn't exist.
+func (f *fixture) read(rel string) *string {
+	data, err := ioutil.ReadFile(f.path(rel))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	s := string(data)
+	return &s
+}
+
+// mission return a mission grafting src into dest of fixture, dest is
+// created if it doesn't exist.
+func (f *fixture) mission() *model.Mission {
+	if err := os.MkdirAll(f.path("dest"), 0755); err != nil {
+		f.t.Fatal(err)
+	}
+	return &model.Mission{
+		Name: "test",
+		Src:  f.path("src"),
+		Dest: f.path("dest"),
+	}
+}
+
+// options return Options keeping baselines in fixture.
+func (f *fixture) options() Options {
+	return Options{BaselineDir: f.path("baseline")}
+}
+
+// graft plans and applies M, the plan must have no errors.
+func (f *fixture) graft(M *model.Mission) *Plan {
+	p, err := Build(M, f.options())
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	Apply(p)
+	if len(p.Report.Errors) > 0 {
+		f.t.Fatalf("graft failed: %v", p.Report.Errors)
+	}
+	return p
+}
+
+func content(s string) *string {
+	return &s
+}
+
+// operations return the operations of p by Rel.
+func operations(p *Plan) map[string]Op {
+	ops := map[string]Op{}
+	for _, o := range p.Operations {
+		ops[o.Rel] = o.Op
+	}
+	return ops
+}
+
+// sameOperations reports whether p has exactly operations want.
+func sameOperations(p *Plan, want map[string]Op) bool {
+	got := operations(p)
+	if len(got) != len(want) {
+		return false
+	}
+	for rel, op := range want {
+		if o, ok := got[rel]; !ok || o != op {
+			return false
+		}
+	}
+	return true
+}
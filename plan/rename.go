@@ -0,0 +1,198 @@
+// Copyright © 2018 Mephis Pheies <mephistommm@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package plan
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/MephistoMMM/grafter/util"
+)
+
+const (
+	// renameScore is the least similarity percent of a rename, like git.
+	renameScore = 50
+	// maxRenamePairs limits the number of file pairs compared.
+	maxRenamePairs = 1 << 16
+)
+
+// renameSide is the content of a file deleted or added by plan.
+type renameSide struct {
+	o    *Operation
+	data []byte
+}
+
+// renamePair is a deleted file and an added file of similar content.
+type renamePair struct {
+	del, add *renameSide
+	score    int
+}
+
+// detectRenames pairs DEST files to be deleted with DEST files to be added
+// whose content is similar, and turns each pair into a move. The content
+// grafted last time, which is in the baseline, is compared with the new SRC
+// content, so a DEST file changed since then is moved with its changes if SRC
+// only renamed it.
+func (b *builder) detectRenames() {
+	var dels, adds []*renameSide
+	for _, o := range b.plan.Operations {
+		switch {
+		case o.Op == OpAdd:
+			data, err := srcContent(o)
+			if err != nil {
+				b.plan.Report.AddError(err)
+				continue
+			}
+			if len(data) > 0 {
+				adds = append(adds, &renameSide{o, data})
+			}
+		case o.Src == "" && len(o.Conflicts) == 0 && (o.Op == OpDelete || o.Op == OpConflict):
+			data, err := b.graftedContent(o)
+			if err != nil {
+				b.plan.Report.AddError(err)
+				continue
+			}
+			if len(data) > 0 {
+				dels = append(dels, &renameSide{o, data})
+			}
+		}
+	}
+	if len(dels) == 0 || len(adds) == 0 {
+		return
+	}
+	if len(dels)*len(adds) > maxRenamePairs {
+		util.Debugf("Skip rename detection of %d deleted and %d added files.", len(dels), len(adds))
+		return
+	}
+
+	var pairs []renamePair
+	for _, d := range dels {
+		for _, a := range adds {
+			if score := similarity(d.data, a.data); score >= renameScore {
+				pairs = append(pairs, renamePair{d, a, score})
+			}
+		}
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i].score != pairs[j].score {
+			return pairs[i].score > pairs[j].score
+		}
+		if pairs[i].add.o.Rel != pairs[j].add.o.Rel {
+			return pairs[i].add.o.Rel < pairs[j].add.o.Rel
+		}
+		return pairs[i].del.o.Rel < pairs[j].del.o.Rel
+	})
+
+	// deletions moved from are dropped
+	paired, dropped := map[*Operation]bool{}, map[*Operation]bool{}
+	for _, pair := range pairs {
+		if paired[pair.del.o] || paired[pair.add.o] {
+			continue
+		}
+		paired[pair.del.o], paired[pair.add.o] = true, true
+		if err := b.move(pair.del, pair.add); err != nil {
+			b.plan.Report.AddError(err)
+			continue
+		}
+		dropped[pair.del.o] = true
+	}
+
+	ops := b.plan.Operations[:0]
+	for _, o := range b.plan.Operations {
+		if !dropped[o] {
+			ops = append(ops, o)
+		}
+	}
+	b.plan.Operations = ops
+}
+
+// move turns add into the move of DEST file of del.
+func (b *builder) move(del, add *renameSide) error {
+	dest, err := util.ReadFile(del.o.Dest)
+	if err != nil {
+		return err
+	}
+
+	o := add.o
+	o.From = del.o.Rel
+	o.Op = OpMove
+	switch {
+	case bytes.Equal(dest, del.data):
+		// DEST is not changed, it's overwritten by SRC after moving
+	case bytes.Equal(del.data, add.data):
+		o.Src, o.Data, o.Origin = "", nil, add.data
+	default:
+		o.Op = OpConflict
+		o.Origin = add.data
+		o.Reason = fmt.Sprintf("renamed from %s in SRC, but changed by both sides", del.o.Rel)
+		b.plan.Report.AddError(&ConflictError{Rel: o.Rel, Reason: o.Reason})
+	}
+	return nil
+}
+
+// graftedContent return the content grafted into DEST file of o last time,
+// which is the baseline, or the DEST file itself if there is no baseline.
+func (b *builder) graftedContent(o *Operation) ([]byte, error) {
+	if b.plan.Baseline != nil {
+		data, err := b.plan.Baseline.Read(o.Rel)
+		if err == nil || !os.IsNotExist(err) {
+			return data, err
+		}
+	}
+	return util.ReadFile(o.Dest)
+}
+
+// srcContent return the SRC content of o which is recorded as baseline.
+func srcContent(o *Operation) ([]byte, error) {
+	if o.Origin != nil {
+		return o.Origin, nil
+	}
+	if o.Data != nil {
+		return o.Data, nil
+	}
+	return util.ReadFile(o.Src)
+}
+
+// similarity return the percent of lines of a and b in common, weighted by
+// their lengths.
+func similarity(a, b []byte) int {
+	counts := map[string]int{}
+	for _, line := range util.SplitLines(a) {
+		counts[line]++
+	}
+	common := 0
+	for _, line := range util.SplitLines(b) {
+		if counts[line] > 0 {
+			counts[line]--
+			common += len(line)
+		}
+	}
+
+	max := len(a)
+	if len(b) > max {
+		max = len(b)
+	}
+	if max == 0 {
+		return 100
+	}
+	return common * 100 / max
+}
@@ -0,0 +1,116 @@
+// Copyright © 2018 Mephis Pheies <mephistommm@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package plan
+
+import "testing"
+
+func TestSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b  string
+		score int
+	}{
+		{"", "", 100},
+		{"a\nb\n", "a\nb\n", 100},
+		{"a\nb\n", "b\na\n", 100},
+		{"line 1\nline 2\n", "line 1\nline 3\n", 50},
+		{"a\n", "b\n", 0},
+	}
+	for _, tt := range tests {
+		if got := similarity([]byte(tt.a), []byte(tt.b)); got != tt.score {
+			t.Errorf("similarity(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.score)
+		}
+	}
+}
+
+func TestDetectRenames(t *testing.T) {
+	const grafted = "line 1\nline 2\nline 3\nline 4\n"
+	tests := []struct {
+		name string
+		// src and dest are the new contents of renamed SRC file and DEST file
+		src, dest string
+		op        Op
+		// want is the content of new DEST file after applying
+		want string
+	}{
+		{
+			name: "DEST changes are moved",
+			src:  grafted,
+			dest: grafted + "local\n",
+			op:   OpMove,
+			want: grafted + "local\n",
+		},
+		{
+			name: "SRC changes are grafted after moving",
+			src:  grafted + "upstream\n",
+			dest: grafted,
+			op:   OpMove,
+			want: grafted + "upstream\n",
+		},
+		{
+			name: "both sides changed",
+			src:  grafted + "upstream\n",
+			dest: grafted + "local\n",
+			op:   OpConflict,
+		},
+		{
+			name: "dissimilar files are not renamed",
+			src:  "other\n",
+			dest: grafted,
+			op:   OpAdd,
+			want: "other\n",
+		},
+	}
+
+	for _, tt := range tests {
+		f := newFixture(t)
+		f.write(map[string]*string{"src/old": content(grafted)})
+		M := f.mission()
+		f.graft(M)
+
+		f.write(map[string]*string{
+			"src/old":  nil,
+			"src/new":  content(tt.src),
+			"dest/old": content(tt.dest),
+		})
+		p, err := Build(M, f.options())
+		if err != nil {
+			t.Fatal(err)
+		}
+		ops := operations(p)
+		if ops["new"] != tt.op {
+			t.Errorf("%s: planned %v, want %s of new", tt.name, ops, tt.op)
+			f.cleanup()
+			continue
+		}
+		if tt.op == OpConflict {
+			f.cleanup()
+			continue
+		}
+
+		Apply(p)
+		if got := f.read("dest/new"); got == nil || *got != tt.want {
+			t.Errorf("%s: new DEST file is %v, want %q", tt.name, got, tt.want)
+		}
+		if tt.op == OpMove && f.read("dest/old") != nil {
+			t.Errorf("%s: DEST file moved from is left", tt.name)
+		}
+		f.cleanup()
+	}
+}
@@ -0,0 +1,372 @@
+// Copyright © 2018 Mephis Pheies <mephistommm@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package plan
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/MephistoMMM/grafter/model"
+	"github.com/MephistoMMM/grafter/transform"
+	"github.com/MephistoMMM/grafter/util"
+)
+
+// Reverse compare DEST dest with the scan of SRC working tree, and return
+// the plan of reverse graft which writes DEST changes since the last graft
+// back into SRC. Rel of operations is relative to SRC of mission and Dest is
+// the SRC file to write, while conflicts keep the DEST path. A file changed
+// by both sides since the last graft, or whose transforms can't be inverted,
+// is reported as a conflict.
+func (sc *Scan) Reverse(dest string) (*Plan, error) {
+	r, err := sc.reverse(dest, false)
+	return r.plan, err
+}
+
+// reverse plans the reverse graft from dest. Files changed by both sides are
+// collected as divergences instead of conflicts if sync is true.
+func (sc *Scan) reverse(dest string, sync bool) (*reverser, error) {
+	p := &Plan{
+		Mission: sc.M.Name,
+		Dest:    sc.M.Src,
+		Report:  util.NewReport(),
+	}
+	r := &reverser{scan: sc, plan: p, dest: dest, sync: sync}
+	if sc.opts.SrcRev != "" {
+		return r, fmt.Errorf("reverse graft needs the working tree of SRC")
+	}
+	if sc.opts.BaselineDir == "" {
+		return r, fmt.Errorf("reverse graft needs the baseline of DEST")
+	}
+	p.Baseline = model.NewBaseline(sc.opts.BaselineDir, sc.M.Name, dest)
+	if util.IsNotExist(p.Baseline.Dir()) {
+		return r, fmt.Errorf("%s has no baseline, graft it first", dest)
+	}
+
+	destChecker, err := IgnoreChain(sc.M, dest, sc.M.Ignore)
+	if err != nil {
+		return r, err
+	}
+
+	walker := util.NewWalker(dest, destChecker, 10)
+	walkErr := make(chan error, 1)
+	go func(w util.FileWalker) {
+		walkErr <- w.Walk()
+	}(walker)
+
+	seen := map[string]bool{}
+	for item := range walker.Pipe() {
+		if item.Err != nil {
+			p.Report.AddError(item.Err)
+			continue
+		}
+		if item.Info.IsDir() {
+			continue
+		}
+		rel, err := filepath.Rel(dest, item.Path)
+		if err != nil {
+			p.Report.AddError(err)
+			continue
+		}
+		rel = filepath.ToSlash(rel)
+		seen[rel] = true
+		r.reverseFile(rel, item.Path, item.Info)
+	}
+	if err := abortError(walker, <-walkErr); err != nil {
+		return r, err
+	}
+
+	// files grafted last time but absent in DEST now
+	files, err := p.Baseline.Files()
+	if err != nil {
+		return r, err
+	}
+	for _, rel := range files {
+		if !seen[rel] {
+			r.reverseDeleted(rel)
+		}
+	}
+
+	p.sort()
+	return r, nil
+}
+
+// reverser plans a reverse graft from one destination.
+type reverser struct {
+	scan *Scan
+	plan *Plan
+	dest string
+
+	// sync collects files changed by both sides into diverged
+	sync     bool
+	diverged []*Divergence
+}
+
+// reverseFile plans DEST file path whose slash separated path is rel.
+func (r *reverser) reverseFile(rel, path string, info os.FileInfo) {
+	s := r.scan.owner(rel)
+	if s == nil {
+		// files out of any source are not managed by graft
+		return
+	}
+
+	destData, err := util.ReadFile(path)
+	if err != nil {
+		r.plan.Report.AddError(err)
+		return
+	}
+	base, err := r.plan.Baseline.Read(rel)
+	if err != nil && !os.IsNotExist(err) {
+		r.plan.Report.AddError(err)
+		return
+	}
+	hasBase := err == nil
+
+	candidates := r.scan.outputs[rel]
+	switch len(candidates) {
+	case 0:
+		if hasBase {
+			if bytes.Equal(destData, base) {
+				return
+			}
+			if !r.sync {
+				r.conflict(rel, path, "SRC deleted it since the last graft, but DEST changed it")
+				return
+			}
+			src, ok, err := s.srcPath(rel)
+			if err != nil || !ok {
+				r.conflict(rel, path, "SRC deleted it since the last graft, but DEST changed it")
+				return
+			}
+			r.diverged = append(r.diverged, &Divergence{
+				Rel:      rel,
+				Src:      src,
+				Dest:     path,
+				Base:     base,
+				DestData: destData,
+				op:       OpAdd,
+				source:   s,
+				info:     info,
+			})
+			return
+		}
+
+		// a new DEST file goes to the SRC path mapped to it
+		src, ok, err := s.srcPath(rel)
+		if err != nil {
+			r.conflict(rel, path, err.Error())
+			return
+		}
+		if !ok {
+			r.conflict(rel, path, "no SRC path is mapped to it")
+			return
+		}
+		srcRel, err := filepath.Rel(s.root, src)
+		if err != nil {
+			r.plan.Report.AddError(err)
+			return
+		}
+		if r.scan.transformer.Rename(s.destRel(filepath.ToSlash(srcRel))) != rel {
+			r.conflict(rel, path, "it's renamed by transforms, which can't be inverted")
+			return
+		}
+		ignored, err := s.ignored(src, info)
+		r.plan.Report.AddError(err)
+		if ignored || err != nil {
+			return
+		}
+		r.reverse(OpAdd, rel, path, info, s, src, destData)
+	case 1:
+		c := candidates[0]
+		f, err := r.scan.transformFile(c, rel, path, r.plan.Baseline)
+		if err != nil {
+			r.conflict(rel, path, err.Error())
+			return
+		}
+		if bytes.Equal(f.Data, destData) && sameExecutable(c.info, path) {
+			return
+		}
+		if !hasBase {
+			r.conflict(rel, path, "SRC and DEST differ, but it has no baseline")
+			return
+		}
+		if bytes.Equal(destData, base) {
+			// only SRC is changed, which is the business of graft
+			return
+		}
+		if !bytes.Equal(graftedContent(f), base) {
+			if !r.sync {
+				r.conflict(rel, path, "both SRC and DEST are changed since the last graft")
+				return
+			}
+			d := &Divergence{
+				Rel:      rel,
+				Src:      c.src,
+				Dest:     path,
+				Base:     base,
+				SrcData:  f.Data,
+				DestData: destData,
+				op:       OpModify,
+				source:   c.source,
+				info:     info,
+			}
+			if f.Origin != nil {
+				// baseline of merged files is not in the form of DEST
+				d.Base = nil
+			}
+			r.diverged = append(r.diverged, d)
+			return
+		}
+		r.reverse(OpModify, rel, path, info, c.source, c.src, destData)
+	default:
+		r.conflict(rel, path, "it's produced by more than one SRC file")
+	}
+}
+
+// reverseDeleted plans DEST file rel which is grafted last time but absent
+// in DEST now.
+func (r *reverser) reverseDeleted(rel string) {
+	path := filepath.Join(r.dest, filepath.FromSlash(rel))
+	if _, err := os.Lstat(path); err == nil {
+		// ignored by DEST
+		return
+	}
+	candidates := r.scan.outputs[rel]
+	if len(candidates) != 1 {
+		return
+	}
+
+	c := candidates[0]
+	f, err := r.scan.transformFile(c, rel, path, r.plan.Baseline)
+	if err != nil {
+		r.conflict(rel, path, err.Error())
+		return
+	}
+	base, err := r.plan.Baseline.Read(rel)
+	if err != nil {
+		r.plan.Report.AddError(err)
+		return
+	}
+	if !bytes.Equal(graftedContent(f), base) {
+		if !r.sync {
+			r.conflict(rel, path, "DEST deleted it, but SRC changed it since the last graft")
+			return
+		}
+		r.diverged = append(r.diverged, &Divergence{
+			Rel:     rel,
+			Src:     c.src,
+			Dest:    path,
+			Base:    base,
+			SrcData: f.Data,
+			op:      OpDelete,
+			source:  c.source,
+		})
+		return
+	}
+	r.delete(rel, c.source, c.src)
+}
+
+// delete plans removing SRC file src of source s, whose DEST file rel is
+// deleted.
+func (r *reverser) delete(rel string, s *source, src string) bool {
+	srcRel, err := r.srcRel(src)
+	if err != nil {
+		r.plan.Report.AddError(err)
+		return false
+	}
+	r.plan.Operations = append(r.plan.Operations, &Operation{
+		Op:      OpDelete,
+		Rel:     srcRel,
+		Dest:    src,
+		Source:  s.root,
+		BaseRel: rel,
+	})
+	return true
+}
+
+// reverse plans writing DEST file path back into SRC file src by op,
+// destData is the content of DEST file. It reports whether the operation is
+// planned.
+func (r *reverser) reverse(op Op, rel, path string, info os.FileInfo, s *source, src string, destData []byte) bool {
+	srcRel, err := r.srcRel(src)
+	if err != nil {
+		r.plan.Report.AddError(err)
+		return false
+	}
+	f := &transform.File{
+		Rel:  rel,
+		Src:  src,
+		Dest: path,
+		Base: r.plan.Baseline.Path(rel),
+		Data: destData,
+	}
+	if err := r.scan.transformer.Reverse(f); err != nil {
+		r.conflict(rel, path, err.Error())
+		return false
+	}
+
+	r.plan.Operations = append(r.plan.Operations, &Operation{
+		Op:     op,
+		Rel:    srcRel,
+		Dest:   src,
+		Src:    path,
+		Source: s.root,
+		Data:   f.Data,
+		// DEST is what SRC is transformed into now
+		Origin:  destData,
+		Mode:    info.Mode(),
+		BaseRel: rel,
+	})
+	return true
+}
+
+// conflict report DEST file rel which can't be written back into SRC.
+func (r *reverser) conflict(rel, path, reason string) {
+	r.plan.Operations = append(r.plan.Operations, &Operation{
+		Op:     OpConflict,
+		Rel:    rel,
+		Dest:   path,
+		Reason: reason,
+	})
+	r.plan.Report.AddError(&ConflictError{Rel: rel, Reason: reason})
+}
+
+// srcRel return the slash separated path of SRC file src relative to SRC
+// of mission.
+func (r *reverser) srcRel(src string) (string, error) {
+	rel, err := filepath.Rel(r.scan.M.Src, src)
+	if err != nil {
+		return "", err
+	}
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("Keep %s: it's out of SRC %s", src, r.scan.M.Src)
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// graftedContent return the content of f recorded as baseline.
+func graftedContent(f *transform.File) []byte {
+	if f.Origin != nil {
+		return f.Origin
+	}
+	return f.Data
+}
@@ -0,0 +1,139 @@
+// Copyright © 2018 Mephis Pheies <mephistommm@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package plan
+
+import (
+	"testing"
+
+	"github.com/MephistoMMM/grafter/model"
+)
+
+func TestReverse(t *testing.T) {
+	tests := []struct {
+		name     string
+		mappings []model.Mapping
+		// grafted are SRC files grafted before DEST is changed
+		grafted map[string]*string
+		// src and dest are changes since the last graft
+		src, dest map[string]*string
+		want      map[string]Op
+		// result is the content of SRC files after applying
+		result map[string]*string
+	}{
+		{
+			name:    "modified",
+			grafted: map[string]*string{"a": content("a\n")},
+			dest:    map[string]*string{"a": content("a\nlocal\n")},
+			want:    map[string]Op{"a": OpModify},
+			result:  map[string]*string{"a": content("a\nlocal\n")},
+		},
+		{
+			name:    "added",
+			grafted: map[string]*string{"a": content("a\n")},
+			dest:    map[string]*string{"dir/b": content("b\n")},
+			want:    map[string]Op{"dir/b": OpAdd},
+			result:  map[string]*string{"a": content("a\n"), "dir/b": content("b\n")},
+		},
+		{
+			name:    "deleted",
+			grafted: map[string]*string{"a": content("a\n"), "b": content("b\n")},
+			dest:    map[string]*string{"a": nil},
+			want:    map[string]Op{"a": OpDelete},
+			result:  map[string]*string{"a": nil, "b": content("b\n")},
+		},
+		{
+			name:    "changed by both sides",
+			grafted: map[string]*string{"a": content("a\n")},
+			src:     map[string]*string{"a": content("a\nupstream\n")},
+			dest:    map[string]*string{"a": content("a\nlocal\n")},
+			want:    map[string]Op{"a": OpConflict},
+			result:  map[string]*string{"a": content("a\nupstream\n")},
+		},
+		{
+			name:     "mapped back",
+			mappings: []model.Mapping{{Src: `^docs/(.*)$`, Dest: "out/$1", Regexp: true}},
+			grafted:  map[string]*string{"docs/a": content("a\n")},
+			dest:     map[string]*string{"out/b": content("b\n")},
+			want:     map[string]Op{"docs/b": OpAdd},
+			result:   map[string]*string{"docs/a": content("a\n"), "docs/b": content("b\n")},
+		},
+		{
+			name:     "mapping not invertible",
+			mappings: []model.Mapping{{Src: `^(a|b)/(.*)$`, Dest: "c/$2", Regexp: true}},
+			grafted:  map[string]*string{"a/x": content("x\n")},
+			dest:     map[string]*string{"c/y": content("y\n")},
+			want:     map[string]Op{"c/y": OpConflict},
+			result:   map[string]*string{"a/y": nil, "b/y": nil},
+		},
+	}
+
+	for _, tt := range tests {
+		f := newFixture(t)
+		f.write(prefixed("src/", tt.grafted))
+		M := f.mission()
+		M.Mappings = tt.mappings
+		f.graft(M)
+
+		f.write(prefixed("src/", tt.src))
+		f.write(prefixed("dest/", tt.dest))
+		sc, err := NewScan(M, f.options())
+		if err != nil {
+			t.Fatal(err)
+		}
+		p, err := sc.Reverse(M.Dest)
+		sc.Close()
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			f.cleanup()
+			continue
+		}
+		if !sameOperations(p, tt.want) {
+			t.Errorf("%s: planned %v, want %v", tt.name, operations(p), tt.want)
+		}
+
+		Apply(p)
+		for rel, want := range tt.result {
+			got := f.read("src/" + rel)
+			if (got == nil) != (want == nil) || got != nil && *got != *want {
+				t.Errorf("%s: SRC file %s is %v, want %v", tt.name, rel, got, want)
+			}
+		}
+		f.cleanup()
+	}
+}
+
+func TestReverseWithoutBaseline(t *testing.T) {
+	f := newFixture(t)
+	defer f.cleanup()
+	f.write(map[string]*string{"src/a": content("a\n"), "dest/a": content("b\n")})
+	M := f.mission()
+
+	sc, err := NewScan(M, f.options())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sc.Close()
+	if _, err := sc.Reverse(M.Dest); err == nil {
+		t.Error("reverse graft is planned without baseline")
+	}
+	if got := f.read("src/a"); got == nil || *got != "a\n" {
+		t.Errorf("SRC file is %v, want it unchanged", got)
+	}
+}
@@ -0,0 +1,219 @@
+// Copyright © 2018 Mephis Pheies <mephistommm@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package plan
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/MephistoMMM/grafter/util"
+)
+
+// Divergence is a DEST file changed by both SRC and DEST since the last
+// graft, which is resolved by the strategy of bidirectional mission.
+type Divergence struct {
+	// Rel is the slash separated path relative to DEST.
+	Rel string
+	// Src and Dest are the files of both sides, either could be deleted.
+	Src  string
+	Dest string
+	// Base is the content grafted last time, it's nil if it can't be used
+	// as merge base. SrcData is the transformed SRC content and DestData is
+	// the DEST content, they are nil if the file is deleted.
+	Base     []byte
+	SrcData  []byte
+	DestData []byte
+
+	// op writes DEST back into SRC
+	op     Op
+	source *source
+	info   os.FileInfo
+	// fwd grafts SRC into DEST
+	fwd *Operation
+}
+
+// Merge return the line by line merge of changes of both sides.
+func (d *Divergence) Merge() ([]byte, bool) {
+	if d.Base == nil || d.SrcData == nil || d.DestData == nil ||
+		util.IsBinary(d.SrcData) || util.IsBinary(d.DestData) {
+		return nil, false
+	}
+	return util.Merge3(d.Base, d.SrcData, d.DestData)
+}
+
+// Resolution is the way to resolve a Divergence.
+type Resolution int
+
+const (
+	// ResolveNone leaves the file as a conflict.
+	ResolveNone Resolution = iota
+	// ResolveSrc grafts SRC into DEST.
+	ResolveSrc
+	// ResolveDest writes DEST back into SRC.
+	ResolveDest
+	// ResolveMerge writes the merge of both sides into both, the file is
+	// left as a conflict if changes overlap.
+	ResolveMerge
+)
+
+// Resolver decides the Resolution of a Divergence.
+type Resolver func(d *Divergence) Resolution
+
+// NewResolver return the Resolver of strategy, ask is the Resolver of ask
+// strategy. newer-wins picks the side modified later, a deleted side is
+// older than any modification.
+func NewResolver(strategy string, ask Resolver) (Resolver, error) {
+	switch strategy {
+	case "ask":
+		return ask, nil
+	case "src-wins":
+		return func(d *Divergence) Resolution { return ResolveSrc }, nil
+	case "dest-wins":
+		return func(d *Divergence) Resolution { return ResolveDest }, nil
+	case "merge":
+		return func(d *Divergence) Resolution { return ResolveMerge }, nil
+	case "newer-wins":
+		return func(d *Divergence) Resolution {
+			st, dt := modTime(d.Src), modTime(d.Dest)
+			switch {
+			case st.After(dt):
+				return ResolveSrc
+			case dt.After(st):
+				return ResolveDest
+			}
+			return ResolveNone
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown strategy %q", strategy)
+}
+
+// modTime return the modification time of path, it's zero if path doesn't
+// exist.
+func modTime(path string) time.Time {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return fi.ModTime()
+}
+
+// Sync plans the bidirectional graft between SRC and DEST dest, the scan
+// must be of the working tree of SRC without Options.DetectLocal. The
+// forward plan grafts SRC changes into DEST like Plan, and the reverse plan
+// writes DEST changes back into SRC like Reverse. Files changed by both
+// sides since the last graft are resolved by resolve. The reverse plan is
+// empty if DEST has not been grafted yet.
+func (sc *Scan) Sync(dest string, resolve Resolver) (*Plan, *Plan, error) {
+	fwd, err := sc.Plan(dest)
+	if err != nil {
+		return fwd, nil, err
+	}
+	if fwd.Baseline != nil && util.IsNotExist(fwd.Baseline.Dir()) {
+		// nothing was grafted into DEST, there is no DEST change yet
+		return fwd, &Plan{Mission: sc.M.Name, Dest: sc.M.Src, Report: util.NewReport()}, nil
+	}
+	r, err := sc.reverse(dest, true)
+	if err != nil {
+		return fwd, r.plan, err
+	}
+
+	// DEST changes are never overwritten by SRC
+	reversed := map[string]bool{}
+	for _, o := range r.plan.Operations {
+		if o.BaseRel != "" {
+			reversed[o.BaseRel] = true
+		} else {
+			reversed[o.Rel] = true
+		}
+	}
+	diverged := map[string]*Divergence{}
+	for _, d := range r.diverged {
+		diverged[d.Rel] = d
+	}
+	var ops []*Operation
+	for _, o := range fwd.Operations {
+		keep := true
+		for _, rel := range []string{o.Rel, o.From} {
+			if reversed[rel] {
+				keep = false
+			}
+			if d, ok := diverged[rel]; ok {
+				d.fwd = o
+				keep = false
+			}
+		}
+		if keep {
+			ops = append(ops, o)
+		}
+	}
+	fwd.Operations = ops
+
+	for _, d := range r.diverged {
+		r.resolve(fwd, d, resolve(d))
+	}
+	fwd.sort()
+	r.plan.sort()
+	return fwd, r.plan, nil
+}
+
+// resolve plans d by resolution res, the forward operation is added to fwd.
+func (r *reverser) resolve(fwd *Plan, d *Divergence, res Resolution) {
+	switch res {
+	case ResolveSrc:
+		if d.fwd != nil {
+			fwd.Operations = append(fwd.Operations, d.fwd)
+		}
+		return
+	case ResolveDest:
+		if r.writeBack(d, d.DestData) {
+			return
+		}
+	case ResolveMerge:
+		merged, ok := d.Merge()
+		if ok && d.fwd != nil && d.fwd.Op == OpModify && r.writeBack(d, merged) {
+			d.fwd.Data, d.fwd.Origin = merged, nil
+			fwd.Operations = append(fwd.Operations, d.fwd)
+			return
+		}
+	}
+
+	reason := "changed by both SRC and DEST since the last graft"
+	if res == ResolveMerge {
+		reason = "changes of SRC and DEST overlap"
+	}
+	fwd.Operations = append(fwd.Operations, &Operation{
+		Op:     OpConflict,
+		Rel:    d.Rel,
+		Dest:   d.Dest,
+		Src:    d.Src,
+		Reason: reason,
+	})
+	fwd.Report.AddError(&ConflictError{Rel: d.Rel, Reason: reason})
+}
+
+// writeBack plans writing content of DEST file of d back into SRC. It
+// reports whether the operation is planned.
+func (r *reverser) writeBack(d *Divergence, content []byte) bool {
+	if d.op == OpDelete {
+		return r.delete(d.Rel, d.source, d.Src)
+	}
+	return r.reverse(d.op, d.Rel, d.Dest, d.info, d.source, d.Src, content)
+}
@@ -0,0 +1,153 @@
+// Copyright © 2018 Mephis Pheies <mephistommm@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package plan
+
+import "testing"
+
+func TestSync(t *testing.T) {
+	const (
+		grafted  = "1\n2\n3\n4\n5\n"
+		upstream = "1 upstream\n2\n3\n4\n5\n"
+		local    = "1\n2\n3\n4\n5 local\n"
+		merged   = "1 upstream\n2\n3\n4\n5 local\n"
+		overlap  = "1 local\n2\n3\n4\n5\n"
+	)
+	tests := []struct {
+		name      string
+		strategy  string
+		src, dest string
+		fwd, rev  map[string]Op
+		// result are contents of SRC and DEST file after applying
+		result string
+	}{
+		{
+			name:     "SRC changed",
+			strategy: "ask",
+			src:      upstream,
+			dest:     grafted,
+			fwd:      map[string]Op{"a": OpModify},
+			rev:      map[string]Op{},
+			result:   upstream,
+		},
+		{
+			name:     "DEST changed",
+			strategy: "ask",
+			src:      grafted,
+			dest:     local,
+			fwd:      map[string]Op{},
+			rev:      map[string]Op{"a": OpModify},
+			result:   local,
+		},
+		{
+			name:     "src-wins",
+			strategy: "src-wins",
+			src:      upstream,
+			dest:     local,
+			fwd:      map[string]Op{"a": OpModify},
+			rev:      map[string]Op{},
+			result:   upstream,
+		},
+		{
+			name:     "dest-wins",
+			strategy: "dest-wins",
+			src:      upstream,
+			dest:     local,
+			fwd:      map[string]Op{},
+			rev:      map[string]Op{"a": OpModify},
+			result:   local,
+		},
+		{
+			name:     "merged",
+			strategy: "merge",
+			src:      upstream,
+			dest:     local,
+			fwd:      map[string]Op{"a": OpModify},
+			rev:      map[string]Op{"a": OpModify},
+			result:   merged,
+		},
+		{
+			name:     "overlapped",
+			strategy: "merge",
+			src:      upstream,
+			dest:     overlap,
+			fwd:      map[string]Op{"a": OpConflict},
+			rev:      map[string]Op{},
+		},
+		{
+			name:     "left as conflict",
+			strategy: "ask",
+			src:      upstream,
+			dest:     local,
+			fwd:      map[string]Op{"a": OpConflict},
+			rev:      map[string]Op{},
+		},
+	}
+
+	for _, tt := range tests {
+		f := newFixture(t)
+		f.write(map[string]*string{"src/a": content(grafted)})
+		M := f.mission()
+		f.graft(M)
+
+		f.write(map[string]*string{"src/a": content(tt.src), "dest/a": content(tt.dest)})
+		resolve, err := NewResolver(tt.strategy, func(*Divergence) Resolution {
+			return ResolveNone
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		sc, err := NewScan(M, f.options())
+		if err != nil {
+			t.Fatal(err)
+		}
+		fwd, rev, err := sc.Sync(M.Dest, resolve)
+		sc.Close()
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			f.cleanup()
+			continue
+		}
+		if !sameOperations(fwd, tt.fwd) || !sameOperations(rev, tt.rev) {
+			t.Errorf("%s: planned %v and %v, want %v and %v", tt.name,
+				operations(fwd), operations(rev), tt.fwd, tt.rev)
+		}
+
+		Apply(fwd)
+		Apply(rev)
+		src, dest := tt.result, tt.result
+		if tt.result == "" {
+			// conflicts keep both sides
+			src, dest = tt.src, tt.dest
+		}
+		if got := f.read("src/a"); got == nil || *got != src {
+			t.Errorf("%s: SRC file is %v, want %q", tt.name, got, src)
+		}
+		if got := f.read("dest/a"); got == nil || *got != dest {
+			t.Errorf("%s: DEST file is %v, want %q", tt.name, got, dest)
+		}
+		f.cleanup()
+	}
+}
+
+func TestNewResolverUnknown(t *testing.T) {
+	if _, err := NewResolver("older-wins", nil); err == nil {
+		t.Error("NewResolver accepted an unknown strategy")
+	}
+}
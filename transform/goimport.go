@@ -0,0 +1,201 @@
+// Copyright © 2018 Mephis Pheies <mephistommm@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package transform
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/MephistoMMM/grafter/model"
+	"github.com/MephistoMMM/grafter/util"
+)
+
+func init() {
+	Register("goimport", NewGoImport)
+}
+
+// prefixPair is a mapping of module path prefix.
+type prefixPair struct {
+	from, to string
+}
+
+// GoImport rewrites Go import paths by prefix mappings. Go files are parsed,
+// so only import paths, import comments and directives like go:generate and
+// build tags are rewritten. In go.mod and proto files, every path with the
+// prefix is rewritten, e.g. module directive and go_package option.
+type GoImport struct {
+	prefixes []prefixPair
+}
+
+// NewGoImport create GoImport transformer from spec. The prefix mapping is
+// From to To, and each key to value of Options.
+func NewGoImport(M *model.Mission, spec model.Transform) (Transformer, error) {
+	g := &GoImport{}
+	if spec.From != "" {
+		g.prefixes = append(g.prefixes, prefixPair{spec.From, spec.To})
+	}
+	for from, to := range spec.Options {
+		g.prefixes = append(g.prefixes, prefixPair{from, to})
+	}
+	if len(g.prefixes) == 0 {
+		return nil, fmt.Errorf("no prefix mapping")
+	}
+
+	// the longest prefix wins
+	sort.Slice(g.prefixes, func(i, j int) bool {
+		return len(g.prefixes[i].from) > len(g.prefixes[j].from)
+	})
+	return g, nil
+}
+
+// Name ...
+func (g *GoImport) Name() string {
+	return "goimport"
+}
+
+// Transform ...
+func (g *GoImport) Transform(f *File) error {
+	switch {
+	case strings.HasSuffix(f.Rel, ".go"):
+		return g.transformGo(f)
+	case path.Base(f.Rel) == "go.mod", strings.HasSuffix(f.Rel, ".proto"):
+		f.Data = []byte(g.replaceText(string(f.Data)))
+	}
+	return nil
+}
+
+// Invert rewrites import paths by the inverse prefix mappings.
+func (g *GoImport) Invert(f *File) error {
+	inverse := &GoImport{prefixes: make([]prefixPair, 0, len(g.prefixes))}
+	for _, pp := range g.prefixes {
+		inverse.prefixes = append(inverse.prefixes, prefixPair{pp.to, pp.from})
+	}
+	sort.Slice(inverse.prefixes, func(i, j int) bool {
+		return len(inverse.prefixes[i].from) > len(inverse.prefixes[j].from)
+	})
+	return inverse.Transform(f)
+}
+
+func (g *GoImport) transformGo(f *File) error {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, f.Rel, f.Data, parser.ParseComments)
+	if err != nil {
+		// e.g. invalid files in testdata, fall back to rewrite quoted paths
+		util.Warnf("goimport: %v, rewrite %s as text", err, f.Rel)
+		f.Data = []byte(g.replaceText(string(f.Data)))
+		return nil
+	}
+
+	changed := false
+	for _, imp := range file.Imports {
+		p, err := strconv.Unquote(imp.Path.Value)
+		if err != nil {
+			continue
+		}
+		if np, ok := g.rewrite(p); ok {
+			imp.Path.Value = strconv.Quote(np)
+			changed = true
+		}
+	}
+	for _, cg := range file.Comments {
+		for _, c := range cg.List {
+			if !isPathComment(c.Text) {
+				continue
+			}
+			if text := g.replaceText(c.Text); text != c.Text {
+				c.Text = text
+				changed = true
+			}
+		}
+	}
+	// keep unchanged files byte for byte
+	if !changed {
+		return nil
+	}
+
+	ast.SortImports(fset, file)
+	var buf bytes.Buffer
+	if err := format.Node(&buf, fset, file); err != nil {
+		return err
+	}
+	f.Data = buf.Bytes()
+	return nil
+}
+
+// isPathComment reports whether comment may refer to import paths, such as
+// directives, build tags and import comments.
+func isPathComment(text string) bool {
+	return strings.HasPrefix(text, "//go:") ||
+		strings.HasPrefix(text, "// +build") ||
+		strings.Contains(text, `import "`)
+}
+
+// rewrite return the new path of import path p.
+func (g *GoImport) rewrite(p string) (string, bool) {
+	for _, pp := range g.prefixes {
+		if p == pp.from || strings.HasPrefix(p, pp.from+"/") {
+			return pp.to + p[len(pp.from):], true
+		}
+	}
+	return p, false
+}
+
+// replaceText rewrites all paths with mapped prefixes in text. A prefix is
+// only replaced at the boundary of path, so "github.com/a/b" doesn't match
+// "github.com/a/bc".
+func (g *GoImport) replaceText(text string) string {
+	var b strings.Builder
+	for i := 0; i < len(text); {
+		matched := false
+		if i == 0 || !isPathChar(text[i-1]) {
+			for _, pp := range g.prefixes {
+				end := i + len(pp.from)
+				if !strings.HasPrefix(text[i:], pp.from) {
+					continue
+				}
+				if end < len(text) && text[end] != '/' && isPathChar(text[end]) {
+					continue
+				}
+				b.WriteString(pp.to)
+				i = end
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			b.WriteByte(text[i])
+			i++
+		}
+	}
+	return b.String()
+}
+
+func isPathChar(c byte) bool {
+	return c == '.' || c == '/' || c == '-' || c == '_' || c == '~' ||
+		('0' <= c && c <= '9') || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
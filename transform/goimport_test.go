@@ -0,0 +1,153 @@
+// Copyright © 2018 Mephis Pheies <mephistommm@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package transform
+
+import (
+	"testing"
+
+	"github.com/MephistoMMM/grafter/model"
+)
+
+func TestGoImport(t *testing.T) {
+	g, err := NewGoImport(nil, model.Transform{
+		Type:    "goimport",
+		From:    "github.com/old/mod",
+		To:      "example.com/new",
+		Options: map[string]string{"github.com/old/mod/internal": "example.com/internal"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name, rel, data, want string
+	}{
+		{
+			name: "imports",
+			rel:  "main.go",
+			data: `package main
+
+import (
+	"fmt"
+
+	"github.com/old/mod/util"
+	"github.com/old/modx"
+)
+`,
+			want: `package main
+
+import (
+	"fmt"
+
+	"example.com/new/util"
+	"github.com/old/modx"
+)
+`,
+		},
+		{
+			name: "longest prefix",
+			rel:  "a/a.go",
+			data: "package a\n\nimport \"github.com/old/mod/internal/x\"\n",
+			want: "package a\n\nimport \"example.com/internal/x\"\n",
+		},
+		{
+			name: "import comment and directive",
+			rel:  "a/a.go",
+			data: "//go:generate go run github.com/old/mod/gen\n\npackage a // import \"github.com/old/mod/a\"\n",
+			want: "//go:generate go run example.com/new/gen\n\npackage a // import \"example.com/new/a\"\n",
+		},
+		{
+			name: "strings are kept",
+			rel:  "a/a.go",
+			data: "package a\n\nconst s = \"github.com/old/mod\"\n",
+			want: "package a\n\nconst s = \"github.com/old/mod\"\n",
+		},
+		{
+			name: "unchanged file is kept byte for byte",
+			rel:  "a/a.go",
+			data: "package a\nimport \"fmt\"\nvar _ = fmt.Sprint\n",
+			want: "package a\nimport \"fmt\"\nvar _ = fmt.Sprint\n",
+		},
+		{
+			name: "invalid go file",
+			rel:  "testdata/bad.go",
+			data: "package\nimport \"github.com/old/mod/x\"\n",
+			want: "package\nimport \"example.com/new/x\"\n",
+		},
+		{
+			name: "go.mod",
+			rel:  "go.mod",
+			data: "module github.com/old/mod\n\nrequire github.com/old/modx v1.0.0\n",
+			want: "module example.com/new\n\nrequire github.com/old/modx v1.0.0\n",
+		},
+		{
+			name: "proto",
+			rel:  "api/a.proto",
+			data: "option go_package = \"github.com/old/mod/api\";\n",
+			want: "option go_package = \"example.com/new/api\";\n",
+		},
+		{
+			name: "other files",
+			rel:  "README.md",
+			data: "go get github.com/old/mod\n",
+			want: "go get github.com/old/mod\n",
+		},
+	}
+	for _, tt := range tests {
+		got, err := transformed(g, tt.rel, tt.data)
+		if err != nil || got != tt.want {
+			t.Errorf("%s: got %q, %v, want %q", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestNewGoImportInvalid(t *testing.T) {
+	if _, err := NewGoImport(nil, model.Transform{Type: "goimport"}); err == nil {
+		t.Error("NewGoImport accepted no prefix mapping")
+	}
+}
+
+func TestGoImportInvert(t *testing.T) {
+	g, err := NewGoImport(nil, model.Transform{Type: "goimport", From: "github.com/old/mod", To: "example.com/new"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		rel, data string
+	}{
+		{"main.go", "package main\n\nimport (\n\t\"fmt\"\n\n\t\"github.com/old/mod/util\"\n)\n"},
+		{"a/a.go", "package a // import \"github.com/old/mod/a\"\n"},
+		{"go.mod", "module github.com/old/mod\n"},
+		{"api/a.proto", "option go_package = \"github.com/old/mod/api\";\n"},
+	}
+	for _, tt := range tests {
+		f := &File{Rel: tt.rel, Data: []byte(tt.data)}
+		if err := g.Transform(f); err != nil {
+			t.Fatal(err)
+		}
+		if string(f.Data) == tt.data {
+			t.Errorf("%s is not transformed", tt.rel)
+		}
+		if err := g.(Inverter).Invert(f); err != nil || string(f.Data) != tt.data {
+			t.Errorf("%s: inverted %q, %v, want %q", tt.rel, f.Data, err, tt.data)
+		}
+	}
+}
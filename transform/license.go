@@ -0,0 +1,246 @@
+// Copyright © 2018 Mephis Pheies <mephistommm@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package transform
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/MephistoMMM/grafter/model"
+	"github.com/MephistoMMM/grafter/util"
+)
+
+func init() {
+	Register("license", NewLicense)
+}
+
+// commentStyle describes how a language writes comments.
+type commentStyle struct {
+	line       string
+	blockStart string
+	blockEnd   string
+	// shebang line is kept before header
+	shebang bool
+}
+
+var (
+	slashStyle = &commentStyle{line: "//", blockStart: "/*", blockEnd: "*/"}
+	hashStyle  = &commentStyle{line: "#", shebang: true}
+
+	commentStyles = map[string]*commentStyle{
+		".go":    slashStyle,
+		".proto": slashStyle,
+		".js":    slashStyle,
+		".jsx":   slashStyle,
+		".mjs":   slashStyle,
+		".ts":    slashStyle,
+		".tsx":   slashStyle,
+		".sh":    hashStyle,
+		".bash":  hashStyle,
+		".yaml":  hashStyle,
+		".yml":   hashStyle,
+	}
+
+	licenseWords = regexp.MustCompile(`(?i)copyright|license|permission is hereby granted|spdx-license-identifier`)
+)
+
+// License replaces the leading comment block which looks like a license
+// header by the header rendered from template, or inserts the header if there
+// is no such block. Go, shell, YAML, proto and JS files are supported.
+//
+// Options: template or template_file, year (current year by default) and
+// holder. The template is a text/template with Vars of mission and .year,
+// .holder, e.g. "Copyright © {{.year}} {{.holder}}".
+type License struct {
+	header []string
+}
+
+// NewLicense create License transformer from spec.
+func NewLicense(M *model.Mission, spec model.Transform) (Transformer, error) {
+	text := spec.Options["template"]
+	if file := spec.Options["template_file"]; file != "" {
+		data, err := util.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		text = string(data)
+	}
+	if strings.TrimSpace(text) == "" {
+		return nil, fmt.Errorf("template of header is empty")
+	}
+
+	vars := map[string]string{}
+	for k, v := range M.Vars {
+		vars[k] = v
+	}
+	vars["year"] = spec.Options["year"]
+	if vars["year"] == "" {
+		vars["year"] = strconv.Itoa(time.Now().Year())
+	}
+	vars["holder"] = spec.Options["holder"]
+
+	tmpl, err := template.New("license").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, vars); err != nil {
+		return nil, err
+	}
+
+	return &License{
+		header: strings.Split(strings.TrimRight(buf.String(), "\n"), "\n"),
+	}, nil
+}
+
+// Name ...
+func (l *License) Name() string {
+	return "license"
+}
+
+// Transform ...
+func (l *License) Transform(f *File) error {
+	style, ok := commentStyles[path.Ext(f.Rel)]
+	if !ok || util.IsBinary(f.Data) {
+		return nil
+	}
+
+	pre, text := splitShebang(string(f.Data), style)
+	header := l.render(style)
+	if block := licenseBlock(text, f.Rel, style); block != "" {
+		text = header + text[len(block):]
+	} else {
+		text = header + "\n" + text
+	}
+	f.Data = []byte(pre + text)
+	return nil
+}
+
+// Invert restores the license header of SRC file, or removes the header if
+// SRC file has none.
+func (l *License) Invert(f *File) error {
+	style, ok := commentStyles[path.Ext(f.Rel)]
+	if !ok || util.IsBinary(f.Data) {
+		return nil
+	}
+
+	pre, text := splitShebang(string(f.Data), style)
+	header := l.render(style)
+	if !strings.HasPrefix(text, header) {
+		return nil
+	}
+	text = text[len(header):]
+
+	srcData, err := util.ReadFile(f.Src)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	_, srcText := splitShebang(string(srcData), style)
+	if block := licenseBlock(srcText, f.Rel, style); block != "" {
+		text = block + text
+	} else {
+		text = strings.TrimPrefix(text, "\n")
+	}
+	f.Data = []byte(pre + text)
+	return nil
+}
+
+// splitShebang split the shebang line off text if style allows it.
+func splitShebang(text string, style *commentStyle) (string, string) {
+	if !style.shebang || !strings.HasPrefix(text, "#!") {
+		return "", text
+	}
+	end := strings.IndexByte(text, '\n') + 1
+	if end == 0 {
+		end = len(text)
+	}
+	return text[:end], text[end:]
+}
+
+// licenseBlock return the leading comment block of text of file rel if it
+// looks like a license header.
+func licenseBlock(text, rel string, style *commentStyle) string {
+	block := leadingComment(text, style)
+	if strings.HasSuffix(rel, ".go") {
+		// the package doc may follow the license in the same block
+		if i := strings.Index(block, "\n// Package "); i >= 0 {
+			block = strings.TrimRight(block[:i+1], "/\n") + "\n"
+		}
+	}
+	if block != "" && licenseWords.MatchString(block) {
+		return block
+	}
+	return ""
+}
+
+// render return header as comment lines of style.
+func (l *License) render(style *commentStyle) string {
+	var b strings.Builder
+	for _, line := range l.header {
+		line = strings.TrimRight(line, " \t")
+		if line == "" {
+			b.WriteString(style.line + "\n")
+		} else {
+			b.WriteString(style.line + " " + line + "\n")
+		}
+	}
+	return b.String()
+}
+
+// leadingComment return the comment block at the beginning of text, which is
+// either consecutive line comments or a block comment.
+func leadingComment(text string, style *commentStyle) string {
+	if style.blockStart != "" && strings.HasPrefix(text, style.blockStart) {
+		end := strings.Index(text, style.blockEnd)
+		if end < 0 {
+			return ""
+		}
+		end += len(style.blockEnd)
+		// take the rest of line
+		if nl := strings.IndexByte(text[end:], '\n'); nl >= 0 {
+			end += nl + 1
+		} else {
+			end = len(text)
+		}
+		return text[:end]
+	}
+
+	end := 0
+	for end < len(text) && strings.HasPrefix(text[end:], style.line) {
+		// directives like //go:build are not a part of header
+		if strings.HasPrefix(text[end:], "//go:") || strings.HasPrefix(text[end:], "// +build") {
+			break
+		}
+		nl := strings.IndexByte(text[end:], '\n')
+		if nl < 0 {
+			end = len(text)
+			break
+		}
+		end += nl + 1
+	}
+	return text[:end]
+}
@@ -0,0 +1,166 @@
+// Copyright © 2018 Mephis Pheies <mephistommm@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package transform
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/MephistoMMM/grafter/model"
+)
+
+func TestLicense(t *testing.T) {
+	M := &model.Mission{Vars: map[string]string{"Project": "grafter"}}
+	l, err := NewLicense(M, model.Transform{Type: "license", Options: map[string]string{
+		"template": "Copyright © {{.year}} {{.holder}}\n\n{{.Project}} is MIT licensed.\n",
+		"year":     "2020",
+		"holder":   "Mephis Pheies",
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	const goHeader = "// Copyright © 2020 Mephis Pheies\n//\n// grafter is MIT licensed.\n"
+	const hashHeader = "# Copyright © 2020 Mephis Pheies\n#\n# grafter is MIT licensed.\n"
+
+	tests := []struct {
+		name, rel, data, want string
+	}{
+		{
+			name: "insert",
+			rel:  "main.go",
+			data: "package main\n",
+			want: goHeader + "\npackage main\n",
+		},
+		{
+			name: "replace line comments",
+			rel:  "main.go",
+			data: "// Copyright 2018 someone\n// Licensed under Apache.\n\npackage main\n",
+			want: goHeader + "\npackage main\n",
+		},
+		{
+			name: "replace block comment",
+			rel:  "main.js",
+			data: "/*\n * Copyright 2018 someone\n */\nconsole.log(1)\n",
+			want: goHeader + "console.log(1)\n",
+		},
+		{
+			name: "keep package doc",
+			rel:  "a/doc.go",
+			data: "// Copyright 2018 someone\n//\n// Package a does things.\npackage a\n",
+			want: goHeader + "//\n// Package a does things.\npackage a\n",
+		},
+		{
+			name: "comment without license words",
+			rel:  "a/a.go",
+			data: "// Package a does things.\npackage a\n",
+			want: goHeader + "\n// Package a does things.\npackage a\n",
+		},
+		{
+			name: "directives are not header",
+			rel:  "a/a.go",
+			data: "//go:build linux\n\npackage a\n",
+			want: goHeader + "\n//go:build linux\n\npackage a\n",
+		},
+		{
+			name: "shebang",
+			rel:  "run.sh",
+			data: "#!/bin/sh\n# Copyright 2018 someone\necho\n",
+			want: "#!/bin/sh\n" + hashHeader + "echo\n",
+		},
+		{
+			name: "unknown language",
+			rel:  "README.md",
+			data: "# grafter\n",
+			want: "# grafter\n",
+		},
+		{
+			name: "binary",
+			rel:  "a.go",
+			data: "\x00\x01",
+			want: "\x00\x01",
+		},
+	}
+	for _, tt := range tests {
+		got, err := transformed(l, tt.rel, tt.data)
+		if err != nil || got != tt.want {
+			t.Errorf("%s: got %q, %v, want %q", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestNewLicenseInvalid(t *testing.T) {
+	tests := []map[string]string{
+		nil,
+		{"template": " \n"},
+		{"template": "{{.Missing}}"},
+		{"template_file": "/path/not/exist"},
+	}
+	for _, options := range tests {
+		_, err := NewLicense(&model.Mission{}, model.Transform{Type: "license", Options: options})
+		if err == nil {
+			t.Errorf("NewLicense accepted %v", options)
+		}
+	}
+}
+
+func TestLicenseInvert(t *testing.T) {
+	dir, err := ioutil.TempDir("", "grafter-license")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	l, err := NewLicense(&model.Mission{}, model.Transform{Type: "license", Options: map[string]string{
+		"template": "Copyright © 2020 grafter",
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name, rel, src string
+	}{
+		{"own header", "a.go", "// Copyright 2018 someone\n// Licensed under Apache.\n\npackage a\n"},
+		{"no header", "a.go", "package a\n"},
+		{"package doc", "a.go", "// Copyright 2018 someone\n//\n// Package a does things.\npackage a\n"},
+		{"shebang", "run.sh", "#!/bin/sh\n# Copyright 2018 someone\necho\n"},
+		{"unknown language", "README.md", "# grafter\n"},
+	}
+	for i, tt := range tests {
+		src := filepath.Join(dir, string(rune('a'+i)), tt.rel)
+		writeTestFile(t, src, tt.src)
+
+		f := &File{Rel: tt.rel, Src: src, Data: []byte(tt.src)}
+		if err := l.Transform(f); err != nil {
+			t.Fatal(err)
+		}
+		if err := l.(Inverter).Invert(f); err != nil || string(f.Data) != tt.src {
+			t.Errorf("%s: inverted %q, %v, want %q", tt.name, f.Data, err, tt.src)
+		}
+	}
+
+	// the header is removed from new SRC files
+	f := &File{Rel: "b.go", Src: filepath.Join(dir, "b.go"), Data: []byte("// Copyright © 2020 grafter\n\npackage b\n")}
+	if err := l.(Inverter).Invert(f); err != nil || string(f.Data) != "package b\n" {
+		t.Errorf("inverted new SRC file %q, %v", f.Data, err)
+	}
+}
@@ -0,0 +1,452 @@
+// Copyright © 2018 Mephis Pheies <mephistommm@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package transform
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+
+	"github.com/MephistoMMM/grafter/model"
+	"github.com/MephistoMMM/grafter/util"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func init() {
+	Register("merge", NewMerge)
+}
+
+// Merge merges .yaml, .yml and .json files of SRC into DEST by keys instead
+// of lines. Keys changed in SRC update DEST, keys only in DEST are kept and
+// keys of SRC missing in DEST are appended. With the baseline of the last
+// graft it's a three-way merge: a key changed by both sides is a conflict,
+// a key deleted by one side is removed if the other side didn't change it.
+// Without baseline SRC wins. Documents other than mappings, like sequences
+// or YAML streams of several documents, are merged as a whole value.
+//
+// DEST is kept byte by byte if merging doesn't change it, and so is SRC,
+// otherwise the merged document is marshaled again which keeps key order
+// but loses YAML comments. TOML isn't supported to avoid a new dependency.
+type Merge struct{}
+
+// NewMerge create Merge transformer from spec.
+func NewMerge(M *model.Mission, spec model.Transform) (Transformer, error) {
+	return &Merge{}, nil
+}
+
+// Name ...
+func (m *Merge) Name() string {
+	return "merge"
+}
+
+// mergeFormat decodes and encodes a kind of document.
+type mergeFormat struct {
+	decode func(data []byte) (interface{}, error)
+	encode func(v interface{}, dest []byte) ([]byte, error)
+}
+
+var mergeFormats = map[string]mergeFormat{
+	".yaml": {decodeYAML, encodeYAML},
+	".yml":  {decodeYAML, encodeYAML},
+	".json": {decodeJSON, encodeJSON},
+}
+
+// Transform ...
+func (m *Merge) Transform(f *File) error {
+	format, ok := mergeFormats[strings.ToLower(path.Ext(f.Rel))]
+	if !ok {
+		return nil
+	}
+
+	destData, err := util.ReadFile(f.Dest)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var baseData []byte
+	if f.Base != "" {
+		baseData, err = util.ReadFile(f.Base)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	src, err := format.decode(f.Data)
+	if err != nil {
+		return fmt.Errorf("SRC %v", err)
+	}
+	dest, err := format.decode(destData)
+	if err != nil {
+		return fmt.Errorf("DEST %v", err)
+	}
+	var base interface{}
+	hasBase := baseData != nil
+	if hasBase {
+		if base, err = format.decode(baseData); err != nil {
+			// a broken baseline is as good as none
+			hasBase = false
+		}
+	}
+
+	// the next merge is based on SRC instead of the merged content
+	f.Origin = f.Data
+
+	mg := &merger{}
+	merged := mg.merge("", base, src, dest, hasBase)
+	if len(mg.conflicts) > 0 {
+		return &ConflictError{Rel: f.Rel, Parts: mg.conflicts}
+	}
+
+	switch {
+	case equalValue(merged, dest):
+		f.Data = destData
+	case equalValue(merged, src):
+		// SRC is kept as it is
+	default:
+		f.Data, err = format.encode(merged, destData)
+	}
+	return err
+}
+
+// Invert refuses merged files, which mix DEST into SRC.
+func (m *Merge) Invert(f *File) error {
+	if _, ok := mergeFormats[strings.ToLower(path.Ext(f.Rel))]; ok {
+		return fmt.Errorf("merged content can't be split into SRC and DEST")
+	}
+	return nil
+}
+
+// merger does three-way merge of decoded documents.
+type merger struct {
+	conflicts []string
+}
+
+// merge return the merged value of key, base is meaningful only if hasBase.
+func (mg *merger) merge(key string, base, src, dest interface{}, hasBase bool) interface{} {
+	srcMap, srcOk := src.(yaml.MapSlice)
+	destMap, destOk := dest.(yaml.MapSlice)
+	if srcOk && destOk {
+		baseMap, baseOk := base.(yaml.MapSlice)
+		return mg.mergeMap(key, baseMap, srcMap, destMap, hasBase && baseOk)
+	}
+
+	switch {
+	case equalValue(src, dest):
+		return dest
+	case !hasBase || equalValue(base, dest):
+		return src
+	case equalValue(base, src):
+		return dest
+	}
+	mg.conflict(key)
+	return dest
+}
+
+// mergeMap merges mappings with the key order of dest.
+func (mg *merger) mergeMap(key string, base, src, dest yaml.MapSlice, hasBase bool) yaml.MapSlice {
+	merged := yaml.MapSlice{}
+	for _, item := range dest {
+		sub := joinKey(key, item.Key)
+		baseValue, inBase := lookup(base, item.Key)
+		inBase = inBase && hasBase
+
+		srcValue, inSrc := lookup(src, item.Key)
+		if inSrc {
+			item.Value = mg.merge(sub, baseValue, srcValue, item.Value, inBase)
+			merged = append(merged, item)
+			continue
+		}
+		if !inBase {
+			// only in DEST
+			merged = append(merged, item)
+			continue
+		}
+		// deleted in SRC
+		if !equalValue(baseValue, item.Value) {
+			mg.conflict(sub)
+			merged = append(merged, item)
+		}
+	}
+
+	for _, item := range src {
+		if _, ok := lookup(dest, item.Key); ok {
+			continue
+		}
+		sub := joinKey(key, item.Key)
+		baseValue, inBase := lookup(base, item.Key)
+		if !hasBase || !inBase {
+			// added in SRC
+			merged = append(merged, item)
+			continue
+		}
+		// deleted in DEST
+		if !equalValue(baseValue, item.Value) {
+			mg.conflict(sub)
+		}
+	}
+	return merged
+}
+
+func (mg *merger) conflict(key string) {
+	if key == "" {
+		key = "<root>"
+	}
+	mg.conflicts = append(mg.conflicts, key)
+}
+
+func joinKey(parent string, key interface{}) string {
+	if parent == "" {
+		return fmt.Sprint(key)
+	}
+	return parent + "." + fmt.Sprint(key)
+}
+
+func lookup(m yaml.MapSlice, key interface{}) (interface{}, bool) {
+	for _, item := range m {
+		if reflect.DeepEqual(item.Key, key) {
+			return item.Value, true
+		}
+	}
+	return nil, false
+}
+
+// equalValue compares decoded values, the order of keys doesn't matter.
+func equalValue(a, b interface{}) bool {
+	am, aOk := a.(yaml.MapSlice)
+	bm, bOk := b.(yaml.MapSlice)
+	if aOk != bOk {
+		return false
+	}
+	if aOk {
+		if len(am) != len(bm) {
+			return false
+		}
+		for _, item := range am {
+			v, ok := lookup(bm, item.Key)
+			if !ok || !equalValue(item.Value, v) {
+				return false
+			}
+		}
+		return true
+	}
+
+	ad, aOk := a.(yamlDocuments)
+	bd, bOk := b.(yamlDocuments)
+	if aOk != bOk {
+		return false
+	}
+	if aOk {
+		a, b = []interface{}(ad), []interface{}(bd)
+	}
+
+	al, aOk := a.([]interface{})
+	bl, bOk := b.([]interface{})
+	if aOk != bOk {
+		return false
+	}
+	if aOk {
+		if len(al) != len(bl) {
+			return false
+		}
+		for i := range al {
+			if !equalValue(al[i], bl[i]) {
+				return false
+			}
+		}
+		return true
+	}
+
+	return reflect.DeepEqual(a, b)
+}
+
+// yamlDocuments are the documents of a YAML stream with several documents,
+// which are merged as a whole like other values than mappings.
+type yamlDocuments []interface{}
+
+// decodeYAML decodes a YAML stream. A single mapping is decoded into MapSlice
+// to keep the key order, other documents are only compared as a whole, so
+// the order of their keys doesn't matter.
+func decodeYAML(data []byte) (interface{}, error) {
+	var docs yamlDocuments
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var v interface{}
+		err := dec.Decode(&v)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, v)
+	}
+
+	switch len(docs) {
+	case 0:
+		return yaml.MapSlice{}, nil
+	case 1:
+		if _, ok := docs[0].(map[interface{}]interface{}); !ok {
+			return docs[0], nil
+		}
+		var v yaml.MapSlice
+		err := yaml.Unmarshal(data, &v)
+		return v, err
+	}
+	return docs, nil
+}
+
+func encodeYAML(v interface{}, dest []byte) ([]byte, error) {
+	return yaml.Marshal(v)
+}
+
+// decodeJSON decodes a JSON document, objects are decoded into MapSlice to
+// keep the key order.
+func decodeJSON(data []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	v, err := decodeJSONValue(dec)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("unexpected data after JSON value")
+	}
+	return v, nil
+}
+
+func decodeJSONValue(dec *json.Decoder) (interface{}, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch tok {
+	case json.Delim('{'):
+		m := yaml.MapSlice{}
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := decodeJSONValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			m = append(m, yaml.MapItem{Key: key, Value: value})
+		}
+		_, err = dec.Token()
+		return m, err
+	case json.Delim('['):
+		l := []interface{}{}
+		for dec.More() {
+			value, err := decodeJSONValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			l = append(l, value)
+		}
+		_, err = dec.Token()
+		return l, err
+	}
+	return tok, nil
+}
+
+// encodeJSON encodes v with the indent of dest.
+func encodeJSON(v interface{}, dest []byte) ([]byte, error) {
+	indent := "  "
+	for _, line := range strings.Split(string(dest), "\n")[1:] {
+		if trimmed := strings.TrimLeft(line, " \t"); trimmed != "" {
+			if len(trimmed) < len(line) {
+				indent = line[:len(line)-len(trimmed)]
+			}
+			break
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	if err := writeJSON(buf, v, indent, ""); err != nil {
+		return nil, err
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
+
+func writeJSON(buf *bytes.Buffer, v interface{}, indent, prefix string) error {
+	switch v := v.(type) {
+	case yaml.MapSlice:
+		if len(v) == 0 {
+			buf.WriteString("{}")
+			return nil
+		}
+		buf.WriteString("{\n")
+		for i, item := range v {
+			buf.WriteString(prefix + indent)
+			if err := writeJSONScalar(buf, fmt.Sprint(item.Key)); err != nil {
+				return err
+			}
+			buf.WriteString(": ")
+			if err := writeJSON(buf, item.Value, indent, prefix+indent); err != nil {
+				return err
+			}
+			if i < len(v)-1 {
+				buf.WriteByte(',')
+			}
+			buf.WriteByte('\n')
+		}
+		buf.WriteString(prefix + "}")
+	case []interface{}:
+		if len(v) == 0 {
+			buf.WriteString("[]")
+			return nil
+		}
+		buf.WriteString("[\n")
+		for i, value := range v {
+			buf.WriteString(prefix + indent)
+			if err := writeJSON(buf, value, indent, prefix+indent); err != nil {
+				return err
+			}
+			if i < len(v)-1 {
+				buf.WriteByte(',')
+			}
+			buf.WriteByte('\n')
+		}
+		buf.WriteString(prefix + "]")
+	default:
+		return writeJSONScalar(buf, v)
+	}
+	return nil
+}
+
+func writeJSONScalar(buf *bytes.Buffer, v interface{}) error {
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	// Encode always ends with a newline
+	buf.Truncate(buf.Len() - 1)
+	return nil
+}
@@ -0,0 +1,196 @@
+// Copyright © 2018 Mephis Pheies <mephistommm@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package transform
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMergeTransform(t *testing.T) {
+	tests := []struct {
+		name     string
+		rel      string
+		base     string
+		src      string
+		dest     string
+		want     string
+		conflict bool
+	}{
+		{
+			name: "src updates dest keys, dest keys are kept",
+			rel:  "a.yaml",
+			base: "a: 1\nb: 2\n",
+			src:  "a: 1\nb: 3\n",
+			dest: "a: 1\nb: 2\nlocal: x\n",
+			want: "a: 1\nb: 3\nlocal: x\n",
+		},
+		{
+			name: "dest is kept byte by byte if nothing changes",
+			rel:  "a.yml",
+			base: "a: 1\n",
+			src:  "a: 1\n",
+			dest: "# comment\na: 1\n",
+			want: "# comment\na: 1\n",
+		},
+		{
+			name:     "both sides change a scalar",
+			rel:      "a.yaml",
+			base:     "a: 1\n",
+			src:      "a: 2\n",
+			dest:     "a: 3\n",
+			conflict: true,
+		},
+		{
+			name: "src wins without baseline",
+			rel:  "a.yaml",
+			src:  "a: 2\n",
+			dest: "a: 3\nb: 1\n",
+			want: "a: 2\nb: 1\n",
+		},
+		{
+			name: "key deleted in src",
+			rel:  "a.yaml",
+			base: "a: 1\nb: 2\n",
+			src:  "a: 1\n",
+			dest: "a: 1\nb: 2\n",
+			want: "a: 1\n",
+		},
+		{
+			name: "key order of dest is kept",
+			rel:  "a.json",
+			base: `{"b": 1, "a": 1}`,
+			src:  `{"b": 1, "a": 2}`,
+			dest: `{"a": 1, "b": 1, "c": 1}`,
+			want: "{\n  \"a\": 2,\n  \"b\": 1,\n  \"c\": 1\n}\n",
+		},
+		{
+			name: "top-level sequence changed by src",
+			rel:  "a.yaml",
+			base: "- a\n- b\n",
+			src:  "- a\n- c\n",
+			dest: "- a\n- b\n",
+			want: "- a\n- c\n",
+		},
+		{
+			name: "top-level sequence changed by dest",
+			rel:  "a.yaml",
+			base: "- a\n- b\n",
+			src:  "- a\n- b\n",
+			dest: "# local\n- a\n- d\n",
+			want: "# local\n- a\n- d\n",
+		},
+		{
+			name:     "top-level sequence changed by both sides",
+			rel:      "a.yaml",
+			base:     "- a\n",
+			src:      "- b\n",
+			dest:     "- c\n",
+			conflict: true,
+		},
+		{
+			name: "multiple documents changed by src",
+			rel:  "a.yaml",
+			base: "a: 1\n---\nb: 1\n",
+			src:  "a: 1\n---\nb: 2\n",
+			dest: "a: 1\n---\nb: 1\n",
+			want: "a: 1\n---\nb: 2\n",
+		},
+		{
+			name:     "multiple documents changed by both sides",
+			rel:      "a.yaml",
+			base:     "a: 1\n---\nb: 1\n",
+			src:      "a: 2\n---\nb: 1\n",
+			dest:     "a: 1\n---\nb: 2\n",
+			conflict: true,
+		},
+		{
+			name: "other files are not merged",
+			rel:  "a.txt",
+			base: "a",
+			src:  "b",
+			dest: "c",
+			want: "b",
+		},
+	}
+
+	dir, err := ioutil.TempDir("", "grafter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for i, tt := range tests {
+		f := &File{
+			Rel:  tt.rel,
+			Dest: filepath.Join(dir, "dest", tt.rel),
+			Data: []byte(tt.src),
+		}
+		writeTestFile(t, f.Dest, tt.dest)
+		if tt.base != "" {
+			f.Base = filepath.Join(dir, "base", tt.rel)
+			writeTestFile(t, f.Base, tt.base)
+		}
+
+		err := (&Merge{}).Transform(f)
+		if _, ok := err.(*ConflictError); ok != tt.conflict {
+			t.Errorf("%d %s: Transform = %v, want conflict %v", i, tt.name, err, tt.conflict)
+			continue
+		}
+		if tt.conflict {
+			continue
+		}
+		if err != nil {
+			t.Errorf("%d %s: Transform = %v", i, tt.name, err)
+			continue
+		}
+		if string(f.Data) != tt.want {
+			t.Errorf("%d %s: merged %q, want %q", i, tt.name, f.Data, tt.want)
+		}
+	}
+}
+
+func TestMergeInvert(t *testing.T) {
+	tests := []struct {
+		rel     string
+		refused bool
+	}{
+		{"a.yaml", true},
+		{"a.JSON", true},
+		{"a.go", false},
+	}
+	for _, tt := range tests {
+		err := (&Merge{}).Invert(&File{Rel: tt.rel})
+		if (err != nil) != tt.refused {
+			t.Errorf("Invert(%s) = %v, want refused %v", tt.rel, err, tt.refused)
+		}
+	}
+}
+
+func writeTestFile(t *testing.T, path, data string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
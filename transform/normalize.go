@@ -0,0 +1,175 @@
+// Copyright © 2018 Mephis Pheies <mephistommm@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package transform
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"unicode/utf16"
+
+	"github.com/MephistoMMM/grafter/model"
+	"github.com/MephistoMMM/grafter/util"
+)
+
+func init() {
+	Register("normalize", NewNormalize)
+}
+
+var (
+	bomUTF8    = []byte{0xef, 0xbb, 0xbf}
+	bomUTF16LE = []byte{0xff, 0xfe}
+	bomUTF16BE = []byte{0xfe, 0xff}
+)
+
+// Normalize fixes encoding and whitespace of text files. It should be the
+// first transform, so others see normalized UTF-8 text.
+//
+// Options: eol is lf, crlf or keep (default). encoding=utf-8 converts UTF-16
+// files with BOM into UTF-8. bom=strip removes UTF-8 BOM. trailing_space=trim
+// removes spaces and tabs at the end of lines. final_newline=add ensures non
+// empty file ends with a newline.
+type Normalize struct {
+	eol          string
+	toUTF8       bool
+	stripBOM     bool
+	trimSpace    bool
+	finalNewline bool
+}
+
+// NewNormalize create Normalize transformer from spec.
+func NewNormalize(M *model.Mission, spec model.Transform) (Transformer, error) {
+	opts := spec.Options
+	n := &Normalize{
+		eol:          opts["eol"],
+		toUTF8:       opts["encoding"] == "utf-8",
+		stripBOM:     opts["bom"] == "strip",
+		trimSpace:    opts["trailing_space"] == "trim",
+		finalNewline: opts["final_newline"] == "add",
+	}
+
+	switch n.eol {
+	case "":
+		n.eol = "keep"
+	case "lf", "crlf", "keep":
+	default:
+		return nil, fmt.Errorf("unknown eol %q", n.eol)
+	}
+	if e := opts["encoding"]; e != "" && e != "utf-8" && e != "keep" {
+		return nil, fmt.Errorf("unknown encoding %q", e)
+	}
+	return n, nil
+}
+
+// Name ...
+func (n *Normalize) Name() string {
+	return "normalize"
+}
+
+// Transform ...
+func (n *Normalize) Transform(f *File) error {
+	data := f.Data
+	if n.toUTF8 {
+		data = decodeUTF16(data)
+	}
+	if n.stripBOM {
+		data = bytes.TrimPrefix(data, bomUTF8)
+	}
+	if util.IsBinary(data) {
+		f.Data = data
+		return nil
+	}
+
+	var out bytes.Buffer
+	out.Grow(len(data))
+	var lastContent, lastEnding []byte
+	firstEnding := []byte("\n")
+	for i, line := range bytes.SplitAfter(data, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		content, ending := splitEnding(line)
+		if i == 0 && len(ending) > 0 {
+			firstEnding = ending
+		}
+		if n.trimSpace {
+			content = bytes.TrimRight(content, " \t")
+		}
+		ending = n.convert(ending)
+
+		out.Write(content)
+		out.Write(ending)
+		lastContent, lastEnding = content, ending
+	}
+
+	if n.finalNewline && len(lastContent) > 0 && len(lastEnding) == 0 {
+		out.Write(n.convert(firstEnding))
+	}
+	f.Data = out.Bytes()
+	return nil
+}
+
+// convert return the line ending by eol option
+func (n *Normalize) convert(ending []byte) []byte {
+	if len(ending) == 0 {
+		return ending
+	}
+	switch n.eol {
+	case "lf":
+		return []byte("\n")
+	case "crlf":
+		return []byte("\r\n")
+	}
+	return ending
+}
+
+// splitEnding split line into its content and line ending.
+func splitEnding(line []byte) ([]byte, []byte) {
+	if bytes.HasSuffix(line, []byte("\r\n")) {
+		return line[:len(line)-2], line[len(line)-2:]
+	}
+	if bytes.HasSuffix(line, []byte("\n")) {
+		return line[:len(line)-1], line[len(line)-1:]
+	}
+	return line, nil
+}
+
+// decodeUTF16 convert UTF-16 data with BOM into UTF-8, the BOM is kept as
+// UTF-8 BOM. Other data is returned as it is.
+func decodeUTF16(data []byte) []byte {
+	var order binary.ByteOrder
+	switch {
+	case bytes.HasPrefix(data, bomUTF16LE):
+		order = binary.LittleEndian
+	case bytes.HasPrefix(data, bomUTF16BE):
+		order = binary.BigEndian
+	default:
+		return data
+	}
+	if len(data)%2 != 0 {
+		return data
+	}
+
+	units := make([]uint16, 0, len(data)/2)
+	for i := 0; i < len(data); i += 2 {
+		units = append(units, order.Uint16(data[i:]))
+	}
+	return []byte(string(utf16.Decode(units)))
+}
@@ -0,0 +1,116 @@
+// Copyright © 2018 Mephis Pheies <mephistommm@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package transform
+
+import (
+	"testing"
+
+	"github.com/MephistoMMM/grafter/model"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name       string
+		options    map[string]string
+		data, want string
+	}{
+		{
+			name: "keep by default",
+			data: "a \r\nb\n",
+			want: "a \r\nb\n",
+		},
+		{
+			name:    "lf",
+			options: map[string]string{"eol": "lf"},
+			data:    "a\r\nb\r\nc",
+			want:    "a\nb\nc",
+		},
+		{
+			name:    "crlf",
+			options: map[string]string{"eol": "crlf"},
+			data:    "a\nb\r\n",
+			want:    "a\r\nb\r\n",
+		},
+		{
+			name:    "trailing space",
+			options: map[string]string{"trailing_space": "trim"},
+			data:    "a \t\r\nb  \nc ",
+			want:    "a\r\nb\nc",
+		},
+		{
+			name:    "final newline follows the first line ending",
+			options: map[string]string{"final_newline": "add"},
+			data:    "a\r\nb",
+			want:    "a\r\nb\r\n",
+		},
+		{
+			name:    "final newline of empty file",
+			options: map[string]string{"final_newline": "add"},
+			data:    "",
+			want:    "",
+		},
+		{
+			name:    "strip bom",
+			options: map[string]string{"bom": "strip"},
+			data:    "\xef\xbb\xbfa\n",
+			want:    "a\n",
+		},
+		{
+			name:    "utf-16le",
+			options: map[string]string{"encoding": "utf-8", "bom": "strip"},
+			data:    "\xff\xfeh\x00i\x00\n\x00",
+			want:    "hi\n",
+		},
+		{
+			name:    "utf-16be keeps bom",
+			options: map[string]string{"encoding": "utf-8"},
+			data:    "\xfe\xff\x00h\x00i",
+			want:    "\xef\xbb\xbfhi",
+		},
+		{
+			name:    "binary",
+			options: map[string]string{"eol": "lf", "trailing_space": "trim"},
+			data:    "a \r\n\x00",
+			want:    "a \r\n\x00",
+		},
+	}
+	for _, tt := range tests {
+		n, err := NewNormalize(nil, model.Transform{Type: "normalize", Options: tt.options})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := transformed(n, "a.txt", tt.data)
+		if err != nil || got != tt.want {
+			t.Errorf("%s: got %q, %v, want %q", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestNewNormalizeInvalid(t *testing.T) {
+	tests := []map[string]string{
+		{"eol": "cr"},
+		{"encoding": "latin1"},
+	}
+	for _, options := range tests {
+		if _, err := NewNormalize(nil, model.Transform{Type: "normalize", Options: options}); err == nil {
+			t.Errorf("NewNormalize accepted %v", options)
+		}
+	}
+}
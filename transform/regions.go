@@ -0,0 +1,235 @@
+// Copyright © 2018 Mephis Pheies <mephistommm@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package transform
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/MephistoMMM/grafter/model"
+	"github.com/MephistoMMM/grafter/util"
+)
+
+func init() {
+	Register("regions", NewRegions)
+}
+
+// Regions handles marker delimited regions of text files. Lines between
+// "grafter:strip-begin" and "grafter:strip-end" of SRC are removed. Lines
+// between "grafter:keep-begin [name]" and "grafter:keep-end" of DEST are
+// carried over into the region with the same name of the grafted file, so
+// SRC should keep the markers of these regions. Markers could be in any
+// comment syntax, e.g. "// grafter:keep-begin routes".
+//
+// Options: keep and strip change the prefixes of markers.
+type Regions struct {
+	keep, strip string
+}
+
+// NewRegions create Regions transformer from spec.
+func NewRegions(M *model.Mission, spec model.Transform) (Transformer, error) {
+	r := &Regions{
+		keep:  spec.Options["keep"],
+		strip: spec.Options["strip"],
+	}
+	if r.keep == "" {
+		r.keep = "grafter:keep"
+	}
+	if r.strip == "" {
+		r.strip = "grafter:strip"
+	}
+	return r, nil
+}
+
+// Name ...
+func (r *Regions) Name() string {
+	return "regions"
+}
+
+// region is a marked block, begin and end are the indexes of marker lines.
+type region struct {
+	name       string
+	begin, end int
+}
+
+// findRegions return regions delimited by marker-begin and marker-end.
+func findRegions(lines []string, marker string) ([]region, error) {
+	var regions []region
+	open := -1
+	name := ""
+	for i, line := range lines {
+		if j := strings.Index(line, marker+"-begin"); j >= 0 {
+			if open >= 0 {
+				return nil, fmt.Errorf("line %d: nested %s-begin", i+1, marker)
+			}
+			open = i
+			name = strings.TrimSpace(line[j+len(marker+"-begin"):])
+			// ignore the end of block comments
+			name = strings.TrimSpace(strings.TrimSuffix(strings.TrimSuffix(name, "-->"), "*/"))
+			continue
+		}
+		if strings.Contains(line, marker+"-end") {
+			if open < 0 {
+				return nil, fmt.Errorf("line %d: %s-end without begin", i+1, marker)
+			}
+			regions = append(regions, region{name: name, begin: open, end: i})
+			open = -1
+		}
+	}
+	if open >= 0 {
+		return nil, fmt.Errorf("line %d: %s-begin without end", open+1, marker)
+	}
+	return regions, nil
+}
+
+// regionKeys return the key of each region, which is the name or the order
+// among unnamed regions.
+func regionKeys(regions []region) []string {
+	keys := make([]string, len(regions))
+	unnamed := 0
+	for i, rg := range regions {
+		if rg.name != "" {
+			keys[i] = rg.name
+			continue
+		}
+		keys[i] = "#" + strconv.Itoa(unnamed)
+		unnamed++
+	}
+	return keys
+}
+
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.SplitAfter(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// Transform ...
+func (r *Regions) Transform(f *File) error {
+	if util.IsBinary(f.Data) {
+		return nil
+	}
+
+	text := string(f.Data)
+	trailing := strings.HasSuffix(text, "\n")
+	lines := splitLines(text)
+
+	// remove strip regions of SRC
+	strips, err := findRegions(lines, r.strip)
+	if err != nil {
+		return err
+	}
+	for i := len(strips) - 1; i >= 0; i-- {
+		lines = append(lines[:strips[i].begin], lines[strips[i].end+1:]...)
+	}
+
+	// carry keep regions of DEST over
+	destData, err := util.ReadFile(f.Dest)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if lines, err = r.carry(lines, splitLines(string(destData)), "DEST", "SRC"); err != nil {
+		return err
+	}
+
+	text = strings.Join(lines, "")
+	if trailing && text != "" && !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+	f.Data = []byte(text)
+	return nil
+}
+
+// Invert carries keep regions of SRC back over those of DEST, strip regions
+// can't be restored.
+func (r *Regions) Invert(f *File) error {
+	if util.IsBinary(f.Data) {
+		return nil
+	}
+
+	text := string(f.Data)
+	trailing := strings.HasSuffix(text, "\n")
+	srcData, err := util.ReadFile(f.Src)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	lines, err := r.carry(splitLines(text), splitLines(string(srcData)), "SRC", "DEST")
+	if err != nil {
+		return err
+	}
+
+	text = strings.Join(lines, "")
+	if trailing && text != "" && !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+	f.Data = []byte(text)
+	return nil
+}
+
+// carry replaces the inner lines of keep regions of lines by those of the
+// regions with the same keys in lines of other side.
+func (r *Regions) carry(lines, other []string, otherSide, side string) ([]string, error) {
+	otherRegions, err := findRegions(other, r.keep)
+	if err != nil {
+		return nil, fmt.Errorf("%s %v", otherSide, err)
+	}
+	if len(otherRegions) == 0 {
+		return lines, nil
+	}
+	regions, err := findRegions(lines, r.keep)
+	if err != nil {
+		return nil, err
+	}
+
+	kept := map[string][]string{}
+	for i, key := range regionKeys(otherRegions) {
+		rg := otherRegions[i]
+		kept[key] = other[rg.begin+1 : rg.end]
+	}
+
+	keys := regionKeys(regions)
+	var out []string
+	last := 0
+	for i, rg := range regions {
+		inner, ok := kept[keys[i]]
+		if !ok {
+			continue
+		}
+		out = append(out, lines[last:rg.begin+1]...)
+		out = append(out, inner...)
+		last = rg.end
+		delete(kept, keys[i])
+	}
+	out = append(out, lines[last:]...)
+
+	if len(kept) > 0 {
+		keys := make([]string, 0, len(kept))
+		for key := range kept {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		return nil, fmt.Errorf("keep regions %v of %s have no place in %s", keys, otherSide, side)
+	}
+	return out, nil
+}
@@ -0,0 +1,172 @@
+// Copyright © 2018 Mephis Pheies <mephistommm@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package transform
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/MephistoMMM/grafter/model"
+)
+
+func TestRegions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "grafter-regions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	r, err := NewRegions(nil, model.Transform{Type: "regions"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		src     string
+		dest    string // content of DEST, no DEST file if empty
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "strip",
+			src:  "a\n// grafter:strip-begin\nsecret\n// grafter:strip-end\nb\n",
+			want: "a\nb\n",
+		},
+		{
+			name: "strip at end",
+			src:  "a\n# grafter:strip-begin\nsecret\n# grafter:strip-end\n",
+			want: "a\n",
+		},
+		{
+			name: "keep named",
+			src:  "a\n// grafter:keep-begin routes\nsrc\n// grafter:keep-end\nb\n",
+			dest: "x\n// grafter:keep-begin routes\ndest 1\ndest 2\n// grafter:keep-end\ny\n",
+			want: "a\n// grafter:keep-begin routes\ndest 1\ndest 2\n// grafter:keep-end\nb\n",
+		},
+		{
+			name: "keep unnamed in order",
+			src:  "<!-- grafter:keep-begin -->\n1\n<!-- grafter:keep-end -->\n<!-- grafter:keep-begin -->\n2\n<!-- grafter:keep-end -->\n",
+			dest: "<!-- grafter:keep-begin -->\nA\n<!-- grafter:keep-end -->\n<!-- grafter:keep-begin -->\nB\n<!-- grafter:keep-end -->\n",
+			want: "<!-- grafter:keep-begin -->\nA\n<!-- grafter:keep-end -->\n<!-- grafter:keep-begin -->\nB\n<!-- grafter:keep-end -->\n",
+		},
+		{
+			name: "keep without DEST",
+			src:  "// grafter:keep-begin\nsrc\n// grafter:keep-end\n",
+			want: "// grafter:keep-begin\nsrc\n// grafter:keep-end\n",
+		},
+		{
+			name:    "keep region has no place in SRC",
+			src:     "a\n",
+			dest:    "// grafter:keep-begin routes\nx\n// grafter:keep-end\n",
+			wantErr: true,
+		},
+		{
+			name:    "nested",
+			src:     "// grafter:strip-begin\n// grafter:strip-begin\n// grafter:strip-end\n",
+			wantErr: true,
+		},
+		{
+			name:    "end without begin",
+			src:     "// grafter:strip-end\n",
+			wantErr: true,
+		},
+		{
+			name:    "begin without end",
+			src:     "// grafter:strip-begin\n",
+			wantErr: true,
+		},
+	}
+	for i, tt := range tests {
+		dest := filepath.Join(dir, "dest", string(rune('a'+i)))
+		if tt.dest != "" {
+			if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(dest, []byte(tt.dest), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		f := &File{Rel: "a.txt", Dest: dest, Data: []byte(tt.src)}
+		err := r.Transform(f)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected error, got %q", tt.name, f.Data)
+			}
+			continue
+		}
+		if err != nil || string(f.Data) != tt.want {
+			t.Errorf("%s: got %q, %v, want %q", tt.name, f.Data, err, tt.want)
+		}
+	}
+}
+
+func TestRegionsMarkers(t *testing.T) {
+	r, err := NewRegions(nil, model.Transform{Type: "regions", Options: map[string]string{
+		"strip": "internal",
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := transformed(r, "a.txt", "a\n// internal-begin\nb\n// internal-end\n// grafter:strip-begin\n")
+	if want := "a\n// grafter:strip-begin\n"; err != nil || got != want {
+		t.Errorf("got %q, %v, want %q", got, err, want)
+	}
+}
+
+func TestRegionsInvert(t *testing.T) {
+	dir, err := ioutil.TempDir("", "grafter-regions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	r, err := NewRegions(nil, model.Transform{Type: "regions"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	src := filepath.Join(dir, "src", "a.txt")
+	dest := filepath.Join(dir, "dest", "a.txt")
+	const srcData = "a\n// grafter:keep-begin routes\nupstream\n// grafter:keep-end\nb\n"
+	writeTestFile(t, src, srcData)
+	writeTestFile(t, dest, "a\n// grafter:keep-begin routes\nlocal\n// grafter:keep-end\n")
+
+	f := &File{Rel: "a.txt", Src: src, Dest: dest, Data: []byte(srcData)}
+	if err := r.Transform(f); err != nil {
+		t.Fatal(err)
+	}
+	if want := "a\n// grafter:keep-begin routes\nlocal\n// grafter:keep-end\nb\n"; string(f.Data) != want {
+		t.Fatalf("transformed %q, want %q", f.Data, want)
+	}
+	if err := r.(Inverter).Invert(f); err != nil || string(f.Data) != srcData {
+		t.Errorf("inverted %q, %v, want %q", f.Data, err, srcData)
+	}
+
+	// keep regions of SRC must have a place in DEST content
+	f = &File{Rel: "a.txt", Src: src, Data: []byte("a\n")}
+	if err := r.(Inverter).Invert(f); err == nil {
+		t.Errorf("inverted %q without keep regions of SRC", f.Data)
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright © 2018 Mephis Pheies <mephistommm@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package transform
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+
+	"github.com/MephistoMMM/grafter/model"
+	"github.com/MephistoMMM/grafter/util"
+)
+
+func init() {
+	Register("replace", NewReplace)
+	Register("regexp", NewRegexpReplace)
+}
+
+// Replace replaces all literal From by To in text files.
+type Replace struct {
+	from, to []byte
+}
+
+// NewReplace create Replace transformer from spec.
+func NewReplace(M *model.Mission, spec model.Transform) (Transformer, error) {
+	if spec.From == "" {
+		return nil, fmt.Errorf("from is empty")
+	}
+	return &Replace{
+		from: []byte(spec.From),
+		to:   []byte(spec.To),
+	}, nil
+}
+
+// Name ...
+func (r *Replace) Name() string {
+	return "replace"
+}
+
+// Transform ...
+func (r *Replace) Transform(f *File) error {
+	if util.IsBinary(f.Data) {
+		return nil
+	}
+	f.Data = bytes.Replace(f.Data, r.from, r.to, -1)
+	return nil
+}
+
+// Invert ...
+func (r *Replace) Invert(f *File) error {
+	if util.IsBinary(f.Data) {
+		return nil
+	}
+	if len(r.to) == 0 {
+		return fmt.Errorf("removed %q can't be restored", r.from)
+	}
+	f.Data = bytes.Replace(f.Data, r.to, r.from, -1)
+	return nil
+}
+
+// RegexpReplace replaces all matches of regexp From by template To in text
+// files, To could refer to capture groups like $1.
+type RegexpReplace struct {
+	pattern *regexp.Regexp
+	to      []byte
+}
+
+// NewRegexpReplace create RegexpReplace transformer from spec.
+func NewRegexpReplace(M *model.Mission, spec model.Transform) (Transformer, error) {
+	pattern, err := regexp.Compile(spec.From)
+	if err != nil {
+		return nil, err
+	}
+	return &RegexpReplace{
+		pattern: pattern,
+		to:      []byte(spec.To),
+	}, nil
+}
+
+// Name ...
+func (rr *RegexpReplace) Name() string {
+	return "regexp"
+}
+
+// Transform ...
+func (rr *RegexpReplace) Transform(f *File) error {
+	if util.IsBinary(f.Data) {
+		return nil
+	}
+	f.Data = rr.pattern.ReplaceAll(f.Data, rr.to)
+	return nil
+}
@@ -0,0 +1,92 @@
+// Copyright © 2018 Mephis Pheies <mephistommm@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package transform
+
+import (
+	"testing"
+
+	"github.com/MephistoMMM/grafter/model"
+)
+
+func TestReplace(t *testing.T) {
+	tests := []struct {
+		spec       model.Transform
+		data, want string
+	}{
+		{model.Transform{Type: "replace", From: "foo", To: "bar"}, "foo foo\n", "bar bar\n"},
+		{model.Transform{Type: "replace", From: "foo", To: ""}, "a foo b\n", "a  b\n"},
+		{model.Transform{Type: "replace", From: "foo", To: "bar"}, "nothing\n", "nothing\n"},
+		// binary files are left as they are
+		{model.Transform{Type: "replace", From: "foo", To: "bar"}, "foo\x00", "foo\x00"},
+		{model.Transform{Type: "regexp", From: `v(\d+)`, To: "version $1"}, "v1 and v22\n", "version 1 and version 22\n"},
+		{model.Transform{Type: "regexp", From: `(?m)^// DEBUG.*\n`, To: ""}, "a\n// DEBUG x\nb\n", "a\nb\n"},
+		{model.Transform{Type: "regexp", From: `foo`, To: "bar"}, "foo\x00", "foo\x00"},
+	}
+	for _, tt := range tests {
+		tr, err := factories[tt.spec.Type](&model.Mission{}, tt.spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := transformed(tr, "a.txt", tt.data)
+		if err != nil || got != tt.want {
+			t.Errorf("%s %q -> %q on %q = %q, %v, want %q", tt.spec.Type, tt.spec.From, tt.spec.To, tt.data, got, err, tt.want)
+		}
+	}
+}
+
+func TestNewReplaceInvalid(t *testing.T) {
+	if _, err := NewReplace(nil, model.Transform{Type: "replace", To: "a"}); err == nil {
+		t.Error("NewReplace accepted empty from")
+	}
+	if _, err := NewRegexpReplace(nil, model.Transform{Type: "regexp", From: "("}); err == nil {
+		t.Error("NewRegexpReplace accepted invalid regexp")
+	}
+}
+
+func TestReplaceInvert(t *testing.T) {
+	tests := []struct {
+		from, to, data string
+	}{
+		{"foo", "bar", "foo and foo\n"},
+		{"github.com/a", "example.com/b", "import \"github.com/a/x\"\n"},
+		{"foo", "bar", "foo\x00"},
+	}
+	for _, tt := range tests {
+		r, err := NewReplace(nil, model.Transform{Type: "replace", From: tt.from, To: tt.to})
+		if err != nil {
+			t.Fatal(err)
+		}
+		f := &File{Rel: "a.txt", Data: []byte(tt.data)}
+		if err := r.Transform(f); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.(Inverter).Invert(f); err != nil || string(f.Data) != tt.data {
+			t.Errorf("%q -> %q: inverted %q, %v, want %q", tt.from, tt.to, f.Data, err, tt.data)
+		}
+	}
+
+	r, err := NewReplace(nil, model.Transform{Type: "replace", From: "foo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.(Inverter).Invert(&File{Rel: "a.txt", Data: []byte("a\n")}); err == nil {
+		t.Error("removed text is restored")
+	}
+}
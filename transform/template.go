@@ -0,0 +1,111 @@
+// Copyright © 2018 Mephis Pheies <mephistommm@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package transform
+
+import (
+	"bytes"
+	"strings"
+	"text/template"
+
+	"github.com/MephistoMMM/grafter/model"
+)
+
+func init() {
+	Register("template", NewTemplate)
+}
+
+// Template renders SRC files as text/template with Vars of mission. A file is
+// a template if its name has the suffix (".tmpl" by default), which is
+// stripped in DEST, or if its first line contains the marker, which is
+// removed from the rendered file.
+//
+// Options: suffix, marker, left and right delimiters.
+type Template struct {
+	vars        map[string]string
+	suffix      string
+	marker      string
+	left, right string
+}
+
+// NewTemplate create Template transformer from spec.
+func NewTemplate(M *model.Mission, spec model.Transform) (Transformer, error) {
+	t := &Template{
+		vars:   M.Vars,
+		suffix: spec.Options["suffix"],
+		marker: spec.Options["marker"],
+		left:   spec.Options["left"],
+		right:  spec.Options["right"],
+	}
+	if t.suffix == "" && t.marker == "" {
+		t.suffix = ".tmpl"
+	}
+	return t, nil
+}
+
+// Name ...
+func (t *Template) Name() string {
+	return "template"
+}
+
+// Rename strips the template suffix.
+func (t *Template) Rename(rel string) string {
+	if t.suffix != "" && strings.HasSuffix(rel, t.suffix) && len(rel) > len(t.suffix) {
+		return rel[:len(rel)-len(t.suffix)]
+	}
+	return rel
+}
+
+// Transform ...
+func (t *Template) Transform(f *File) error {
+	data := f.Data
+	switch {
+	case t.suffix != "" && strings.HasSuffix(f.Src, t.suffix):
+	case t.marker != "" && bytes.Contains(firstLine(data), []byte(t.marker)):
+		data = data[len(firstLine(data)):]
+		if len(data) > 0 {
+			// drop the newline of marker line
+			data = data[1:]
+		}
+	default:
+		return nil
+	}
+
+	tmpl, err := template.New(f.Rel).
+		Delims(t.left, t.right).
+		Option("missingkey=error").
+		Parse(string(data))
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, t.vars); err != nil {
+		return err
+	}
+	f.Data = buf.Bytes()
+	return nil
+}
+
+func firstLine(data []byte) []byte {
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		return data[:i]
+	}
+	return data
+}
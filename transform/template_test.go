@@ -0,0 +1,125 @@
+// Copyright © 2018 Mephis Pheies <mephistommm@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package transform
+
+import (
+	"testing"
+
+	"github.com/MephistoMMM/grafter/model"
+)
+
+func TestTemplate(t *testing.T) {
+	M := &model.Mission{Vars: map[string]string{"Name": "grafter"}}
+
+	tests := []struct {
+		name    string
+		options map[string]string
+		src     string
+		data    string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "suffix",
+			src:  "README.md.tmpl",
+			data: "# {{.Name}}\n",
+			want: "# grafter\n",
+		},
+		{
+			name: "no suffix",
+			src:  "README.md",
+			data: "# {{.Name}}\n",
+			want: "# {{.Name}}\n",
+		},
+		{
+			name:    "marker",
+			options: map[string]string{"marker": "grafter:template"},
+			src:     "README.md",
+			data:    "<!-- grafter:template -->\n# {{.Name}}\n",
+			want:    "# grafter\n",
+		},
+		{
+			name:    "marker not in first line",
+			options: map[string]string{"marker": "grafter:template"},
+			src:     "README.md",
+			data:    "# {{.Name}}\n<!-- grafter:template -->\n",
+			want:    "# {{.Name}}\n<!-- grafter:template -->\n",
+		},
+		{
+			name:    "delimiters",
+			options: map[string]string{"left": "[[", "right": "]]"},
+			src:     "a.yaml.tmpl",
+			data:    "name: [[.Name]]\nvalue: {{ x }}\n",
+			want:    "name: grafter\nvalue: {{ x }}\n",
+		},
+		{
+			name:    "missing variable",
+			src:     "a.tmpl",
+			data:    "{{.Missing}}",
+			wantErr: true,
+		},
+		{
+			name:    "invalid template",
+			src:     "a.tmpl",
+			data:    "{{.Name",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		tr, err := NewTemplate(M, model.Transform{Type: "template", Options: tt.options})
+		if err != nil {
+			t.Fatal(err)
+		}
+		f := &File{Rel: tt.src, Src: tt.src, Data: []byte(tt.data)}
+		err = tr.Transform(f)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected error, got %q", tt.name, f.Data)
+			}
+			continue
+		}
+		if err != nil || string(f.Data) != tt.want {
+			t.Errorf("%s: got %q, %v, want %q", tt.name, f.Data, err, tt.want)
+		}
+	}
+}
+
+func TestChainRename(t *testing.T) {
+	M := &model.Mission{Transforms: []model.Transform{
+		{Type: "template", Files: []string{"docs/*"}},
+	}}
+	chain, err := NewChain(M)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		rel, want string
+	}{
+		{"docs/a.md.tmpl", "docs/a.md"},
+		{"a.md.tmpl", "a.md.tmpl"},
+		{"docs/a.md", "docs/a.md"},
+	}
+	for _, tt := range tests {
+		if got := chain.Rename(tt.rel); got != tt.want {
+			t.Errorf("Rename(%q) = %q, want %q", tt.rel, got, tt.want)
+		}
+	}
+}
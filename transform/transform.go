@@ -0,0 +1,250 @@
+// Copyright © 2018 Mephis Pheies <mephistommm@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+//
+// Package transform rewrites the content of files while they are grafted from
+// SRC to DEST.
+package transform
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/MephistoMMM/grafter/model"
+	"github.com/MephistoMMM/grafter/util"
+)
+
+// File is the content of a SRC file on its way to DEST.
+type File struct {
+	// Rel is the slash separated path relative to DEST.
+	Rel  string
+	Src  string
+	Dest string
+	// Base is the baseline file holding the content last grafted into Dest,
+	// it's empty or doesn't exist if there is no baseline.
+	Base string
+	Data []byte
+	// Origin is recorded as baseline instead of Data if it's not nil. It's
+	// set by transformers mixing DEST into Data.
+	Origin []byte
+}
+
+// ConflictError is returned by transformers when SRC and DEST changed the
+// same part of file since the last graft.
+type ConflictError struct {
+	Rel   string
+	Parts []string
+}
+
+// Error ...
+func (ce *ConflictError) Error() string {
+	return fmt.Sprintf("%s is changed by both sides at %s", ce.Rel, strings.Join(ce.Parts, ", "))
+}
+
+// Transformer rewrites Data of File.
+type Transformer interface {
+	Name() string
+	Transform(f *File) error
+}
+
+// Inverter is implemented by transformers whose output could be turned back
+// into SRC content, which is required by reverse graft. Invert rewrites Data
+// of f from DEST content into SRC content, the SRC file of f may not exist.
+type Inverter interface {
+	Invert(f *File) error
+}
+
+// Renamer is implemented by transformers which change the DEST path of file,
+// e.g. to strip the suffix of template. It is applied while SRC is walked.
+type Renamer interface {
+	Rename(rel string) string
+}
+
+// Factory create a Transformer from its configuration in mission.
+type Factory func(M *model.Mission, spec model.Transform) (Transformer, error)
+
+var factories = map[string]Factory{}
+
+// Register makes a Transformer available by the type name in configuration
+// of mission. It should be called in init function of the transformer.
+func Register(name string, factory Factory) {
+	if _, ok := factories[name]; ok {
+		panic("transform: Register called twice for " + name)
+	}
+	factories[name] = factory
+}
+
+// Types return the names of all registered transformers.
+func Types() []string {
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Chain applies transformers in order.
+type Chain []Transformer
+
+// NewChain create Chain from Transforms field of mission.
+func NewChain(M *model.Mission) (Chain, error) {
+	chain := make(Chain, 0, len(M.Transforms))
+	for _, spec := range M.Transforms {
+		factory, ok := factories[spec.Type]
+		if !ok {
+			return nil, fmt.Errorf("unknown transform type %q, available: %s",
+				spec.Type, strings.Join(Types(), ", "))
+		}
+		t, err := factory(M, spec)
+		if err != nil {
+			return nil, fmt.Errorf("transform %s: %v", spec.Type, err)
+		}
+		if len(spec.Files) > 0 {
+			t = &scoped{Transformer: t, patterns: spec.Files}
+		}
+		chain = append(chain, t)
+	}
+	return chain, nil
+}
+
+// Transform rewrites f by each transformer of chain.
+func (c Chain) Transform(f *File) error {
+	for _, t := range c {
+		if err := t.Transform(f); err != nil {
+			return fmt.Errorf("%s failed to transform %s: %w", t.Name(), f.Rel, err)
+		}
+	}
+	return nil
+}
+
+// Invert rewrites f back by each Inverter of chain in reverse order, other
+// transformers are supposed to keep the content.
+func (c Chain) Invert(f *File) error {
+	for i := len(c) - 1; i >= 0; i-- {
+		inv, ok := c[i].(Inverter)
+		if !ok {
+			continue
+		}
+		if err := inv.Invert(f); err != nil {
+			return fmt.Errorf("%s can't invert %s: %w", c[i].Name(), f.Rel, err)
+		}
+	}
+	return nil
+}
+
+// Reverse turns DEST content Data of f into SRC content. To make sure no
+// information is lost, the result must be transformed into the same DEST
+// content, and the current SRC file must be turned back into itself.
+func (c Chain) Reverse(f *File) error {
+	destData := f.Data
+	if err := c.Invert(f); err != nil {
+		return err
+	}
+
+	check := &File{Rel: f.Rel, Src: f.Src, Dest: f.Dest, Base: f.Base, Data: f.Data}
+	if err := c.Transform(check); err != nil {
+		return err
+	}
+	if !bytes.Equal(check.Data, destData) {
+		return fmt.Errorf("transforms of %s can't be inverted, the inverted content is transformed differently", f.Rel)
+	}
+
+	srcData, err := util.ReadFile(f.Src)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	// transformed without DEST, which only changes the result of mixing
+	check = &File{Rel: f.Rel, Src: f.Src, Data: srcData}
+	if err := c.Transform(check); err != nil {
+		return err
+	}
+	if err := c.Invert(check); err != nil {
+		return err
+	}
+	if !bytes.Equal(check.Data, srcData) {
+		return fmt.Errorf("transforms of %s can't be inverted, SRC is not restored from its transformed content", f.Rel)
+	}
+	return nil
+}
+
+// Rename return the DEST path of rel changed by each Renamer of chain.
+func (c Chain) Rename(rel string) string {
+	for _, t := range c {
+		if r, ok := t.(Renamer); ok {
+			rel = r.Rename(rel)
+		}
+	}
+	return rel
+}
+
+// scoped limits Transformer to files matched by patterns.
+type scoped struct {
+	Transformer
+	patterns []string
+}
+
+// Transform ...
+func (s *scoped) Transform(f *File) error {
+	if !Match(s.patterns, f.Rel) {
+		return nil
+	}
+	return s.Transformer.Transform(f)
+}
+
+// Invert ...
+func (s *scoped) Invert(f *File) error {
+	inv, ok := s.Transformer.(Inverter)
+	if !ok || !Match(s.patterns, f.Rel) {
+		return nil
+	}
+	return inv.Invert(f)
+}
+
+// Rename ...
+func (s *scoped) Rename(rel string) string {
+	r, ok := s.Transformer.(Renamer)
+	if !ok || !Match(s.patterns, rel) {
+		return rel
+	}
+	return r.Rename(rel)
+}
+
+// Match reports whether rel is matched by any of shell patterns. A pattern
+// without slash is matched against the base name of rel, otherwise against
+// the whole rel, e.g. "*.go" and "cmd/*.go".
+func Match(patterns []string, rel string) bool {
+	for _, p := range patterns {
+		target := rel
+		if !strings.Contains(p, "/") {
+			target = path.Base(rel)
+		}
+		if ok, _ := path.Match(p, target); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,153 @@
+// Copyright © 2018 Mephis Pheies <mephistommm@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package transform
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/MephistoMMM/grafter/model"
+)
+
+// transformed return data of DEST file rel transformed by t.
+func transformed(t interface{ Transform(*File) error }, rel, data string) (string, error) {
+	f := &File{Rel: rel, Data: []byte(data)}
+	err := t.Transform(f)
+	return string(f.Data), err
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		rel      string
+		matched  bool
+	}{
+		{[]string{"*.go"}, "main.go", true},
+		{[]string{"*.go"}, "cmd/root.go", true},
+		{[]string{"cmd/*.go"}, "cmd/root.go", true},
+		{[]string{"cmd/*.go"}, "main.go", false},
+		{[]string{"*.md", "*.txt"}, "docs/a.txt", true},
+		{nil, "main.go", false},
+	}
+	for _, tt := range tests {
+		if got := Match(tt.patterns, tt.rel); got != tt.matched {
+			t.Errorf("Match(%v, %q) = %v, want %v", tt.patterns, tt.rel, got, tt.matched)
+		}
+	}
+}
+
+func TestChain(t *testing.T) {
+	M := &model.Mission{Transforms: []model.Transform{
+		{Type: "replace", From: "old", To: "new"},
+		{Type: "regexp", From: `new\.(\w+)`, To: "new/$1", Files: []string{"*.go"}},
+	}}
+	chain, err := NewChain(M)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		rel, data, want string
+	}{
+		// transformers are applied in order
+		{"a.go", "old.pkg", "new/pkg"},
+		// files out of scope are left to the next transformer
+		{"a.md", "old.pkg", "new.pkg"},
+		{"a.go", "nothing", "nothing"},
+	}
+	for _, tt := range tests {
+		got, err := transformed(chain, tt.rel, tt.data)
+		if err != nil || got != tt.want {
+			t.Errorf("Transform(%s %q) = %q, %v, want %q", tt.rel, tt.data, got, err, tt.want)
+		}
+	}
+}
+
+func TestNewChainInvalid(t *testing.T) {
+	tests := []model.Transform{
+		{Type: "unknown"},
+		{Type: "replace"},
+	}
+	for _, spec := range tests {
+		M := &model.Mission{Transforms: []model.Transform{spec}}
+		if _, err := NewChain(M); err == nil {
+			t.Errorf("NewChain accepted %v", spec)
+		}
+	}
+}
+
+func TestChainReverse(t *testing.T) {
+	dir, err := ioutil.TempDir("", "grafter-reverse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	M := &model.Mission{Transforms: []model.Transform{
+		{Type: "replace", From: "old", To: "new"},
+		{Type: "template"},
+	}}
+	chain, err := NewChain(M)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name, src, dest, want string
+		wantErr               bool
+	}{
+		{
+			name: "inverted",
+			src:  "old\n",
+			dest: "new and new\n",
+			want: "old and old\n",
+		},
+		{
+			name: "SRC doesn't exist",
+			dest: "new\n",
+			want: "old\n",
+		},
+		{
+			name:    "SRC has the replaced text",
+			src:     "old and new\n",
+			dest:    "new\n",
+			wantErr: true,
+		},
+	}
+	for i, tt := range tests {
+		src := filepath.Join(dir, string(rune('a'+i)))
+		if tt.src != "" {
+			writeTestFile(t, src, tt.src)
+		}
+		f := &File{Rel: "a.txt", Src: src, Data: []byte(tt.dest)}
+		err := chain.Reverse(f)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected error, got %q", tt.name, f.Data)
+			}
+			continue
+		}
+		if err != nil || string(f.Data) != tt.want {
+			t.Errorf("%s: got %q, %v, want %q", tt.name, f.Data, err, tt.want)
+		}
+	}
+}
@@ -20,6 +20,7 @@
 package util
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -32,23 +33,81 @@ import (
 // BaseSupport struct , 2.some concrete Support, 3.Check function with IgnoreSupport
 // parameter calling each IsIgnore method of each IgnoreSupport in chain of repositories.
 
+// ErrorPolicy decides what Check does when an IgnoreSupport fails to judge
+// a path.
+type ErrorPolicy int
+
+const (
+	// FailClosed treats the path as ignored, so nothing is grafted by mistake.
+	FailClosed ErrorPolicy = iota
+	// FailOpen skips the failed support and asks the next one in chain.
+	FailOpen
+	// FailAbort stops the whole graft.
+	FailAbort
+)
+
+var errorPolicyNames = map[ErrorPolicy]string{
+	FailClosed: "fail-closed",
+	FailOpen:   "fail-open",
+	FailAbort:  "abort",
+}
+
+// ParseErrorPolicy convert the name of policy to ErrorPolicy.
+func ParseErrorPolicy(name string) (ErrorPolicy, error) {
+	for p, n := range errorPolicyNames {
+		if n == name {
+			return p, nil
+		}
+	}
+	return FailClosed, fmt.Errorf("unknown error policy: %s", name)
+}
+
+// String return the name of policy
+func (p ErrorPolicy) String() string {
+	return errorPolicyNames[p]
+}
+
+// CheckError records the failure of an IgnoreSupport.
+type CheckError struct {
+	Support string
+	Path    string
+	Policy  ErrorPolicy
+	Err     error
+}
+
+// Error ...
+func (ce *CheckError) Error() string {
+	return fmt.Sprintf("%s failed to check %s (%s): %v",
+		ce.Support, ce.Path, ce.Policy, ce.Err)
+}
+
+// IsAbort reports whether err asks to abort the graft.
+func IsAbort(err error) bool {
+	ce, ok := err.(*CheckError)
+	return ok && ce.Policy == FailAbort
+}
+
 // IgnoreSupport is a part of abstract Support.
 type IgnoreSupport interface {
 	SetNext(IgnoreSupport) IgnoreSupport
 	SetNexts([]IgnoreSupport) IgnoreSupport
 	Next() IgnoreSupport
+	SetPolicy(ErrorPolicy)
+	Policy() ErrorPolicy
+	Name() string
 	String() string
 
 	IsIgnore(path string, info os.FileInfo) (bool, error)
 	Done(path string, info os.FileInfo)
-	Fail(path string, info os.FileInfo)
+	Fail(path string, info os.FileInfo, err error)
 }
 
 // BaseSupport implements almost methods of IgnoreSupport interface except
 // `IsIgnore`. It should be embeded into a concrete IgnoreSupport.
 type BaseSupport struct {
-	next IgnoreSupport
-	name string
+	next   IgnoreSupport
+	name   string
+	policy ErrorPolicy
 }
 
 // SetName set n to name
@@ -83,6 +142,21 @@ func (bs *BaseSupport) Next() IgnoreSupport {
 	return bs.next
 }
 
+// SetPolicy set p to policy, FailClosed is used by default.
+func (bs *BaseSupport) SetPolicy(p ErrorPolicy) {
+	bs.policy = p
+}
+
+// Policy return policy.
+func (bs *BaseSupport) Policy() ErrorPolicy {
+	return bs.policy
+}
+
+// Name return name.
+func (bs *BaseSupport) Name() string {
+	return bs.name
+}
+
 // String describe the chain of IgnoreSupport
 func (bs *BaseSupport) String() string {
 	if bs.Next() == nil {
@@ -96,43 +170,86 @@ func (bs *BaseSupport) Done(path string, info os.FileInfo) {
 	Logger.Debugf("%s ignored by %s\n", path, bs.name)
 }
 
-// Fail does nothing but implement IgnoreSupport interface
-func (bs *BaseSupport) Fail(path string, info os.FileInfo) {
+// Fail logs the error raised by IsIgnore
+func (bs *BaseSupport) Fail(path string, info os.FileInfo, err error) {
+	Logger.Warnf("%s failed to check %s: %v", bs.name, path, err)
 }
 
 // Check calls each IsIgnore method of each IgnoreSupport in chain of repositories.
-func Check(checker IgnoreSupport, path string, info os.FileInfo) bool {
+// When a support fails, the result follows its ErrorPolicy and the failure is
+// returned as *CheckError, so callers could collect it or abort with IsAbort.
+func Check(checker IgnoreSupport, path string, info os.FileInfo) (bool, error) {
 	if checker == nil {
-		return true
+		return true, nil
 	}
 
+	var firstErr error
 	for checker != nil {
 		result, err := checker.IsIgnore(path, info)
 		if err != nil {
-			checker.Fail(path, info)
+			checker.Fail(path, info, err)
+			ce := &CheckError{
+				Support: checker.Name(),
+				Path:    path,
+				Policy:  checker.Policy(),
+				Err:     err,
+			}
+
+			if ce.Policy != FailOpen {
+				return true, ce
+			}
+			if firstErr == nil {
+				firstErr = ce
+			}
+			result = false
 		}
 
 		if result {
 			checker.Done(path, info)
-			return true
+			return true, firstErr
 		}
 
 		checker = checker.Next()
 	}
 
-	return false
+	return false, firstErr
 }
 
+// CheckFailed decides whether path should be ignored when its status or
+// content could not be read, err is the failure. The policy of the support
+// judging status of files in chain, IgnoreUnregularSupport, is followed, or
+// FailClosed if there is none. The failure is always returned as
+// *CheckError.
+func CheckFailed(checker IgnoreSupport, path string, info os.FileInfo, err error) (bool, error) {
+	ce := &CheckError{
+		Support: "IgnoreUnregularSupport",
+		Path:    path,
+		Policy:  FailClosed,
+		Err:     err,
+	}
+	for is := checker; is != nil; is = is.Next() {
+		if _, ok := is.(*IgnoreSpecialMadeSupport); ok {
+			is.Fail(path, info, err)
+			ce.Support, ce.Policy = is.Name(), is.Policy()
+			break
+		}
+	}
+	return ce.Policy != FailOpen, ce
+}
+
+// IgnoreRegexpMatchSupport ignore files whose path relative to base matches
+// pattern. The relative path is slash separated, e.g. "docs/index.md".
 type IgnoreRegexpMatchSupport struct {
 	BaseSupport
 
+	base    string
 	pattern *regexp.Regexp
 }
 
-func NewMultiIgnoreRegexpMatchSupports(exprs []string) ([]IgnoreSupport, error) {
+func NewMultiIgnoreRegexpMatchSupports(base string, exprs []string) ([]IgnoreSupport, error) {
 	iss := make([]IgnoreSupport, 0, len(exprs))
 	for _, exprs := range exprs {
-		is, err := NewIgnoreRegexpMatchSupport(exprs)
+		is, err := NewIgnoreRegexpMatchSupport(base, exprs)
 		if err != nil {
 			return nil, err
 		}
@@ -142,13 +259,14 @@ func NewMultiIgnoreRegexpMatchSupports(exprs []string) ([]IgnoreSupport, error)
 	return iss, nil
 }
 
-func NewIgnoreRegexpMatchSupport(expr string) (IgnoreSupport, error) {
+func NewIgnoreRegexpMatchSupport(base, expr string) (IgnoreSupport, error) {
 	pattern, err := regexp.Compile(expr)
 	if err != nil {
 		return nil, err
 	}
 
 	is := &IgnoreRegexpMatchSupport{
+		base:    base,
 		pattern: pattern,
 	}
 	is.SetName("IgnoreRegexpMatchSupport")
@@ -157,7 +275,15 @@ func NewIgnoreRegexpMatchSupport(expr string) (IgnoreSupport, error) {
 
 // IsIgnore ...
 func (irms *IgnoreRegexpMatchSupport) IsIgnore(path string, info os.FileInfo) (bool, error) {
-	if irms.pattern.MatchString(path) {
+	rel, err := filepath.Rel(irms.base, path)
+	if err != nil {
+		return false, err
+	}
+	// never ignore the base directory itself
+	if rel == "." {
+		return false, nil
+	}
+	if irms.pattern.MatchString(filepath.ToSlash(rel)) {
 		return true, nil
 	}
 	return false, nil
@@ -207,20 +333,24 @@ func (ids *IgnoreDotSupport) IsIgnore(path string, info os.FileInfo) (bool, erro
 	return false, nil
 }
 
+// GitIgnoreSupport ignore files matched by .gitignore files of path and its
+// parent directories.
 type GitIgnoreSupport struct {
 	BaseSupport
 
 	checker *gitignore.Checker
+	// err is the failure of loading .gitignore files, every path fails to be
+	// checked with it, so its policy decides.
+	err error
 }
 
+// NewGitIgnoreSupport create GitIgnoreSupport of path. Failures of reading
+// .gitignore files are reported by IsIgnore instead of here.
 func NewGitIgnoreSupport(path string) (IgnoreSupport, error) {
 	checker := gitignore.NewChecker()
-	if err := checker.LoadBasePath(path); err != nil {
-		return nil, err
-	}
-
 	is := &GitIgnoreSupport{
 		checker: checker,
+		err:     checker.LoadBasePath(path),
 	}
 	is.SetName("GitIgnoreSupport")
 	return is, nil
@@ -228,5 +358,8 @@ func NewGitIgnoreSupport(path string) (IgnoreSupport, error) {
 
 // IsIgnore ...
 func (gis *GitIgnoreSupport) IsIgnore(path string, info os.FileInfo) (bool, error) {
+	if gis.err != nil {
+		return false, gis.err
+	}
 	return gis.checker.Check(path, info), nil
 }
@@ -0,0 +1,209 @@
+// Copyright © 2018 Mephis Pheies <mephistommm@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package util
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// stubSupport answers every path with ignore and err.
+type stubSupport struct {
+	BaseSupport
+	ignore bool
+	err    error
+}
+
+func newStubSupport(name string, ignore bool, err error, policy ErrorPolicy) *stubSupport {
+	s := &stubSupport{ignore: ignore, err: err}
+	s.SetName(name)
+	s.SetPolicy(policy)
+	return s
+}
+
+func (s *stubSupport) IsIgnore(path string, info os.FileInfo) (bool, error) {
+	return s.ignore, s.err
+}
+
+func TestCheckErrorPolicy(t *testing.T) {
+	failure := errors.New("broken")
+	tests := []struct {
+		name    string
+		chain   []IgnoreSupport
+		ignored bool
+		err     bool
+		abort   bool
+	}{
+		{
+			name:  "no error",
+			chain: []IgnoreSupport{newStubSupport("a", false, nil, FailClosed)},
+		},
+		{
+			name:    "fail closed ignores path",
+			chain:   []IgnoreSupport{newStubSupport("a", false, failure, FailClosed), newStubSupport("b", false, nil, FailClosed)},
+			ignored: true,
+			err:     true,
+		},
+		{
+			name:  "fail open asks next support",
+			chain: []IgnoreSupport{newStubSupport("a", false, failure, FailOpen), newStubSupport("b", false, nil, FailClosed)},
+			err:   true,
+		},
+		{
+			name:    "fail open keeps ignore of next support",
+			chain:   []IgnoreSupport{newStubSupport("a", false, failure, FailOpen), newStubSupport("b", true, nil, FailClosed)},
+			ignored: true,
+			err:     true,
+		},
+		{
+			name:    "abort",
+			chain:   []IgnoreSupport{newStubSupport("a", false, failure, FailAbort)},
+			ignored: true,
+			err:     true,
+			abort:   true,
+		},
+		{
+			name:    "ignored before failure",
+			chain:   []IgnoreSupport{newStubSupport("a", true, nil, FailClosed), newStubSupport("b", false, failure, FailAbort)},
+			ignored: true,
+		},
+	}
+	for _, tt := range tests {
+		head := tt.chain[0]
+		head.SetNexts(tt.chain[1:])
+		ignored, err := Check(head, "/src/a", nil)
+		if ignored != tt.ignored || (err != nil) != tt.err || IsAbort(err) != tt.abort {
+			t.Errorf("%s: Check = %v, %v, want ignored %v, error %v, abort %v",
+				tt.name, ignored, err, tt.ignored, tt.err, tt.abort)
+		}
+		if ce, ok := err.(*CheckError); err != nil && (!ok || ce.Err != failure) {
+			t.Errorf("%s: Check returned %#v, want *CheckError of the failure", tt.name, err)
+		}
+	}
+}
+
+func TestCheckFailed(t *testing.T) {
+	failure := errors.New("permission denied")
+	tests := []struct {
+		name    string
+		policy  *ErrorPolicy
+		ignored bool
+		abort   bool
+	}{
+		{name: "no unregular support", ignored: true},
+		{name: "fail closed", policy: policyOf(FailClosed), ignored: true},
+		{name: "fail open", policy: policyOf(FailOpen)},
+		{name: "abort", policy: policyOf(FailAbort), ignored: true, abort: true},
+	}
+	for _, tt := range tests {
+		var chain IgnoreSupport = newStubSupport("a", false, nil, FailAbort)
+		if tt.policy != nil {
+			unregular, _ := NewIgnoreUnregularSupport()
+			unregular.SetPolicy(*tt.policy)
+			chain.SetNext(unregular)
+		}
+		ignored, err := CheckFailed(chain, "/src/a", nil, failure)
+		if ignored != tt.ignored || IsAbort(err) != tt.abort {
+			t.Errorf("%s: CheckFailed = %v, %v, want ignored %v, abort %v", tt.name, ignored, err, tt.ignored, tt.abort)
+		}
+		if ce, ok := err.(*CheckError); !ok || ce.Err != failure {
+			t.Errorf("%s: CheckFailed returned %#v, want *CheckError of the failure", tt.name, err)
+		}
+	}
+}
+
+func policyOf(p ErrorPolicy) *ErrorPolicy {
+	return &p
+}
+
+func TestGitIgnoreSupportLoadFailure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "grafter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// a directory can't be read as .gitignore
+	if err := os.Mkdir(filepath.Join(dir, ".gitignore"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "a"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		policy ErrorPolicy
+		items  int
+		abort  bool
+	}{
+		// the root is ignored, so nothing is walked
+		{policy: FailClosed, items: 1},
+		{policy: FailAbort, items: 1, abort: true},
+	}
+	for _, tt := range tests {
+		is, err := NewGitIgnoreSupport(dir)
+		if err != nil {
+			t.Fatalf("NewGitIgnoreSupport should report failures by IsIgnore: %v", err)
+		}
+		is.SetPolicy(tt.policy)
+
+		w := NewWalker(dir, is, 10)
+		walkErr := make(chan error, 1)
+		go func() { walkErr <- w.Walk() }()
+		var items []*Item
+		for item := range w.Pipe() {
+			items = append(items, item)
+		}
+		err = <-walkErr
+
+		if len(items) != tt.items || items[0].Err == nil {
+			t.Errorf("%s: walked %d items, want %d error items", tt.policy, len(items), tt.items)
+		}
+		if IsAbort(err) != tt.abort {
+			t.Errorf("%s: Walk = %v, want abort %v", tt.policy, err, tt.abort)
+		}
+	}
+}
+
+func TestIgnoreRegexpMatchSupport(t *testing.T) {
+	tests := []struct {
+		expr, path string
+		ignored    bool
+	}{
+		{`^docs/`, "/root/docs/index.md", true},
+		{`^docs/`, "/root/src/docs/index.md", false},
+		// patterns are matched against the path relative to base
+		{`^/root/`, "/root/docs/index.md", false},
+		{`.*`, "/root", false},
+		{`\.tmp$`, "/root/a/b.tmp", true},
+	}
+	for _, tt := range tests {
+		is, err := NewIgnoreRegexpMatchSupport("/root", tt.expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ignored, err := is.IsIgnore(tt.path, nil)
+		if err != nil || ignored != tt.ignored {
+			t.Errorf("IsIgnore(%q) by %q = %v, %v, want %v", tt.path, tt.expr, ignored, err, tt.ignored)
+		}
+	}
+}
@@ -0,0 +1,265 @@
+// Copyright © 2018 Mephis Pheies <mephistommm@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package util
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// maxDiffCost limits the edit distance searched by diffLines, the changed
+// lines are replaced as a whole beyond it.
+const maxDiffCost = 2048
+
+type editOp int
+
+const (
+	editEqual editOp = iota
+	editDelete
+	editInsert
+)
+
+// edit is a step of the edit script, a and b are the positions in both
+// sequences before the step.
+type edit struct {
+	op   editOp
+	a, b int
+}
+
+// SplitLines split data into lines, each line keeps its "\n".
+func SplitLines(data []byte) []string {
+	if len(data) == 0 {
+		return nil
+	}
+	lines := strings.SplitAfter(string(data), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffLines return the shortest edit script from a to b by Myers' algorithm.
+func diffLines(a, b []string) []edit {
+	// common prefix and suffix are not searched
+	pre := 0
+	for pre < len(a) && pre < len(b) && a[pre] == b[pre] {
+		pre++
+	}
+	suf := 0
+	for suf < len(a)-pre && suf < len(b)-pre && a[len(a)-1-suf] == b[len(b)-1-suf] {
+		suf++
+	}
+
+	var edits []edit
+	for i := 0; i < pre; i++ {
+		edits = append(edits, edit{editEqual, i, i})
+	}
+	for _, e := range myers(a[pre:len(a)-suf], b[pre:len(b)-suf]) {
+		e.a += pre
+		e.b += pre
+		edits = append(edits, e)
+	}
+	for i := suf; i > 0; i-- {
+		edits = append(edits, edit{editEqual, len(a) - i, len(b) - i})
+	}
+	return edits
+}
+
+func myers(a, b []string) []edit {
+	n, m := len(a), len(b)
+	max := n + m
+	if max > maxDiffCost {
+		max = maxDiffCost
+	}
+
+	// trace[d] keeps the furthest x of diagonals -d..d after step d
+	var trace [][]int
+	off := max + 1
+	v := make([]int, 2*max+3)
+	found := false
+	for d := 0; d <= max && !found; d++ {
+		row := make([]int, 2*d+1)
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[off+k-1] < v[off+k+1]) {
+				x = v[off+k+1]
+			} else {
+				x = v[off+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[off+k] = x
+			row[k+d] = x
+			if x >= n && y >= m {
+				found = true
+				break
+			}
+		}
+		trace = append(trace, row)
+	}
+	if !found {
+		return replaceAll(n, m)
+	}
+
+	var edits []edit
+	x, y := n, m
+	for d := len(trace) - 1; d > 0; d-- {
+		prev := trace[d-1]
+		at := func(k int) int { return prev[k+d-1] }
+		k := x - y
+		var pk int
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			pk = k + 1
+		} else {
+			pk = k - 1
+		}
+		px := at(pk)
+		py := px - pk
+		for x > px && y > py {
+			x--
+			y--
+			edits = append(edits, edit{editEqual, x, y})
+		}
+		if x == px {
+			y--
+			edits = append(edits, edit{editInsert, x, y})
+		} else {
+			x--
+			edits = append(edits, edit{editDelete, x, y})
+		}
+	}
+	for x > 0 && y > 0 {
+		x--
+		y--
+		edits = append(edits, edit{editEqual, x, y})
+	}
+
+	for i, j := 0, len(edits)-1; i < j; i, j = i+1, j-1 {
+		edits[i], edits[j] = edits[j], edits[i]
+	}
+	return edits
+}
+
+// replaceAll deletes all lines of a then inserts all lines of b.
+func replaceAll(n, m int) []edit {
+	edits := make([]edit, 0, n+m)
+	for i := 0; i < n; i++ {
+		edits = append(edits, edit{editDelete, i, 0})
+	}
+	for j := 0; j < m; j++ {
+		edits = append(edits, edit{editInsert, n, j})
+	}
+	return edits
+}
+
+// WriteUnified write the hunks of unified diff from a to b with context
+// lines around changes. Headers of files are not written.
+func WriteUnified(w io.Writer, a, b []byte, context int) error {
+	al, bl := SplitLines(a), SplitLines(b)
+	edits := diffLines(al, bl)
+
+	bw := bufio.NewWriter(w)
+	for i := 0; i < len(edits); {
+		for i < len(edits) && edits[i].op == editEqual {
+			i++
+		}
+		if i == len(edits) {
+			break
+		}
+
+		start := i - context
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for {
+			for end < len(edits) && edits[end].op != editEqual {
+				end++
+			}
+			next := end
+			for next < len(edits) && edits[next].op == editEqual {
+				next++
+			}
+			if next == len(edits) || next-end > 2*context {
+				if end+context < next {
+					next = end + context
+				}
+				end = next
+				break
+			}
+			end = next
+		}
+
+		writeHunk(bw, edits[start:end], al, bl)
+		i = end
+	}
+	return bw.Flush()
+}
+
+func writeHunk(w *bufio.Writer, edits []edit, a, b []string) {
+	var aCount, bCount int
+	for _, e := range edits {
+		switch e.op {
+		case editEqual:
+			aCount++
+			bCount++
+		case editDelete:
+			aCount++
+		case editInsert:
+			bCount++
+		}
+	}
+	fmt.Fprintf(w, "@@ -%s +%s @@\n",
+		hunkRange(edits[0].a, aCount), hunkRange(edits[0].b, bCount))
+
+	for _, e := range edits {
+		switch e.op {
+		case editEqual:
+			writeHunkLine(w, ' ', a[e.a])
+		case editDelete:
+			writeHunkLine(w, '-', a[e.a])
+		case editInsert:
+			writeHunkLine(w, '+', b[e.b])
+		}
+	}
+}
+
+func hunkRange(pos, count int) string {
+	switch count {
+	case 0:
+		return fmt.Sprintf("%d,0", pos)
+	case 1:
+		return fmt.Sprintf("%d", pos+1)
+	}
+	return fmt.Sprintf("%d,%d", pos+1, count)
+}
+
+func writeHunkLine(w *bufio.Writer, prefix byte, line string) {
+	w.WriteByte(prefix)
+	w.WriteString(line)
+	if !strings.HasSuffix(line, "\n") {
+		w.WriteString("\n\\ No newline at end of file\n")
+	}
+}
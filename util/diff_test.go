@@ -0,0 +1,243 @@
+// Copyright © 2018 Mephis Pheies <mephistommm@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package util
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// numbered return lines "1\n" to "n\n".
+func numbered(n int) string {
+	var b strings.Builder
+	for i := 1; i <= n; i++ {
+		fmt.Fprintf(&b, "%d\n", i)
+	}
+	return b.String()
+}
+
+func TestWriteUnified(t *testing.T) {
+	ten := numbered(10)
+	tests := []struct {
+		name, a, b, want string
+	}{
+		{
+			name: "equal",
+			a:    ten,
+			b:    ten,
+			want: "",
+		},
+		{
+			name: "change in the middle",
+			a:    ten,
+			b:    strings.Replace(ten, "5\n", "five\n", 1),
+			want: "@@ -2,7 +2,7 @@\n 2\n 3\n 4\n-5\n+five\n 6\n 7\n 8\n",
+		},
+		{
+			name: "changes far apart are split",
+			a:    ten,
+			b:    strings.Replace(strings.Replace(ten, "1\n", "one\n", 1), "10\n", "ten\n", 1),
+			want: "@@ -1,4 +1,4 @@\n-1\n+one\n 2\n 3\n 4\n" +
+				"@@ -7,4 +7,4 @@\n 7\n 8\n 9\n-10\n+ten\n",
+		},
+		{
+			name: "changes within twice context are joined",
+			a:    ten,
+			b:    strings.Replace(strings.Replace(ten, "2\n", "two\n", 1), "9\n", "nine\n", 1),
+			want: "@@ -1,10 +1,10 @@\n 1\n-2\n+two\n 3\n 4\n 5\n 6\n 7\n 8\n-9\n+nine\n 10\n",
+		},
+		{
+			name: "add to empty",
+			a:    "",
+			b:    "a\nb\n",
+			want: "@@ -0,0 +1,2 @@\n+a\n+b\n",
+		},
+		{
+			name: "delete all",
+			a:    "a\n",
+			b:    "",
+			want: "@@ -1 +0,0 @@\n-a\n",
+		},
+		{
+			name: "insert at beginning",
+			a:    "a\nb\n",
+			b:    "x\na\nb\n",
+			want: "@@ -1,2 +1,3 @@\n+x\n a\n b\n",
+		},
+		{
+			name: "no newline at end of file",
+			a:    "a\nb",
+			b:    "a\nc",
+			want: "@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+c\n\\ No newline at end of file\n",
+		},
+		{
+			name: "newline added at end of file",
+			a:    "a",
+			b:    "a\n",
+			want: "@@ -1 +1 @@\n-a\n\\ No newline at end of file\n+a\n",
+		},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		if err := WriteUnified(&buf, []byte(tt.a), []byte(tt.b), 3); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != tt.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", tt.name, buf.String(), tt.want)
+		}
+	}
+}
+
+// lcs return the length of the longest common subsequence of a and b.
+func lcs(a, b []string) int {
+	prev := make([]int, len(b)+1)
+	for i := range a {
+		cur := make([]int, len(b)+1)
+		for j := range b {
+			switch {
+			case a[i] == b[j]:
+				cur[j+1] = prev[j] + 1
+			case prev[j+1] > cur[j]:
+				cur[j+1] = prev[j+1]
+			default:
+				cur[j+1] = cur[j]
+			}
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+// checkEdits verifies edits turn a into b, and it's the shortest if optimal.
+func checkEdits(t *testing.T, a, b []string, edits []edit, optimal bool) {
+	var got []string
+	x, y, cost := 0, 0, 0
+	for _, e := range edits {
+		if e.a != x || e.b != y {
+			t.Fatalf("edit %v at (%d, %d)", e, x, y)
+		}
+		switch e.op {
+		case editEqual:
+			if a[x] != b[y] {
+				t.Fatalf("equal edit of %q and %q", a[x], b[y])
+			}
+			got = append(got, a[x])
+			x++
+			y++
+		case editDelete:
+			x++
+			cost++
+		case editInsert:
+			got = append(got, b[y])
+			y++
+			cost++
+		}
+	}
+	if x != len(a) || y != len(b) || strings.Join(got, "") != strings.Join(b, "") {
+		t.Fatalf("edits of %q to %q end at (%d, %d) with %q", a, b, x, y, got)
+	}
+	if want := len(a) + len(b) - 2*lcs(a, b); optimal && cost != want {
+		t.Errorf("edits of %q to %q cost %d, want %d", a, b, cost, want)
+	}
+}
+
+func randomLines(r *rand.Rand, n int) []string {
+	lines := make([]string, n)
+	for i := range lines {
+		lines[i] = string(rune('a'+r.Intn(4))) + "\n"
+	}
+	return lines
+}
+
+func TestMyers(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 500; i++ {
+		a, b := randomLines(r, r.Intn(20)), randomLines(r, r.Intn(20))
+		checkEdits(t, a, b, myers(a, b), true)
+		checkEdits(t, a, b, diffLines(a, b), true)
+	}
+}
+
+func TestMyersTooExpensive(t *testing.T) {
+	a := SplitLines([]byte(numbered(maxDiffCost)))
+	b := make([]string, len(a))
+	for i := range a {
+		b[i] = "x" + a[i]
+	}
+	edits := myers(a, b)
+	checkEdits(t, a, b, edits, false)
+	if len(edits) != len(a)+len(b) {
+		t.Errorf("got %d edits, want all lines replaced", len(edits))
+	}
+}
+
+// TestWriteUnifiedApply applies the hunks to a by git and expects b.
+func TestWriteUnifiedApply(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir, err := ioutil.TempDir("", "grafter-diff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	r := rand.New(rand.NewSource(2))
+	for i := 0; i < 20; i++ {
+		a, b := randomLines(r, 1+r.Intn(40)), randomLines(r, 1+r.Intn(40))
+		if i%2 == 0 {
+			// drop the last newline
+			b[len(b)-1] = strings.TrimSuffix(b[len(b)-1], "\n")
+		}
+		from, to := strings.Join(a, ""), strings.Join(b, "")
+		if from == to {
+			continue
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, "f"), []byte(from), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		patch := &bytes.Buffer{}
+		patch.WriteString("--- a/f\n+++ b/f\n")
+		if err := WriteUnified(patch, []byte(from), []byte(to), 3); err != nil {
+			t.Fatal(err)
+		}
+		cmd := exec.Command("git", "apply", "-")
+		cmd.Dir = dir
+		cmd.Stdin = patch
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git apply %q to %q: %v\n%s", from, to, err, out)
+		}
+		data, err := ioutil.ReadFile(filepath.Join(dir, "f"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != to {
+			t.Errorf("git apply %q: got %q, want %q", from, data, to)
+		}
+	}
+}
@@ -0,0 +1,372 @@
+// Copyright © 2018 Mephis Pheies <mephistommm@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package util
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"regexp/syntax"
+	"strconv"
+	"strings"
+)
+
+// MapRule describes how paths under SRC are placed into DEST. Src and Dest
+// are slash separated paths relative to SRC and DEST.
+//
+// A prefix rule replaces the leading directory Src by Dest, e.g. "pkg/foo"
+// to "internal/foo". A regexp rule matches Src against the path and expands
+// Dest as the template of the whole DEST path, e.g. `^pkg/(\w+)/(.*)$` to
+// "internal/$1/$2".
+type MapRule struct {
+	Src    string
+	Dest   string
+	Regexp bool
+}
+
+// ErrNotInvertible is returned when a DEST path is matched by a rule which
+// couldn't be inverted.
+type ErrNotInvertible struct {
+	Rule MapRule
+}
+
+// Error ...
+func (e *ErrNotInvertible) Error() string {
+	return fmt.Sprintf("mapping %s -> %s couldn't be inverted", e.Rule.Src, e.Rule.Dest)
+}
+
+// pathRule is implemented by prefix and regexp rules.
+type pathRule interface {
+	// forward map SRC path to DEST path
+	forward(p string) (string, bool)
+	// backward map DEST path to SRC path, invertible is false if the rule
+	// couldn't be inverted.
+	backward(p string) (src string, matched bool, invertible bool)
+	rule() MapRule
+}
+
+// PathMapper maps relative paths between SRC and DEST by ordered rules. The
+// first matched rule wins, paths matched by no rule are kept as they are.
+type PathMapper struct {
+	rules []pathRule
+}
+
+// NewPathMapper compile rules into a PathMapper.
+func NewPathMapper(rules []MapRule) (*PathMapper, error) {
+	pm := &PathMapper{}
+	for _, r := range rules {
+		var pr pathRule
+		var err error
+		if r.Regexp {
+			pr, err = newRegexpRule(r)
+		} else {
+			pr = newPrefixRule(r)
+		}
+		if err != nil {
+			return nil, err
+		}
+		pm.rules = append(pm.rules, pr)
+	}
+	return pm, nil
+}
+
+// Map return the DEST path of SRC path p.
+func (pm *PathMapper) Map(p string) string {
+	if pm == nil {
+		return p
+	}
+	for _, r := range pm.rules {
+		if dest, ok := r.forward(p); ok {
+			return dest
+		}
+	}
+	return p
+}
+
+// Unmap return the SRC path which is mapped to DEST path p. ok is false if no
+// SRC path is mapped to p. err is *ErrNotInvertible if p is matched by a rule
+// which couldn't be inverted.
+func (pm *PathMapper) Unmap(p string) (src string, ok bool, err error) {
+	if pm == nil {
+		return p, true, nil
+	}
+
+	for _, r := range pm.rules {
+		candidate, matched, invertible := r.backward(p)
+		if !matched {
+			continue
+		}
+		if !invertible {
+			return "", false, &ErrNotInvertible{Rule: r.rule()}
+		}
+		// an earlier rule may catch candidate, so verify it by Map
+		if pm.Map(candidate) == p {
+			return candidate, true, nil
+		}
+	}
+
+	// paths matched by no rule are kept as they are
+	if pm.Map(p) == p {
+		return p, true, nil
+	}
+	return "", false, nil
+}
+
+// Invertible reports whether every rule could be inverted.
+func (pm *PathMapper) Invertible() bool {
+	if pm == nil {
+		return true
+	}
+	for _, r := range pm.rules {
+		if rr, ok := r.(*regexpRule); ok && !rr.invertible {
+			return false
+		}
+	}
+	return true
+}
+
+// prefixRule replaces directory prefix src by dest.
+type prefixRule struct {
+	r         MapRule
+	src, dest string
+}
+
+func newPrefixRule(r MapRule) *prefixRule {
+	return &prefixRule{
+		r:    r,
+		src:  strings.Trim(r.Src, "/"),
+		dest: strings.Trim(r.Dest, "/"),
+	}
+}
+
+func (pr *prefixRule) rule() MapRule {
+	return pr.r
+}
+
+// replacePrefix replace directory prefix from of p by to.
+func replacePrefix(p, from, to string) (string, bool) {
+	if from == "" {
+		return path.Join(to, p), true
+	}
+	if p != from && !strings.HasPrefix(p, from+"/") {
+		return "", false
+	}
+	return path.Join(to, p[len(from):]), true
+}
+
+func (pr *prefixRule) forward(p string) (string, bool) {
+	return replacePrefix(p, pr.src, pr.dest)
+}
+
+func (pr *prefixRule) backward(p string) (string, bool, bool) {
+	src, ok := replacePrefix(p, pr.dest, pr.src)
+	return src, ok, true
+}
+
+// regexpRule expands template dest with submatches of src. The rule could
+// be inverted when src only consists of literals and capture groups which are
+// all used once by dest.
+type regexpRule struct {
+	r    MapRule
+	src  *regexp.Regexp
+	dest string
+
+	// destPattern recognizes paths produced by dest, it's nil if dest is
+	// malformed. It is also the reverse regexp if invertible is true.
+	destPattern     *regexp.Regexp
+	invertible      bool
+	reverseTemplate string
+}
+
+func newRegexpRule(r MapRule) (*regexpRule, error) {
+	src, err := regexp.Compile(r.Src)
+	if err != nil {
+		return nil, err
+	}
+
+	rr := &regexpRule{
+		r:    r,
+		src:  src,
+		dest: r.Dest,
+	}
+	rr.invertRule()
+	return rr, nil
+}
+
+func (rr *regexpRule) rule() MapRule {
+	return rr.r
+}
+
+func (rr *regexpRule) forward(p string) (string, bool) {
+	match := rr.src.FindStringSubmatchIndex(p)
+	if match == nil {
+		return "", false
+	}
+	return string(rr.src.ExpandString(nil, rr.dest, p, match)), true
+}
+
+func (rr *regexpRule) backward(p string) (string, bool, bool) {
+	if rr.destPattern == nil {
+		// any path could be produced by a malformed template
+		return "", true, false
+	}
+	match := rr.destPattern.FindStringSubmatchIndex(p)
+	if match == nil {
+		return "", false, true
+	}
+	if !rr.invertible {
+		return "", true, false
+	}
+	return string(rr.destPattern.ExpandString(nil, rr.reverseTemplate, p, match)), true, true
+}
+
+// invertRule derive destPattern and the reverse template of rule.
+func (rr *regexpRule) invertRule() {
+	groups, template, ok := captureTemplate(rr.src)
+	rr.invertible = ok
+	rr.reverseTemplate = template
+
+	// convert dest template to regexp, each group must be used only once
+	names := rr.src.SubexpNames()
+	used := map[int]bool{}
+	var pattern strings.Builder
+	pattern.WriteString("^")
+	dest := rr.dest
+	for i := 0; i < len(dest); i++ {
+		if dest[i] != '$' {
+			pattern.WriteString(regexp.QuoteMeta(dest[i : i+1]))
+			continue
+		}
+		if i+1 < len(dest) && dest[i+1] == '$' {
+			pattern.WriteString(regexp.QuoteMeta("$"))
+			i++
+			continue
+		}
+
+		name, end := templateName(dest, i+1)
+		if name == "" {
+			return
+		}
+		i = end - 1
+
+		index, err := strconv.Atoi(name)
+		if err != nil {
+			index = -1
+			for j, n := range names {
+				if n == name {
+					index = j
+				}
+			}
+		}
+		sub, ok := groups[index]
+		if !ok || used[index] {
+			rr.invertible = false
+			pattern.WriteString("(?s:.*)")
+			continue
+		}
+		used[index] = true
+		pattern.WriteString("(?P<g" + strconv.Itoa(index) + ">" + sub + ")")
+	}
+	pattern.WriteString("$")
+
+	if len(used) != len(groups) {
+		rr.invertible = false
+	}
+
+	destPattern, err := regexp.Compile(pattern.String())
+	if err != nil {
+		rr.invertible = false
+		return
+	}
+	rr.destPattern = destPattern
+}
+
+// captureTemplate return capture groups of re and the template to rebuild the
+// matched string from groups named gN. ok is false if re has other parts than
+// literals, anchors and capture groups.
+func captureTemplate(re *regexp.Regexp) (groups map[int]string, template string, ok bool) {
+	groups = map[int]string{}
+	parsed, err := syntax.Parse(re.String(), syntax.Perl)
+	if err != nil {
+		return groups, "", false
+	}
+
+	nodes := []*syntax.Regexp{parsed}
+	if parsed.Op == syntax.OpConcat {
+		nodes = parsed.Sub
+	}
+
+	var b strings.Builder
+	ok = true
+	for _, n := range nodes {
+		switch n.Op {
+		case syntax.OpLiteral:
+			if n.Flags&syntax.FoldCase != 0 {
+				ok = false
+			}
+			b.WriteString(strings.Replace(string(n.Rune), "$", "$$", -1))
+		case syntax.OpCapture:
+			if hasCapture(n.Sub[0]) {
+				ok = false
+				continue
+			}
+			groups[n.Cap] = n.Sub[0].String()
+			b.WriteString("${g" + strconv.Itoa(n.Cap) + "}")
+		case syntax.OpBeginText, syntax.OpEndText, syntax.OpBeginLine, syntax.OpEndLine, syntax.OpEmptyMatch:
+		default:
+			ok = false
+		}
+	}
+	return groups, b.String(), ok
+}
+
+// templateName parse the name after '$' at start of template, and return it
+// with the end position.
+func templateName(template string, start int) (string, int) {
+	if start < len(template) && template[start] == '{' {
+		end := strings.IndexByte(template[start:], '}')
+		if end < 0 {
+			return "", start
+		}
+		return template[start+1 : start+end], start + end + 1
+	}
+
+	end := start
+	for end < len(template) {
+		c := template[end]
+		if c != '_' && !('0' <= c && c <= '9') && !('a' <= c && c <= 'z') && !('A' <= c && c <= 'Z') {
+			break
+		}
+		end++
+	}
+	return template[start:end], end
+}
+
+func hasCapture(re *syntax.Regexp) bool {
+	if re.Op == syntax.OpCapture {
+		return true
+	}
+	for _, sub := range re.Sub {
+		if hasCapture(sub) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,119 @@
+// Copyright © 2018 Mephis Pheies <mephistommm@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package util
+
+import "testing"
+
+func TestPathMapper(t *testing.T) {
+	rules := []MapRule{
+		{Src: "pkg/foo", Dest: "internal/foo"},
+		{Src: `^cmd/(\w+)/(.*)$`, Dest: "tools/$1/$2", Regexp: true},
+		{Src: `^docs/.*\.md$`, Dest: "doc.md", Regexp: true},
+	}
+	pm, err := NewPathMapper(rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		src, dest string
+	}{
+		{"pkg/foo/a.go", "internal/foo/a.go"},
+		{"pkg/foo", "internal/foo"},
+		{"pkg/foobar/a.go", "pkg/foobar/a.go"},
+		{"cmd/grafter/main.go", "tools/grafter/main.go"},
+		{"docs/a.md", "doc.md"},
+		{"README.md", "README.md"},
+	}
+	for _, tt := range tests {
+		if got := pm.Map(tt.src); got != tt.dest {
+			t.Errorf("Map(%q) = %q, want %q", tt.src, got, tt.dest)
+		}
+	}
+}
+
+func TestPathMapperUnmap(t *testing.T) {
+	rules := []MapRule{
+		{Src: "pkg/foo", Dest: "internal/foo"},
+		{Src: `^cmd/(\w+)/(.*)$`, Dest: "tools/$1/$2", Regexp: true},
+		{Src: `^docs/.*\.md$`, Dest: "doc.md", Regexp: true},
+	}
+	pm, err := NewPathMapper(rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		dest    string
+		src     string
+		ok      bool
+		invalid bool
+	}{
+		{dest: "internal/foo/a.go", src: "pkg/foo/a.go", ok: true},
+		{dest: "tools/grafter/main.go", src: "cmd/grafter/main.go", ok: true},
+		{dest: "README.md", src: "README.md", ok: true},
+		// SRC path of it is mapped elsewhere
+		{dest: "pkg/foo/a.go", ok: false},
+		// the rule drops the path, it can't be inverted
+		{dest: "doc.md", invalid: true},
+	}
+	for _, tt := range tests {
+		src, ok, err := pm.Unmap(tt.dest)
+		if _, invalid := err.(*ErrNotInvertible); invalid != tt.invalid {
+			t.Errorf("Unmap(%q) error = %v, want not invertible %v", tt.dest, err, tt.invalid)
+			continue
+		}
+		if tt.invalid {
+			continue
+		}
+		if ok != tt.ok || src != tt.src {
+			t.Errorf("Unmap(%q) = %q, %v, want %q, %v", tt.dest, src, ok, tt.src, tt.ok)
+		}
+	}
+}
+
+func TestPathMapperInvertible(t *testing.T) {
+	tests := []struct {
+		rule       MapRule
+		invertible bool
+	}{
+		{MapRule{Src: "a", Dest: "b"}, true},
+		{MapRule{Src: `^a/(.*)$`, Dest: "b/$1", Regexp: true}, true},
+		{MapRule{Src: `^a/(?P<rest>.*)$`, Dest: "b/${rest}", Regexp: true}, true},
+		{MapRule{Src: `^a/(.*)$`, Dest: "b", Regexp: true}, false},
+		{MapRule{Src: `^a/(.*)$`, Dest: "$1/$1", Regexp: true}, false},
+		{MapRule{Src: `^(a|b)/(.*)$`, Dest: "c/$2", Regexp: true}, false},
+	}
+	for _, tt := range tests {
+		pm, err := NewPathMapper([]MapRule{tt.rule})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := pm.Invertible(); got != tt.invertible {
+			t.Errorf("Invertible(%s -> %s) = %v, want %v", tt.rule.Src, tt.rule.Dest, got, tt.invertible)
+		}
+	}
+}
+
+func TestNewPathMapperInvalid(t *testing.T) {
+	if _, err := NewPathMapper([]MapRule{{Src: "(", Dest: "a", Regexp: true}}); err == nil {
+		t.Error("NewPathMapper accepted an invalid regexp")
+	}
+}
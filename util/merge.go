@@ -0,0 +1,132 @@
+// Copyright © 2018 Mephis Pheies <mephistommm@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package util
+
+import "strings"
+
+// change replaces lines [start, end) of the original by lines.
+type change struct {
+	start, end int
+	lines      []string
+}
+
+// changes return the changes from base to other, each is a run of edits
+// between equal lines.
+func changes(base, other []string) []change {
+	var cs []change
+	var cur *change
+	for _, e := range diffLines(base, other) {
+		if e.op == editEqual {
+			if cur != nil {
+				cs = append(cs, *cur)
+				cur = nil
+			}
+			continue
+		}
+		if cur == nil {
+			cur = &change{start: e.a, end: e.a}
+		}
+		if e.op == editDelete {
+			cur.end = e.a + 1
+		} else {
+			cur.lines = append(cur.lines, other[e.b])
+		}
+	}
+	if cur != nil {
+		cs = append(cs, *cur)
+	}
+	return cs
+}
+
+// applyChanges return lines [start, end) of base with cs applied, cs must be
+// in the range.
+func applyChanges(base []string, start, end int, cs []change) []string {
+	var out []string
+	pos := start
+	for _, c := range cs {
+		out = append(out, base[pos:c.start]...)
+		out = append(out, c.lines...)
+		pos = c.end
+	}
+	return append(out, base[pos:end]...)
+}
+
+// Merge3 merges the changes of a and b since base line by line. ok is false
+// if they change the same or adjacent lines differently.
+func Merge3(base, a, b []byte) ([]byte, bool) {
+	lines := SplitLines(base)
+	ca, cb := changes(lines, SplitLines(a)), changes(lines, SplitLines(b))
+
+	var out []string
+	pos, i, j := 0, 0, 0
+	for i < len(ca) || j < len(cb) {
+		// collect the changes of both sides overlapping each other
+		var ga, gb []change
+		var start, end int
+		if j >= len(cb) || i < len(ca) && ca[i].start <= cb[j].start {
+			ga = append(ga, ca[i])
+			start, end = ca[i].start, ca[i].end
+			i++
+		} else {
+			gb = append(gb, cb[j])
+			start, end = cb[j].start, cb[j].end
+			j++
+		}
+		for grew := true; grew; {
+			grew = false
+			if i < len(ca) && ca[i].start <= end {
+				ga = append(ga, ca[i])
+				end = maxInt(end, ca[i].end)
+				i++
+				grew = true
+			}
+			if j < len(cb) && cb[j].start <= end {
+				gb = append(gb, cb[j])
+				end = maxInt(end, cb[j].end)
+				j++
+				grew = true
+			}
+		}
+
+		out = append(out, lines[pos:start]...)
+		va := applyChanges(lines, start, end, ga)
+		vb := applyChanges(lines, start, end, gb)
+		switch {
+		case len(gb) == 0:
+			out = append(out, va...)
+		case len(ga) == 0:
+			out = append(out, vb...)
+		case strings.Join(va, "") == strings.Join(vb, ""):
+			out = append(out, va...)
+		default:
+			return nil, false
+		}
+		pos = end
+	}
+	out = append(out, lines[pos:]...)
+	return []byte(strings.Join(out, "")), true
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
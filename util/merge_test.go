@@ -0,0 +1,47 @@
+// Copyright © 2018 Mephis Pheies <mephistommm@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package util
+
+import "testing"
+
+func TestMerge3(t *testing.T) {
+	const base = "1\n2\n3\n4\n5\n"
+	tests := []struct {
+		name   string
+		a, b   string
+		merged string
+		ok     bool
+	}{
+		{"unchanged", base, base, base, true},
+		{"only a changed", "1\n2 a\n3\n4\n5\n", base, "1\n2 a\n3\n4\n5\n", true},
+		{"only b changed", base, "1\n2\n3\n4 b\n5\n", "1\n2\n3\n4 b\n5\n", true},
+		{"apart", "1 a\n2\n3\n4\n5\n", "1\n2\n3\n4\n5 b\n", "1 a\n2\n3\n4\n5 b\n", true},
+		{"same change", "1\n2\n3 c\n4\n5\n", "1\n2\n3 c\n4\n5\n", "1\n2\n3 c\n4\n5\n", true},
+		{"added and deleted", "0\n" + base, "1\n2\n3\n4\n", "0\n1\n2\n3\n4\n", true},
+		{"same line", "1\n2\n3 a\n4\n5\n", "1\n2\n3 b\n4\n5\n", "", false},
+		{"adjacent lines", "1\n2 a\n3\n4\n5\n", "1\n2\n3 b\n4\n5\n", "", false},
+	}
+	for _, tt := range tests {
+		merged, ok := Merge3([]byte(base), []byte(tt.a), []byte(tt.b))
+		if ok != tt.ok || ok && string(merged) != tt.merged {
+			t.Errorf("%s: Merge3 = %q, %v, want %q, %v", tt.name, merged, ok, tt.merged, tt.ok)
+		}
+	}
+}
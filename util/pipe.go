@@ -29,6 +29,15 @@ type Item struct {
 	Err error
 
 	Path string
+	Info os.FileInfo
+}
+
+// FileWalker walks files and sends them through pipe, the pipe is closed
+// when walking is finished.
+type FileWalker interface {
+	Dir() string
+	Pipe() <-chan *Item
+	Walk() error
 }
 
 // Walker walk the directory 'dir' to check each pathes of file undet it,
@@ -64,16 +73,37 @@ func (w *Walker) Walk() (err error) {
 	err = filepath.Walk(w.dir,
 		func(path string, info os.FileInfo, er error) error {
 			if er != nil {
-				// send error
+				// path can't be read, the error policy decides whether to
+				// skip it or abort walking
+				_, cerr := CheckFailed(w.checker, path, info, er)
 				w.pipe <- &Item{
-					Err: er,
+					Err:  cerr,
+					Path: path,
+				}
+				if IsAbort(cerr) {
+					return cerr
+				}
+				if info != nil && info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			ignored, cerr := Check(w.checker, path, info)
+			if cerr != nil {
+				// send error of IgnoreSupport, abort walking if asked
+				w.pipe <- &Item{
+					Err:  cerr,
+					Path: path,
+				}
+				if IsAbort(cerr) {
+					return cerr
 				}
-				return er
 			}
-			if !Check(w.checker, path, info) {
+			if !ignored {
 				// send valid path
 				w.pipe <- &Item{
 					Path: path,
+					Info: info,
 				}
 				return nil
 			}
@@ -0,0 +1,65 @@
+// Copyright © 2018 Mephis Pheies <mephistommm@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package util
+
+import (
+	"sync"
+)
+
+// Report collects what happened during a graft. It is safe to be used by
+// multiple goroutines.
+type Report struct {
+	mu sync.Mutex
+
+	Errors []error
+}
+
+// NewReport create an empty Report
+func NewReport() *Report {
+	return &Report{}
+}
+
+// AddError append err to Errors, nil is ignored.
+func (r *Report) AddError(err error) {
+	if err == nil {
+		return
+	}
+
+	r.mu.Lock()
+	r.Errors = append(r.Errors, err)
+	r.mu.Unlock()
+}
+
+// Failed reports whether any error has been collected.
+func (r *Report) Failed() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.Errors) > 0
+}
+
+// Log print all collected errors by Logger
+func (r *Report) Log() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, err := range r.Errors {
+		Logger.Error(err.Error())
+	}
+}
@@ -0,0 +1,196 @@
+// Copyright © 2018 Mephis Pheies <mephistommm@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+//go:build linux
+// +build linux
+
+package util
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+// watchMask is the inotify events of watched directories.
+const watchMask = syscall.IN_CREATE | syscall.IN_CLOSE_WRITE | syscall.IN_MODIFY |
+	syscall.IN_ATTRIB | syscall.IN_DELETE | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO
+
+// watchDir is a directory watched by inotify.
+type watchDir struct {
+	path    string
+	checker IgnoreSupport
+}
+
+// Watcher watches directories recursively by inotify, directories created
+// under watched directories are watched automatically. Ignored files and
+// directories are not reported.
+type Watcher struct {
+	fd int
+	// file reads fd by the poller, so closing it stops reading
+	file *os.File
+
+	mu   sync.Mutex
+	dirs map[int]*watchDir
+
+	events chan WatchEvent
+	errors chan error
+}
+
+// NewWatcher create a Watcher, events are read after the first root is
+// added.
+func NewWatcher() (*Watcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+	w := &Watcher{
+		fd:     fd,
+		file:   os.NewFile(uintptr(fd), "inotify"),
+		dirs:   map[int]*watchDir{},
+		events: make(chan WatchEvent, 64),
+		errors: make(chan error, 8),
+	}
+	go w.read()
+	return w, nil
+}
+
+// Events return the channel of changes.
+func (w *Watcher) Events() <-chan WatchEvent {
+	return w.events
+}
+
+// Errors return the channel of errors while watching.
+func (w *Watcher) Errors() <-chan error {
+	return w.errors
+}
+
+// Add watches directory root and all directories under it which are not
+// ignored by checker.
+func (w *Watcher) Add(root string, checker IgnoreSupport) error {
+	walker := NewWalker(root, checker, 10)
+	walkErr := make(chan error, 1)
+	go func() {
+		walkErr <- walker.Walk()
+	}()
+
+	var err error
+	for item := range walker.Pipe() {
+		if item.Err != nil {
+			w.errors <- item.Err
+			continue
+		}
+		if !item.Info.IsDir() || err != nil {
+			continue
+		}
+		err = w.addDir(item.Path, checker)
+	}
+	if werr := <-walkErr; err == nil && IsAbort(werr) {
+		err = werr
+	}
+	return err
+}
+
+func (w *Watcher) addDir(dir string, checker IgnoreSupport) error {
+	wd, err := syscall.InotifyAddWatch(w.fd, dir, watchMask|syscall.IN_ONLYDIR)
+	if err != nil {
+		return fmt.Errorf("Failed to watch %s: %v", dir, err)
+	}
+	w.mu.Lock()
+	w.dirs[wd] = &watchDir{path: dir, checker: checker}
+	w.mu.Unlock()
+	return nil
+}
+
+// read parses inotify events until the watcher is closed.
+func (w *Watcher) read() {
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil || n <= 0 {
+			close(w.events)
+			return
+		}
+
+		for off := 0; off+syscall.SizeofInotifyEvent <= n; {
+			ev := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[off]))
+			name := buf[off+syscall.SizeofInotifyEvent : off+syscall.SizeofInotifyEvent+int(ev.Len)]
+			off += syscall.SizeofInotifyEvent + int(ev.Len)
+			for i, c := range name {
+				if c == 0 {
+					name = name[:i]
+					break
+				}
+			}
+			w.handle(ev.Wd, ev.Mask, string(name))
+		}
+	}
+}
+
+// handle reports the event mask of name under the directory of wd.
+func (w *Watcher) handle(wd int32, mask uint32, name string) {
+	if mask&syscall.IN_Q_OVERFLOW != 0 {
+		w.events <- WatchEvent{}
+		return
+	}
+
+	w.mu.Lock()
+	dir, ok := w.dirs[int(wd)]
+	if mask&syscall.IN_IGNORED != 0 {
+		delete(w.dirs, int(wd))
+	}
+	w.mu.Unlock()
+	if !ok || name == "" {
+		return
+	}
+
+	ev := WatchEvent{
+		Path:    filepath.Join(dir.path, name),
+		Dir:     mask&syscall.IN_ISDIR != 0,
+		Removed: mask&(syscall.IN_DELETE|syscall.IN_MOVED_FROM) != 0,
+	}
+	if !ev.Removed {
+		info, err := os.Lstat(ev.Path)
+		if err != nil {
+			// removed again, its removal is reported by another event
+			return
+		}
+		ignored, err := Check(dir.checker, ev.Path, info)
+		if err != nil {
+			w.errors <- err
+		}
+		if ignored {
+			return
+		}
+		if ev.Dir && mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0 {
+			if err := w.Add(ev.Path, dir.checker); err != nil {
+				w.errors <- err
+			}
+		}
+	}
+	w.events <- ev
+}
+
+// Close stops watching.
+func (w *Watcher) Close() error {
+	return w.file.Close()
+}
@@ -0,0 +1,110 @@
+// Copyright © 2018 Mephis Pheies <mephistommm@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// waitEvent return the first event of w on path, other events are returned
+// in skipped.
+func waitEvent(t *testing.T, w *Watcher, path string) (WatchEvent, []WatchEvent) {
+	var skipped []WatchEvent
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case ev := <-w.Events():
+			if ev.Path == path {
+				return ev, skipped
+			}
+			skipped = append(skipped, ev)
+		case err := <-w.Errors():
+			t.Fatal(err)
+		case <-timeout:
+			t.Fatalf("no event of %s, got %v", path, skipped)
+		}
+	}
+}
+
+func TestWatcher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "grafter-watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Mkdir(filepath.Join(dir, "logs.log"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	checker, err := NewIgnoreRegexpMatchSupport(dir, `\.log$`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := NewWatcher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if err := w.Add(dir, checker); err != nil {
+		t.Fatal(err)
+	}
+
+	write := func(rel string) {
+		if err := ioutil.WriteFile(filepath.Join(dir, rel), []byte(rel), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// ignored files and files under ignored directories are not reported
+	write("a.log")
+	write("logs.log/b")
+	write("a")
+	ev, skipped := waitEvent(t, w, filepath.Join(dir, "a"))
+	if ev.Dir || ev.Removed {
+		t.Errorf("event of new file: %+v", ev)
+	}
+	for _, ev := range skipped {
+		t.Errorf("event of ignored file: %+v", ev)
+	}
+
+	// new directories are watched
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if ev, _ := waitEvent(t, w, filepath.Join(dir, "sub")); !ev.Dir {
+		t.Errorf("event of new directory: %+v", ev)
+	}
+	write("sub/c")
+	waitEvent(t, w, filepath.Join(dir, "sub", "c"))
+
+	if err := os.Remove(filepath.Join(dir, "a")); err != nil {
+		t.Fatal(err)
+	}
+	// events of writing a may come first
+	for {
+		if ev, _ := waitEvent(t, w, filepath.Join(dir, "a")); ev.Removed {
+			break
+		}
+	}
+}
@@ -0,0 +1,48 @@
+// Copyright © 2018 Mephis Pheies <mephistommm@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+//go:build !linux
+// +build !linux
+
+package util
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// Watcher is only supported on linux.
+type Watcher struct{}
+
+// NewWatcher return an error since inotify is not available.
+func NewWatcher() (*Watcher, error) {
+	return nil, fmt.Errorf("watching is not supported on %s", runtime.GOOS)
+}
+
+// Events return nil.
+func (w *Watcher) Events() <-chan WatchEvent { return nil }
+
+// Errors return nil.
+func (w *Watcher) Errors() <-chan error { return nil }
+
+// Add does nothing.
+func (w *Watcher) Add(root string, checker IgnoreSupport) error { return nil }
+
+// Close does nothing.
+func (w *Watcher) Close() error { return nil }